@@ -0,0 +1,97 @@
+// Generates API keys and manages the database-backed key store.
+//
+//	apikey -name collector-1 -scopes ingest            print a key and its hash
+//	apikey -name collector-1 -scopes ingest -store     also store the hash in api_keys
+//	apikey -name collector-1 -revoke                   revoke stored keys by name
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/repository"
+	"os"
+	"strings"
+)
+
+func main() {
+	name := flag.String("name", "", "key name, reported as the caller identity")
+	scopes := flag.String("scopes", "read", "comma-separated scopes (ingest, read, annotate, webhooks)")
+	store := flag.Bool("store", false, "store the key hash in the database (DATABASE_URL)")
+	revoke := flag.Bool("revoke", false, "revoke stored keys with the given name")
+	flag.Parse()
+
+	if *name == "" {
+		fail(fmt.Errorf("-name is required"))
+	}
+
+	if *revoke {
+		repo := openRepository()
+		n, err := repo.Revoke(*name)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("revoked %d key(s)\n", n)
+		return
+	}
+
+	scopeList, err := parseScopes(*scopes)
+	if err != nil {
+		fail(err)
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		fail(fmt.Errorf("generate key: %w", err))
+	}
+	hash := auth.HashAPIKey(key)
+
+	if *store {
+		if err := openRepository().Create(hash, *name, scopeList); err != nil {
+			fail(err)
+		}
+	}
+
+	fmt.Printf("key:    %s\n", key)
+	fmt.Printf("sha256: %s\n", hash)
+	fmt.Printf("scopes: %s\n", strings.Join(scopeList, ","))
+}
+
+func parseScopes(s string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		switch auth.Scope(scope) {
+		case auth.ScopeIngest, auth.ScopeRead, auth.ScopeAnnotate, auth.ScopeWebhooks:
+			scopes = append(scopes, scope)
+		default:
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return scopes, nil
+}
+
+func openRepository() *repository.APIKeyRepository {
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		fail(err)
+	}
+
+	db, err := database.New(cfg.DatabaseURL)
+	if err != nil {
+		fail(err)
+	}
+
+	if err := database.RunMigrations(db); err != nil {
+		fail(err)
+	}
+
+	return repository.NewAPIKeyRepository(db)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "apikey:", err)
+	os.Exit(1)
+}
@@ -1,29 +1,60 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"mqtt-catalog/internal/collector"
 	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/logging"
+	"net/http"
+	"os"
 )
 
 func main() {
 	cfg, err := config.LoadCollectorConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", err)
 	}
 
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fatal("Failed to configure logging", err)
+	}
+	slog.SetDefault(logger)
+
 	if len(cfg.Brokers) == 0 {
-		log.Fatalf("No brokers configured")
+		fatal("Failed to start collector", errors.New("no brokers configured"))
+	}
+
+	slog.Info("Starting MQTT Topic Collector",
+		"db_service_url", cfg.DBServiceURL,
+		"duration", cfg.CollectionDuration,
+		"brokers", len(cfg.Brokers),
+	)
+	if cfg.Shard.Enabled {
+		slog.Info("Collector sharding enabled",
+			"instance_id", cfg.Shard.InstanceID,
+			"lease_ttl", cfg.Shard.LeaseTTL,
+		)
 	}
 
-	log.Printf("Starting MQTT Topic Collector")
-	log.Printf("Database Service: %s", cfg.DBServiceURL)
-	log.Printf("Duration: %v", cfg.CollectionDuration)
-	log.Printf("Configured brokers: %d", len(cfg.Brokers))
+	mc := collector.NewMultiCollector(cfg)
 
-	mc := collector.NewMultiCollector(cfg.Brokers, cfg.DBServiceURL)
+	if cfg.AdminAddr != "" {
+		go func() {
+			slog.Info("Starting admin listener", "addr", cfg.AdminAddr)
+			if err := http.ListenAndServe(cfg.AdminAddr, mc.AdminHandler()); err != nil {
+				slog.Error("Admin listener error", "error", err)
+			}
+		}()
+	}
 
 	if err := mc.Run(cfg.CollectionDuration); err != nil {
-		log.Fatalf("Collector error: %v", err)
+		fatal("Collector error", err)
 	}
 }
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
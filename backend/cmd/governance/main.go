@@ -0,0 +1,153 @@
+// Checks topic names against the naming rules in GOVERNANCE_CONFIG and exits
+// non-zero on violations, so it can gate CI pipelines.
+//
+//	governance                              check every live topic in the catalog
+//	governance -broker broker1 -include-stale
+//	governance -topics planned.txt          check topic names, one per line ("-" reads stdin)
+//
+// Exit status is 0 without violations, 1 when errors (or, with -strict,
+// warnings) were found and 2 when the check could not run
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/governance"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/retention"
+	"mqtt-catalog/pkg/models"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	brokers := flag.String("broker", "", "comma-separated broker IDs to check, all when empty; with -topics the broker the names belong to")
+	includeStale := flag.Bool("include-stale", false, "also check topics past their stale threshold")
+	topicsFile := flag.String("topics", "", "check topic names from this file instead of the catalog")
+	format := flag.String("format", "text", "output format (text, json)")
+	strict := flag.Bool("strict", false, "fail on warnings as well as errors")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		fail(fmt.Errorf("unknown format %q", *format))
+	}
+
+	cfg, err := config.LoadServerConfig()
+	if err != nil {
+		fail(err)
+	}
+	linter := governance.NewLinter(cfg.Governance)
+	if linter.Rules() == 0 {
+		fmt.Fprintln(os.Stderr, "governance: no rules configured, set GOVERNANCE_CONFIG")
+	}
+
+	var report *models.GovernanceReport
+	if *topicsFile != "" {
+		topics, err := readTopics(*topicsFile)
+		if err != nil {
+			fail(err)
+		}
+		report = linter.LintNames(*brokers, topics)
+	} else {
+		report, err = lintCatalog(cfg, linter, *brokers, *includeStale)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	if err := write(os.Stdout, report, *format); err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "checked %d topics against %d rules: %d errors, %d warnings\n",
+		report.TopicsChecked, report.Rules, report.Errors, report.Warnings)
+
+	if report.Errors > 0 || (*strict && report.Warnings > 0) {
+		os.Exit(1)
+	}
+}
+
+func lintCatalog(cfg *config.ServerConfig, linter *governance.Linter, brokers string, includeStale bool) (*models.GovernanceReport, error) {
+	db, err := database.New(cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Only reads the catalog, so the schema is checked rather than migrated
+	current, err := database.CurrentVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if current < database.LatestVersion() {
+		return nil, fmt.Errorf("schema version %d is behind %d, start the server to migrate", current, database.LatestVersion())
+	}
+
+	var opts repository.ListOptions
+	for _, id := range strings.Split(brokers, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			opts.BrokerIDs = append(opts.BrokerIDs, id)
+		}
+	}
+	if !includeStale {
+		opts.LiveAfter = retention.StaleCutoff(cfg.Retention, time.Now())
+	}
+
+	return linter.Lint(repository.NewTopicRepository(db), opts)
+}
+
+// Reads one topic per line, skipping blank lines and # comments
+func readTopics(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("read topics: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var topics []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		topics = append(topics, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read topics: %w", err)
+	}
+	return topics, nil
+}
+
+func write(w io.Writer, report *models.GovernanceReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	for _, v := range report.Violations {
+		topic := v.Topic
+		if v.BrokerID != "" {
+			topic = v.BrokerID + ":" + topic
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s: %s\n", strings.ToUpper(v.Severity), topic, v.Rule, v.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "governance:", err)
+	os.Exit(2)
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"mqtt-catalog/internal/api"
+	"mqtt-catalog/internal/auth"
 	"mqtt-catalog/internal/config"
 	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/logging"
 	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/retention"
+	"mqtt-catalog/internal/webhook"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,26 +21,66 @@ import (
 func main() {
 	cfg, err := config.LoadServerConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", err)
 	}
 
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fatal("Failed to configure logging", err)
+	}
+	slog.SetDefault(logger)
+
 	// Initialize database
 	db, err := database.New(cfg.DatabaseURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
-	log.Println("Running database migrations...")
+	slog.Info("Running database migrations")
 	if err := database.RunMigrations(db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		fatal("Failed to run migrations", err)
 	}
 
 	// Initialize repository
 	repo := repository.NewTopicRepository(db)
 
+	// Start retention purge job
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	purger := retention.NewPurger(repo, cfg.Retention)
+	if purger.Enabled() {
+		slog.Info("Starting retention purge", "interval", cfg.Retention.PurgeInterval)
+		go purger.Run(jobCtx)
+	}
+
+	authn, err := auth.FromConfig(cfg.Auth, db)
+	if err != nil {
+		fatal("Failed to configure authentication", err)
+	}
+	if authn == nil {
+		slog.Warn("Authentication disabled, set AUTH_CONFIG to require credentials")
+	}
+
 	// Setup HTTP server
-	router := api.NewRouter(repo)
+	router := api.NewRouter(db, repo, cfg, authn)
+
+	// The router sets up the event hub that webhooks and the stale watcher use
+	dispatcher := webhook.NewDispatcher(repository.NewWebhookRepository(db), cfg.Webhooks)
+	dispatched := make(chan struct{})
+	go func() {
+		dispatcher.Run(jobCtx, repo.Events())
+		close(dispatched)
+	}()
+
+	go sweepClaims(jobCtx, repository.NewLeaseRepository(db), claimSweepInterval)
+
+	staleWatcher := retention.NewStaleWatcher(repo, repo.Events(), cfg.Retention)
+	if staleWatcher.Enabled() {
+		slog.Info("Starting stale topic watcher", "interval", cfg.Retention.StaleCheckInterval)
+		go staleWatcher.Run(jobCtx)
+	}
 
 	server := &http.Server{
 		Addr:         cfg.ServerAddr,
@@ -44,13 +88,17 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
+	// Shutdown waits for active requests to finish, which event streams never do,
+	// so event streams are ended explicitly
+	server.RegisterOnShutdown(repo.Events().Close)
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting server on %s", cfg.ServerAddr)
+		slog.Info("Starting server", "addr", cfg.ServerAddr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+			fatal("Server error", err)
 		}
 	}()
 
@@ -59,14 +107,44 @@ func main() {
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server stopped")
+	// Jobs stop once requests are done, and the webhook dispatcher first
+	// records the events still queued for it, so a restart does not lose them
+	stopJobs()
+	<-dispatched
+
+	slog.Info("Server stopped")
+}
+
+// How often expired sample claims are deleted. Claims are taken over in place
+// once expired, so the sweep only keeps topics no longer sampled from piling up
+const claimSweepInterval = time.Minute
+
+func sweepClaims(ctx context.Context, leases *repository.LeaseRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if _, err := leases.ExpireClaims(); err != nil {
+			slog.Error("Sample claim sweep failed", "error", err)
+		}
+	}
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Attaches matching annotations to topics in responses. Handlers built
+// without an annotation repository leave topics unannotated
+func (h *Handler) annotate(topics []models.Topic) error {
+	if h.annotations == nil {
+		return nil
+	}
+	return h.annotations.Annotate(topics)
+}
+
+// Lists annotations, optionally only those of a broker, with one of the
+// given tags or owned by one of the given owners
+func (h *Handler) ListAnnotations(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	annotations, total, err := h.annotations.List(repository.AnnotationFilter{
+		BrokerID: r.URL.Query().Get("broker_id"),
+		Tags:     parseListQuery(r, "tag"),
+		Owners:   parseListQuery(r, "owner"),
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		serverError(w, r, "Error listing annotations", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.AnnotationListResponse{Annotations: annotations, Total: total})
+}
+
+// Annotates a topic or topic filter; 409 when the broker already has an
+// annotation for the same filter
+func (h *Handler) CreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	a, ok := decodeAnnotation(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.annotations.Create(&a)
+	if errors.Is(err, repository.ErrAnnotationExists) {
+		annotationConflict(w, r, a)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Error creating annotation", err, "broker_id", a.BrokerID, "topic_filter", a.TopicFilter)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (h *Handler) GetAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, ok := annotationID(w, r)
+	if !ok {
+		return
+	}
+
+	a, err := h.annotations.Get(id)
+	if err != nil {
+		serverError(w, r, "Error getting annotation", err, "id", id)
+		return
+	}
+	if a == nil {
+		annotationNotFound(w, r, id)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+// Replaces every field of an annotation
+func (h *Handler) UpdateAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, ok := annotationID(w, r)
+	if !ok {
+		return
+	}
+	a, ok := decodeAnnotation(w, r)
+	if !ok {
+		return
+	}
+	a.ID = id
+
+	found, err := h.annotations.Update(&a)
+	if errors.Is(err, repository.ErrAnnotationExists) {
+		annotationConflict(w, r, a)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Error updating annotation", err, "id", id)
+		return
+	}
+	if !found {
+		annotationNotFound(w, r, id)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) DeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, ok := annotationID(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := h.annotations.Delete(id)
+	if err != nil {
+		serverError(w, r, "Error deleting annotation", err, "id", id)
+		return
+	}
+	if !found {
+		annotationNotFound(w, r, id)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Parses the {id} path value
+func annotationID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		badRequest(w, r, invalidParam("id", "invalid annotation id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+// Decodes and validates an annotation request body, answering 400 or 413
+// when it is unusable
+func decodeAnnotation(w http.ResponseWriter, r *http.Request) (models.Annotation, bool) {
+	var a models.Annotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		if isBodyTooLarge(err) {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+			return a, false
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, fmt.Sprintf("invalid request body: %v", err), nil)
+		return a, false
+	}
+
+	if err := validateAnnotation(a); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, err.Error(), nil)
+		return a, false
+	}
+	if a.Links == nil {
+		a.Links = []string{}
+	}
+	return a, true
+}
+
+func validateAnnotation(a models.Annotation) error {
+	if a.TopicFilter == "" {
+		return errors.New("topic_filter is required")
+	}
+	if err := repository.ValidateTopicFilter(a.TopicFilter); err != nil {
+		return err
+	}
+
+	switch a.Classification {
+	case "", models.ClassificationPublic, models.ClassificationInternal, models.ClassificationConfidential:
+	default:
+		return fmt.Errorf("invalid classification %q, expected public, internal or confidential", a.Classification)
+	}
+
+	for _, link := range a.Links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid link %q, expected an http or https URL", link)
+		}
+	}
+	return nil
+}
+
+func annotationNotFound(w http.ResponseWriter, r *http.Request, id int64) {
+	apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "annotation not found", map[string]any{"id": id})
+}
+
+func annotationConflict(w http.ResponseWriter, r *http.Request, a models.Annotation) {
+	apierror.Write(w, r, http.StatusConflict, apierror.CodeConflict, "an annotation for this broker and topic filter already exists",
+		map[string]any{"broker_id": a.BrokerID, "topic_filter": a.TopicFilter})
+}
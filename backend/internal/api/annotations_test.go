@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	seedContractTopics(t, repo)
+	router := NewRouter(db, repo, &config.ServerConfig{}, nil)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := do("POST", "/api/v1/annotations", `{"topic_filter": "plant1/#", "owner": "plant-ops", "tags": ["plant"],
+		"classification": "confidential", "description": "Plant 1 telemetry"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body.String())
+	}
+
+	// A new sample for an annotated topic keeps its annotations
+	w = do("POST", "/api/v1/samples", `{"broker_id": "broker1", "topic": "plant1/line2/status", "payload_type": "text", "payload": "c3RvcHBlZA=="}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sample = %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("GET", "/api/v1/topics?tag=plant&sort=topic&order=asc", "")
+	var list models.TopicListResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || list.Total != 2 {
+		t.Fatalf("list = %d %s", w.Code, w.Body.String())
+	}
+	for _, topic := range list.Topics {
+		if len(topic.Annotations) != 1 || topic.Annotations[0].Owner != "plant-ops" ||
+			topic.Annotations[0].Classification != models.ClassificationConfidential {
+			t.Errorf("topic %s annotations = %+v", topic.Topic, topic.Annotations)
+		}
+	}
+
+	w = do("GET", "/api/v1/topics/search?broker_id=broker1&topic=plant1/line2/status", "")
+	var topic models.Topic
+	json.Unmarshal(w.Body.Bytes(), &topic)
+	if len(topic.Annotations) != 1 {
+		t.Errorf("lookup annotations = %+v", topic.Annotations)
+	}
+
+	if w := do("GET", "/api/v1/topics?owner=nobody", ""); !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Errorf("owner filter = %s", w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"owner": "x"}`,
+		`{"topic_filter": "a/+b"}`,
+		`{"topic_filter": "a", "classification": "secret"}`,
+		`{"topic_filter": "a", "links": ["javascript:alert(1)"]}`,
+		`{"topic_filter": `,
+	} {
+		if w := do("POST", "/api/v1/annotations", body); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	minLeaseTTL = 5 * time.Second
+	maxLeaseTTL = time.Hour
+	minClaimTTL = time.Second
+	maxClaimTTL = 24 * time.Hour
+)
+
+// Collector instance IDs such as host names or pod names
+var instanceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Lists the live collector instances and the brokers each one holds
+func (h *Handler) ListCollectors(w http.ResponseWriter, r *http.Request) {
+	collectors, err := h.leases.List()
+	if err != nil {
+		serverError(w, r, "Error listing collectors", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.CollectorListResponse{Collectors: collectors})
+}
+
+// Renews a collector instance's membership and broker leases and returns
+// the live members and the brokers it was granted
+func (h *Handler) RenewLease(w http.ResponseWriter, r *http.Request) {
+	instanceID, ok := collectorInstanceID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+			return
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, fmt.Sprintf("invalid request body: %v", err), nil)
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl < minLeaseTTL || ttl > maxLeaseTTL {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody,
+			fmt.Sprintf("ttl_seconds must be between %.0f and %.0f", minLeaseTTL.Seconds(), maxLeaseTTL.Seconds()), nil)
+		return
+	}
+	for _, broker := range req.Brokers {
+		if broker == "" {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "broker IDs must not be empty", nil)
+			return
+		}
+	}
+
+	resp, err := h.leases.Renew(instanceID, req.Brokers, ttl)
+	if err != nil {
+		serverError(w, r, "Error renewing collector lease", err, "instance_id", instanceID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Releases a stopping collector instance's leases so its brokers move to
+// other instances without waiting for the leases to expire
+func (h *Handler) ReleaseLease(w http.ResponseWriter, r *http.Request) {
+	instanceID, ok := collectorInstanceID(w, r)
+	if !ok {
+		return
+	}
+
+	released, err := h.leases.Release(instanceID)
+	if err != nil {
+		serverError(w, r, "Error releasing collector lease", err, "instance_id", instanceID)
+		return
+	}
+	if !released {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "collector holds no lease",
+			map[string]any{"instance_id": instanceID})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Largest page of known topic names
+const maxKnownTopicsLimit = 10000
+
+// Lists the names of a broker's topics seen since seen_after, so a restarted
+// collector only samples new and stale topics. Pages are keyed by topic name:
+// a page continues after the next_after of the previous one
+func (h *Handler) KnownTopics(w http.ResponseWriter, r *http.Request) {
+	brokerID := r.URL.Query().Get("broker_id")
+	if brokerID == "" {
+		badRequest(w, r, invalidParam("broker_id", "broker_id is required"))
+		return
+	}
+	seenAfter, err := parseTimeQuery(r, "seen_after")
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	if seenAfter.IsZero() {
+		badRequest(w, r, invalidParam("seen_after", "seen_after is required"))
+		return
+	}
+
+	limit, err := parseIntQuery(r, "limit", maxKnownTopicsLimit)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxKnownTopicsLimit {
+		badRequest(w, r, invalidParam("limit", "invalid limit, expected 1 to %d", maxKnownTopicsLimit))
+		return
+	}
+
+	// One extra row tells whether another page follows
+	topics, err := h.repo.KnownTopics(brokerID, seenAfter, r.URL.Query().Get("after"), limit+1)
+	if err != nil {
+		serverError(w, r, "Error listing known topics", err, "broker_id", brokerID)
+		return
+	}
+
+	resp := models.KnownTopicsResponse{BrokerID: brokerID, SeenAfter: seenAfter, Topics: topics}
+	if len(topics) > limit {
+		resp.Topics = topics[:limit]
+		resp.NextAfter = topics[limit-1]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Claims sampling a topic for one of the collector instances sharing a
+// broker's messages; only the instance holding the claim uploads the sample
+func (h *Handler) ClaimSample(w http.ResponseWriter, r *http.Request) {
+	var req models.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+			return
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, fmt.Sprintf("invalid request body: %v", err), nil)
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	switch {
+	case req.BrokerID == "" || req.Topic == "":
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "broker_id and topic are required", nil)
+		return
+	case !instanceIDPattern.MatchString(req.InstanceID):
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody,
+			fmt.Sprintf("invalid collector instance id %q", req.InstanceID), nil)
+		return
+	case ttl < minClaimTTL || ttl > maxClaimTTL:
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody,
+			fmt.Sprintf("ttl_seconds must be between %.0f and %.0f", minClaimTTL.Seconds(), maxClaimTTL.Seconds()), nil)
+		return
+	}
+
+	resp, err := h.leases.Claim(req.BrokerID, req.Topic, req.InstanceID, ttl)
+	if err != nil {
+		serverError(w, r, "Error claiming sample", err, "broker_id", req.BrokerID, "topic", req.Topic)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Drops a collector instance's claim on a topic after its upload failed, so
+// another instance sharing the broker samples the topic instead
+func (h *Handler) ReleaseClaim(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	brokerID, topic, instanceID := q.Get("broker_id"), q.Get("topic"), q.Get("instance_id")
+	switch {
+	case brokerID == "":
+		badRequest(w, r, invalidParam("broker_id", "broker_id is required"))
+		return
+	case topic == "":
+		badRequest(w, r, invalidParam("topic", "topic is required"))
+		return
+	case !instanceIDPattern.MatchString(instanceID):
+		badRequest(w, r, invalidParam("instance_id", "invalid collector instance id %q", instanceID))
+		return
+	}
+
+	released, err := h.leases.ReleaseClaim(brokerID, topic, instanceID)
+	if err != nil {
+		serverError(w, r, "Error releasing sample claim", err, "broker_id", brokerID, "topic", topic)
+		return
+	}
+	if !released {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "collector holds no claim on the topic",
+			map[string]any{"broker_id": brokerID, "topic": topic, "instance_id": instanceID})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Parses the {instance_id} path value
+func collectorInstanceID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("instance_id")
+	if !instanceIDPattern.MatchString(id) {
+		badRequest(w, r, invalidParam("instance_id", "invalid collector instance id %q", id))
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/config"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type corsPolicy struct {
+	cfg       config.CORSConfig
+	mux       *http.ServeMux
+	anyOrigin bool
+	anyHeader bool
+	headers   []string
+	maxAge    string
+}
+
+func newCORSPolicy(cfg config.CORSConfig, mux *http.ServeMux) *corsPolicy {
+	p := &corsPolicy{
+		cfg:       cfg,
+		mux:       mux,
+		anyOrigin: slices.Contains(cfg.AllowedOrigins, "*"),
+		anyHeader: slices.Contains(cfg.AllowedHeaders, "*"),
+		maxAge:    strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, h := range cfg.AllowedHeaders {
+		p.headers = append(p.headers, strings.ToLower(h))
+	}
+	return p
+}
+
+// Applies the configured cross-origin policy. Preflight requests are answered
+// here using the methods the matched route actually serves; all other
+// requests pass through with CORS headers added for allowed origins
+func (p *corsPolicy) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			p.preflight(w, r, origin)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && p.originAllowed(origin) {
+			p.setOrigin(w, origin)
+			if len(p.cfg.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.cfg.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if len(routeMethods(p.mux, r, routeProbeMethods)) == 0 {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "no route for "+r.URL.Path, nil)
+		return
+	}
+
+	if origin == "" || !p.originAllowed(origin) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "origin not allowed", nil)
+		return
+	}
+
+	methods := routeMethods(p.mux, r, p.cfg.AllowedMethods)
+	requestedMethod := r.Header.Get("Access-Control-Request-Method")
+	if !slices.Contains(methods, requestedMethod) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "method not allowed",
+			map[string]any{"method": requestedMethod})
+		return
+	}
+
+	requested := splitHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if !p.headersAllowed(requested) {
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "header not allowed",
+			map[string]any{"headers": requested})
+		return
+	}
+
+	p.setOrigin(w, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requested) > 0 {
+		if p.anyHeader {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		} else {
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.cfg.AllowedHeaders, ", "))
+		}
+	}
+	if p.cfg.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *corsPolicy) setOrigin(w http.ResponseWriter, origin string) {
+	if p.anyOrigin && !p.cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (p *corsPolicy) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.cfg.AllowedOrigins {
+		if matchOrigin(strings.ToLower(allowed), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Browsers do not apply CORS to WebSockets, so handshakes are accepted from
+// the server's own origin and from origins the policy allows
+func (p *corsPolicy) websocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.originAllowed(origin)
+}
+
+// Matches an origin against an exact value, "*", or a pattern with one
+// wildcard standing for a non-empty run of characters (e.g. https://*.example.com)
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return pattern == origin
+	}
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+func (p *corsPolicy) headersAllowed(requested []string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, h := range requested {
+		if !slices.Contains(p.headers, strings.ToLower(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitHeaderList(s string) []string {
+	var headers []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
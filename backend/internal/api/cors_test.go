@@ -0,0 +1,111 @@
+package api
+
+import (
+	"mqtt-catalog/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS_Preflight(t *testing.T) {
+	router := setupTestRouter(t, &config.ServerConfig{CORS: config.CORSConfig{
+		AllowedOrigins: []string{"https://catalog.example.com", "https://*.dev.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         10 * time.Minute,
+	}})
+
+	tests := []struct {
+		name        string
+		path        string
+		origin      string
+		method      string
+		headers     string
+		wantStatus  int
+		wantMethods string
+	}{
+		{"exact origin", "/api/topics", "https://catalog.example.com", "GET", "Authorization", http.StatusNoContent, "GET"},
+		{"pattern origin", "/api/samples", "https://ui.dev.example.com", "POST", "content-type", http.StatusNoContent, "POST"},
+		{"unknown origin", "/api/topics", "https://evil.example.com", "GET", "", http.StatusForbidden, ""},
+		{"pattern needs subdomain", "/api/topics", "https://.dev.example.com", "GET", "", http.StatusForbidden, ""},
+		{"method not served by route", "/api/topics", "https://catalog.example.com", "POST", "", http.StatusForbidden, ""},
+		{"header not allowed", "/api/topics", "https://catalog.example.com", "GET", "X-Custom", http.StatusForbidden, ""},
+		{"unknown route", "/api/nope", "https://catalog.example.com", "GET", "", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("expected allowed methods %q, got %q", tt.wantMethods, got)
+			}
+			if tt.wantStatus != http.StatusNoContent {
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("expected no allowed origin, got %q", got)
+				}
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("expected allowed origin %q, got %q", tt.origin, got)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("expected max age 600, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCORS_SimpleRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.CORSConfig
+		origin    string
+		wantAllow string
+		wantCreds string
+	}{
+		{"no origins configured", config.CORSConfig{}, "https://catalog.example.com", "", ""},
+		{"wildcard", config.CORSConfig{AllowedOrigins: []string{"*"}}, "https://any.example.com", "*", ""},
+		{
+			"credentials echo origin",
+			config.CORSConfig{AllowedOrigins: []string{"https://catalog.example.com"}, AllowCredentials: true},
+			"https://catalog.example.com", "https://catalog.example.com", "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ExposedHeaders = []string{"X-Request-ID"}
+			router := setupTestRouter(t, &config.ServerConfig{CORS: tt.cfg})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("expected allowed origin %q, got %q", tt.wantAllow, got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCreds {
+				t.Errorf("expected credentials %q, got %q", tt.wantCreds, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("expected Vary: Origin, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/logging"
+	"net/http"
+)
+
+// Writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Answers a rejected request. Parameter errors name the offending parameter
+func badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	var pe *paramError
+	if errors.As(err, &pe) {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidParameter, pe.message,
+			map[string]any{"parameter": pe.param})
+		return
+	}
+	apierror.Write(w, r, http.StatusBadRequest, apierror.CodeBadRequest, err.Error(), nil)
+}
+
+// Logs an unexpected error and answers with a generic 500
+func serverError(w http.ResponseWriter, r *http.Request, msg string, err error, attrs ...any) {
+	logging.FromContext(r.Context()).Error(msg, append(attrs, "error", err)...)
+	apierror.Internal(w, r)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"mqtt-catalog/internal/export"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/internal/retention"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"time"
+)
+
+// Time a client has to accept each exported row before the export is aborted
+const exportWriteTimeout = 30 * time.Second
+
+// Streams every topic matching the listing filters as a CSV, NDJSON or
+// Parquet download. payload=omit leaves sample payloads out, the default
+// payload=base64 includes them base64-encoded
+func (h *Handler) ExportTopics(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListFilters(r)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	includeStale, err := parseBoolQuery(r, "include_stale")
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	if !includeStale {
+		opts.LiveAfter = retention.StaleCutoff(h.retention, time.Now())
+	}
+
+	format := export.Format(r.URL.Query().Get("format"))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !format.Valid() {
+		badRequest(w, r, invalidParam("format", "invalid format %q, expected csv, ndjson or parquet", format))
+		return
+	}
+
+	var withPayload bool
+	switch payload := r.URL.Query().Get("payload"); payload {
+	case "", "base64":
+		withPayload = true
+	case "omit":
+	default:
+		badRequest(w, r, invalidParam("payload", "invalid payload %q, expected base64 or omit", payload))
+		return
+	}
+
+	filename := "topics-" + time.Now().UTC().Format("20060102T150405Z") + "." + string(format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	sent := &countingWriter{w: w}
+	buf := bufio.NewWriter(sent)
+	out, err := export.NewWriter(format, buf, withPayload)
+	if err != nil {
+		serverError(w, r, "Error starting export", err)
+		return
+	}
+
+	// The server write timeout suits API responses, not downloads of the
+	// whole catalog, so the deadline moves with every row instead
+	rc := http.NewResponseController(w)
+	rows := 0
+	err = h.repo.Each(opts, func(t models.Topic) error {
+		rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		rows++
+		return out.Write(t)
+	})
+	if err == nil {
+		err = out.Close()
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	if sent.n == 0 {
+		w.Header().Del("Content-Disposition")
+		serverError(w, r, "Error exporting topics", err)
+		return
+	}
+	// The status is already sent; aborting the response keeps a client
+	// from mistaking a partial file for a complete export
+	logging.FromContext(r.Context()).Error("Export failed", "format", format, "rows", rows, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// Counts the bytes passed on to the client
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
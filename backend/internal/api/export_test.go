@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportTopics(t *testing.T) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	seedContractTopics(t, repo)
+
+	retention := config.RetentionConfig{Default: config.RetentionPolicy{StaleAfterDays: 7}}
+	router := NewRouter(db, repo, &config.ServerConfig{Retention: retention}, nil)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		w := get("/api/v1/export?sort=topic&order=asc")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Header().Get("Content-Disposition"), `.csv"`) {
+			t.Errorf("Content-Disposition = %q", w.Header().Get("Content-Disposition"))
+		}
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		// The stale legacy/sensor topic is hidden by default like in listings
+		if len(records) != 3 || records[1][2] != "plant1/line1/temperature" || records[2][10] != "cnVubmluZw==" {
+			t.Errorf("unexpected records %q", records)
+		}
+	})
+
+	t.Run("ndjson without payloads", func(t *testing.T) {
+		w := get("/api/v1/export?format=ndjson&payload=omit&include_stale=true&broker_id=broker2")
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if w.Code != http.StatusOK || len(lines) != 1 {
+			t.Fatalf("got %d with %d lines: %s", w.Code, len(lines), w.Body.String())
+		}
+		if !strings.Contains(lines[0], `"topic":"legacy/sensor"`) || strings.Contains(lines[0], "sample_payload") {
+			t.Errorf("unexpected line %s", lines[0])
+		}
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		w := get("/api/v1/export?format=parquet&include_stale=true")
+		data := w.Body.Bytes()
+		file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("invalid Parquet file: %v", err)
+		}
+		if file.NumRows() != 3 {
+			t.Errorf("got %d rows, want 3", file.NumRows())
+		}
+	})
+
+	for _, target := range []string{
+		"/api/v1/export?format=xlsx",
+		"/api/v1/export?payload=raw",
+		"/api/v1/export?sort=nope",
+	} {
+		if w := get(target); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/retention"
+	"net/http"
+	"time"
+)
+
+// Checks every catalogued topic against the naming rules in
+// GOVERNANCE_CONFIG and pages the violations, ordered by topic. Stale
+// topics are skipped unless include_stale=true
+func (h *Handler) GetGovernanceViolations(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	severity := r.URL.Query().Get("severity")
+	switch severity {
+	case "", config.SeverityError, config.SeverityWarning:
+	default:
+		badRequest(w, r, invalidParam("severity", "invalid severity %q, expected error or warning", severity))
+		return
+	}
+
+	includeStale, err := parseBoolQuery(r, "include_stale")
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	opts, err := parseListFilters(r)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	if !includeStale {
+		opts.LiveAfter = retention.StaleCutoff(h.retention, time.Now())
+	}
+
+	report, err := h.linter.Lint(h.repo, opts)
+	if err != nil {
+		serverError(w, r, "Error checking topic governance", err)
+		return
+	}
+
+	violations := report.Violations
+	if severity != "" {
+		violations = violations[:0]
+		for _, v := range report.Violations {
+			if v.Severity == severity {
+				violations = append(violations, v)
+			}
+		}
+		// Totals describe the filtered result, not the whole check
+		report.Total = len(violations)
+		if severity == config.SeverityError {
+			report.Warnings = 0
+		} else {
+			report.Errors = 0
+		}
+	}
+
+	report.Violations = page(violations, limit, offset)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Returns the slice of items for one page
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetGovernanceViolations(t *testing.T) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	seedContractTopics(t, repo)
+
+	cfg := &config.ServerConfig{
+		Retention: config.RetentionConfig{Default: config.RetentionPolicy{StaleAfterDays: 7}},
+		Governance: config.GovernanceConfig{Rules: []config.GovernanceRule{
+			{Name: "structure", Severity: config.SeverityError, MinDepth: 3},
+			{Name: "legacy", Severity: config.SeverityWarning, ReservedPrefixes: []string{"legacy/"}},
+		}},
+	}
+	router := NewRouter(db, repo, cfg, nil)
+
+	get := func(target string) (int, models.GovernanceReport) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var report models.GovernanceReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	// The stale legacy/sensor topic is skipped by default
+	if code, report := get("/api/v1/governance/violations"); code != http.StatusOK || report.TopicsChecked != 2 || report.Total != 0 {
+		t.Errorf("live topics = %d %+v", code, report)
+	}
+
+	code, report := get("/api/v1/governance/violations?include_stale=true")
+	if code != http.StatusOK || report.Errors != 1 || report.Warnings != 1 || len(report.Violations) != 2 {
+		t.Fatalf("all topics = %d %+v", code, report)
+	}
+
+	_, report = get("/api/v1/governance/violations?include_stale=true&severity=warning")
+	if report.Total != 1 || report.Warnings != 1 || report.Errors != 0 || report.Violations[0].Rule != "legacy" {
+		t.Errorf("warnings = %+v", report)
+	}
+
+	_, report = get("/api/v1/governance/violations?include_stale=true&severity=error")
+	if report.Total != 1 || report.Errors != 1 || report.Warnings != 0 || report.Violations[0].Rule != "structure" {
+		t.Errorf("errors = %+v", report)
+	}
+
+	_, report = get("/api/v1/governance/violations?include_stale=true&limit=1&offset=1")
+	if report.Total != 2 || len(report.Violations) != 1 || report.Violations[0].Rule != "legacy" {
+		t.Errorf("second page = %+v", report)
+	}
+
+	for _, target := range []string{
+		"/api/v1/governance/violations?severity=fatal",
+		"/api/v1/governance/violations?limit=0",
+		"/api/v1/governance/violations?include_stale=maybe",
+	} {
+		if code, _ := get(target); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, code)
+		}
+	}
+}
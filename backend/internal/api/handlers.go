@@ -1,73 +1,212 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/governance"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/payload"
 	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/retention"
+	"mqtt-catalog/internal/tail"
 	"mqtt-catalog/pkg/models"
 	"net/http"
-	"strconv"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type Handler struct {
-	repo *repository.TopicRepository
+	repo        *repository.TopicRepository
+	annotations *repository.AnnotationRepository
+	webhooks    *repository.WebhookRepository
+	leases      *repository.LeaseRepository
+	db          *sql.DB
+	retention   config.RetentionConfig
+	limits      config.LimitsConfig
+	stream      config.StreamConfig
+	drift       *driftInterest
+	tailer      *tail.Tailer
+	linter      *governance.Linter
+	upgrader    websocket.Upgrader
 }
 
 func NewHandler(repo *repository.TopicRepository) *Handler {
 	return &Handler{repo: repo}
 }
 
+// Names of payload detectors reported in sample flags
+var flagPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Stores a sample and returns the resulting topic: 201 when the topic is new,
+// 200 when an existing topic got a fresh sample
 func (h *Handler) CreateSample(w http.ResponseWriter, r *http.Request) {
 	var sample models.Sample
 	if err := json.NewDecoder(r.Body).Decode(&sample); err != nil {
-		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+			return
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, fmt.Sprintf("invalid request body: %v", err), nil)
 		return
 	}
 
-	if sample.BrokerID == "" || sample.Topic == "" {
-		http.Error(w, "broker_id and topic are required", http.StatusBadRequest)
+	var missing []string
+	if sample.BrokerID == "" {
+		missing = append(missing, "broker_id")
+	}
+	if sample.Topic == "" {
+		missing = append(missing, "topic")
+	}
+	if len(missing) > 0 {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, "broker_id and topic are required",
+			map[string]any{"missing": missing})
 		return
 	}
 
-	if err := h.repo.Upsert(sample); err != nil {
-		log.Printf("Error upserting sample: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	for _, flag := range sample.Flags {
+		if !flagPattern.MatchString(flag) {
+			apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody,
+				fmt.Sprintf("invalid flag %q, expected lowercase letters, digits and underscores", flag), nil)
+			return
+		}
+	}
+
+	// Only the server truncates, a client cannot mark its sample as cut
+	sample.Truncated = false
+	if limit := h.limits.MaxSampleBytes; limit > 0 && len(sample.Payload) > limit {
+		if !h.limits.TruncateSamples {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge,
+				fmt.Sprintf("sample payload exceeds %d bytes", limit), map[string]any{"max_sample_bytes": limit})
+			return
+		}
+		sample.Payload = payload.Truncate(sample.Payload, sample.PayloadType, limit)
+		sample.Truncated = true
+		metrics.SamplesTruncated.Inc()
+	}
+
+	topic, created, err := h.repo.Save(sample)
+	if err != nil {
+		serverError(w, r, "Error upserting sample", err,
+			"broker_id", sample.BrokerID,
+			"topic", sample.Topic,
+			"payload_type", sample.PayloadType,
+		)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, models.SampleResult{
+		ID:        topic.ID,
+		BrokerID:  topic.BrokerID,
+		Topic:     topic.Topic,
+		CreatedAt: topic.CreatedAt,
+		LastSeen:  topic.LastSeen,
+		Truncated: topic.Truncated,
+	})
 }
 
+// Lists topics filtered by broker, payload type, topic prefix, time ranges and
+// payload size, sorted by any of the supported fields. Pages continue with
+// offset or with the opaque next_cursor of the previous page. Stale topics
+// are hidden unless include_stale=true
 func (h *Handler) GetTopics(w http.ResponseWriter, r *http.Request) {
-	limit := parseIntQuery(r, "limit", 100)
-	offset := parseIntQuery(r, "offset", 0)
-	brokerID := r.URL.Query().Get("broker_id")
+	h.listTopics(w, r, false)
+}
 
-	var topics []models.Topic
-	var total int
-	var err error
+// Lists topics whose latest sample the collector flagged as containing
+// likely PII or secrets, with the same filters as GetTopics
+func (h *Handler) GetFlaggedTopics(w http.ResponseWriter, r *http.Request) {
+	h.listTopics(w, r, true)
+}
 
-	if brokerID != "" {
-		topics, total, err = h.repo.GetByBroker(brokerID, limit, offset)
-	} else {
-		topics, total, err = h.repo.GetAll(limit, offset)
+func (h *Handler) listTopics(w http.ResponseWriter, r *http.Request, flagged bool) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		badRequest(w, r, err)
+		return
 	}
+	opts.Flagged = flagged
 
+	includeStale, err := parseBoolQuery(r, "include_stale")
 	if err != nil {
-		log.Printf("Error getting topics: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		badRequest(w, r, err)
+		return
+	}
+	if !includeStale {
+		opts.LiveAfter = retention.StaleCutoff(h.retention, time.Now())
+	}
+
+	page, err := h.repo.List(opts)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		badRequest(w, r, invalidParam("cursor", "%v", err))
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Error getting topics", err)
+		return
+	}
+	if err := h.annotate(page.Topics); err != nil {
+		serverError(w, r, "Error getting topic annotations", err)
 		return
 	}
 
 	response := models.TopicListResponse{
-		Topics: topics,
+		Topics:         page.Topics,
+		Total:          page.Total,
+		TotalEstimated: page.TotalEstimated,
+	}
+	if page.NextCursor != nil {
+		response.NextCursor = page.NextCursor.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Reports topics that stopped publishing longer ago than their broker's stale
+// threshold, oldest first, with the date they will be purged
+func (h *Handler) GetStaleTopics(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	topics, total, err := h.repo.GetStale(retention.StaleCutoff(h.retention, time.Now()), limit, offset)
+	if err != nil {
+		serverError(w, r, "Error getting stale topics", err)
+		return
+	}
+
+	report := models.StaleTopicReport{
+		Topics: make([]models.StaleTopic, 0, len(topics)),
 		Total:  total,
 	}
+	for _, t := range topics {
+		policy := h.retention.PolicyFor(t.BrokerID)
+		stale := models.StaleTopic{
+			Topic:      t,
+			StaleSince: t.LastSeen.AddDate(0, 0, policy.StaleAfterDays),
+		}
+		if policy.PurgeAfterDays > 0 {
+			purgeAt := t.LastSeen.AddDate(0, 0, policy.PurgeAfterDays)
+			stale.PurgeAt = &purgeAt
+		}
+		report.Topics = append(report.Topics, stale)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, report)
 }
 
 func (h *Handler) GetTopic(w http.ResponseWriter, r *http.Request) {
@@ -75,41 +214,173 @@ func (h *Handler) GetTopic(w http.ResponseWriter, r *http.Request) {
 	topic := r.URL.Query().Get("topic")
 
 	if brokerID == "" || topic == "" {
-		http.Error(w, "broker_id and topic are required", http.StatusBadRequest)
+		param := "broker_id"
+		if brokerID != "" {
+			param = "topic"
+		}
+		badRequest(w, r, invalidParam(param, "broker_id and topic are required"))
 		return
 	}
 
 	t, err := h.repo.GetByBrokerAndTopic(brokerID, topic)
 	if err != nil {
-		log.Printf("Error getting topic: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		serverError(w, r, "Error getting topic", err, "broker_id", brokerID, "topic", topic)
 		return
 	}
 
 	if t == nil {
-		http.Error(w, "topic not found", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "topic not found",
+			map[string]any{"broker_id": brokerID, "topic": topic})
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(t)
+	topics := []models.Topic{*t}
+	if err := h.annotate(topics); err != nil {
+		serverError(w, r, "Error getting topic annotations", err, "broker_id", brokerID, "topic", topic)
+		return
+	}
+	t = &topics[0]
+
+	writeJSON(w, http.StatusOK, t)
 }
 
-func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+// Searches topics with an MQTT filter (default), substring or regex given in q,
+// optionally limited to a set of brokers. Requests without q keep the exact
+// broker_id+topic lookup
+func (h *Handler) SearchTopics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		h.GetTopic(w, r)
+		return
+	}
+
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	mode := repository.MatchMode(r.URL.Query().Get("mode"))
+	switch mode {
+	case "", repository.MatchFilter, repository.MatchSubstring, repository.MatchRegex:
+	default:
+		badRequest(w, r, invalidParam("mode", "invalid mode %q, expected filter, substring or regex", mode))
+		return
+	}
+
+	params := repository.SearchParams{
+		Query:     query,
+		Mode:      mode,
+		BrokerIDs: parseListQuery(r, "broker_id"),
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	topics, total, err := h.repo.Search(params)
+	if errors.Is(err, repository.ErrInvalidFilter) {
+		badRequest(w, r, invalidParam("q", "%v", err))
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Error searching topics", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.TopicListResponse{
+		Topics: topics,
+		Total:  total,
+	})
 }
 
-func parseIntQuery(r *http.Request, key string, defaultValue int) int {
-	val := r.URL.Query().Get(key)
-	if val == "" {
-		return defaultValue
+// Ranks topics whose sample payload (or name) contains the words in q and
+// returns highlighted snippets of the matches
+func (h *Handler) SearchPayloads(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		badRequest(w, r, invalidParam("q", "q is required"))
+		return
+	}
+
+	limit, offset, err := parsePageQuery(r, 20)
+	if err != nil {
+		badRequest(w, r, err)
+		return
 	}
 
-	parsed, err := strconv.Atoi(val)
+	results, total, err := h.repo.FullTextSearch(query, limit, offset)
 	if err != nil {
-		return defaultValue
+		serverError(w, r, "Error searching payloads", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.SearchResponse{
+		Results: results,
+		Total:   total,
+	})
+}
+
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+}
+
+// Reports that the process is up and serving requests, without touching dependencies
+func (h *Handler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// Reports whether the server can handle traffic: the database answers a ping and
+// its schema is at the version this binary expects. Includes connection pool stats
+func (h *Handler) Readiness(w http.ResponseWriter, r *http.Request) {
+	response := models.ReadinessResponse{
+		Status: models.StatusReady,
+		Checks: map[string]models.HealthCheck{},
+	}
+
+	fail := func(name string, err error) {
+		response.Status = models.StatusNotReady
+		response.Checks[name] = models.HealthCheck{Status: models.CheckFail, Error: err.Error()}
+	}
+
+	if h.db == nil {
+		fail("database", errors.New("database not configured"))
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := h.db.PingContext(ctx); err != nil {
+			fail("database", err)
+		} else {
+			response.Checks["database"] = models.HealthCheck{Status: models.CheckPass}
+		}
+
+		current, err := database.CurrentVersion(h.db)
+		switch {
+		case err != nil:
+			fail("migrations", err)
+		case current != database.LatestVersion():
+			fail("migrations", fmt.Errorf("schema version %d, expected %d", current, database.LatestVersion()))
+		default:
+			response.Checks["migrations"] = models.HealthCheck{
+				Status: models.CheckPass,
+				Detail: fmt.Sprintf("schema version %d", current),
+			}
+		}
+
+		stats := h.db.Stats()
+		response.Pool = &models.PoolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		}
+	}
+
+	status := http.StatusOK
+	if response.Status != models.StatusReady {
+		status = http.StatusServiceUnavailable
 	}
 
-	return parsed
+	writeJSON(w, status, response)
 }
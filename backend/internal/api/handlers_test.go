@@ -4,19 +4,20 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"mqtt-catalog/internal/config"
 	"mqtt-catalog/internal/database"
 	"mqtt-catalog/internal/repository"
 	"mqtt-catalog/pkg/models"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
+	db, err := sql.Open(database.SQLiteDriver, ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
@@ -53,6 +54,26 @@ func TestHandler_Createsample(t *testing.T) {
 	if w.Code != http.StatusCreated {
 		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
 	}
+
+	var created models.SampleResult
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ID == 0 || created.Topic != "test/topic" || created.CreatedAt.IsZero() {
+		t.Errorf("expected stored topic in response, got %+v", created)
+	}
+	if strings.Contains(w.Body.String(), "payload") {
+		t.Errorf("expected the payload to be left out of the response, got %s", w.Body)
+	}
+
+	// A fresh sample for a known topic updates it
+	req = httptest.NewRequest(http.MethodPost, "/api/samples", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	handler.CreateSample(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
 }
 
 func TestHandler_CreateSample_InvalidJSON(t *testing.T) {
@@ -263,3 +284,366 @@ func TestHandler_HealthCheck(t *testing.T) {
 		t.Errorf("expected status 'healthy', got '%s'", response["status"])
 	}
 }
+
+func TestHandler_SearchTopics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	for _, topic := range []string{"plant1/l1/temperature", "plant1/l2/temperature", "plant1/l1/humidity"} {
+		repo.Upsert(models.Sample{
+			BrokerID:    "test-broker",
+			Topic:       topic,
+			PayloadType: models.PayloadJSON,
+			Payload:     []byte(`{}`),
+			Timestamp:   time.Now(),
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics/search?q=plant1/%2B/temperature&broker_id=test-broker,other", nil)
+	w := httptest.NewRecorder()
+
+	handler.SearchTopics(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.TopicListResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Total != 2 {
+		t.Errorf("expected total 2, got %d", response.Total)
+	}
+}
+
+func TestHandler_SearchTopics_InvalidFilter(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics/search?q=a/%23/b", nil)
+	w := httptest.NewRecorder()
+
+	handler.SearchTopics(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_SearchPayloads(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	repo.Upsert(models.Sample{
+		BrokerID:    "test-broker",
+		Topic:       "test/topic",
+		PayloadType: models.PayloadJSON,
+		Payload:     []byte(`{"serial": "SN-4711"}`),
+		Timestamp:   time.Now(),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=SN-4711", nil)
+	w := httptest.NewRecorder()
+
+	handler.SearchPayloads(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response models.SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if response.Total != 1 || response.Results[0].Topic.Topic != "test/topic" {
+		t.Errorf("unexpected search response: %+v", response)
+	}
+}
+
+func TestHandler_SearchPayloads_MissingQuery(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewHandler(repository.NewTopicRepository(db))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	w := httptest.NewRecorder()
+
+	handler.SearchPayloads(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_GetTopics_Filters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	repo.Upsert(models.Sample{BrokerID: "broker1", Topic: "a/1", PayloadType: models.PayloadJSON, Payload: []byte(`{}`), Timestamp: time.Now()})
+	repo.Upsert(models.Sample{BrokerID: "broker2", Topic: "a/2", PayloadType: models.PayloadText, Payload: []byte(`hi`), Timestamp: time.Now()})
+	repo.Upsert(models.Sample{BrokerID: "broker3", Topic: "b/3", PayloadType: models.PayloadJSON, Payload: []byte(`{}`), Timestamp: time.Now()})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics?broker_id=broker1&broker_id=broker2&prefix=a/&payload_type=json,text&sort=topic&order=asc", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetTopics(w, req)
+
+	var response models.TopicListResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if response.Total != 2 || response.Topics[0].Topic != "a/1" {
+		t.Errorf("unexpected response: %+v", response)
+	}
+}
+
+func TestHandler_GetTopics_InvalidFilters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewHandler(repository.NewTopicRepository(db))
+
+	queries := []string{
+		"sort=payload",
+		"order=sideways",
+		"payload_type=yaml",
+		"last_seen_after=yesterday",
+		"min_size=-1",
+		"min_size=10&max_size=5",
+	}
+
+	for _, q := range queries {
+		req := httptest.NewRequest(http.MethodGet, "/api/topics?"+q, nil)
+		w := httptest.NewRecorder()
+
+		handler.GetTopics(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", q, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestHandler_GetTopics_Cursor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	for _, topic := range []string{"a", "b", "c"} {
+		repo.Upsert(models.Sample{BrokerID: "broker1", Topic: topic, PayloadType: models.PayloadText, Payload: []byte(`x`), Timestamp: time.Now()})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics?limit=2&sort=topic&order=asc", nil)
+	w := httptest.NewRecorder()
+	handler.GetTopics(w, req)
+
+	var first models.TopicListResponse
+	json.NewDecoder(w.Body).Decode(&first)
+
+	if first.NextCursor == "" || first.Total != 3 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/topics?limit=2&sort=topic&order=asc&cursor="+first.NextCursor, nil)
+	w = httptest.NewRecorder()
+	handler.GetTopics(w, req)
+
+	var second models.TopicListResponse
+	json.NewDecoder(w.Body).Decode(&second)
+
+	if len(second.Topics) != 1 || second.Topics[0].Topic != "c" {
+		t.Errorf("unexpected second page: %+v", second)
+	}
+	if second.NextCursor != "" || second.Total != -1 {
+		t.Errorf("expected last page without count, got %+v", second)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/topics?cursor="+first.NextCursor, nil)
+	w = httptest.NewRecorder()
+	handler.GetTopics(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for cursor with different sort, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_StaleTopics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+	handler.retention = config.RetentionConfig{
+		Default: config.RetentionPolicy{StaleAfterDays: 7, PurgeAfterDays: 30},
+	}
+
+	repo.Upsert(models.Sample{BrokerID: "broker1", Topic: "live", PayloadType: models.PayloadText, Payload: []byte("x"), Timestamp: time.Now()})
+	repo.Upsert(models.Sample{BrokerID: "broker1", Topic: "gone", PayloadType: models.PayloadText, Payload: []byte("x"), Timestamp: time.Now().AddDate(0, 0, -10)})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	w := httptest.NewRecorder()
+	handler.GetTopics(w, req)
+
+	var listing models.TopicListResponse
+	json.NewDecoder(w.Body).Decode(&listing)
+
+	if listing.Total != 1 || listing.Topics[0].Topic != "live" {
+		t.Errorf("expected only the live topic, got %+v", listing)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/topics?include_stale=true", nil)
+	w = httptest.NewRecorder()
+	handler.GetTopics(w, req)
+
+	json.NewDecoder(w.Body).Decode(&listing)
+	if listing.Total != 2 {
+		t.Errorf("expected 2 topics with include_stale, got %d", listing.Total)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/topics/stale", nil)
+	w = httptest.NewRecorder()
+	handler.GetStaleTopics(w, req)
+
+	var report models.StaleTopicReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if report.Total != 1 || report.Topics[0].Topic.Topic != "gone" || report.Topics[0].PurgeAt == nil {
+		t.Errorf("unexpected stale report: %+v", report)
+	}
+}
+
+func TestHandler_FlaggedTopics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := repository.NewTopicRepository(db)
+	handler := NewHandler(repo)
+
+	for _, body := range []string{
+		`{"broker_id": "broker1", "topic": "crm/contact", "payload_type": "json", "payload": "e30=", "timestamp": "2026-01-01T00:00:00Z", "flags": ["email", "phone"], "redacted": true}`,
+		`{"broker_id": "broker1", "topic": "svc/config", "payload_type": "json", "payload": "e30=", "timestamp": "2026-01-01T00:00:00Z", "flags": ["credential"]}`,
+		`{"broker_id": "broker1", "topic": "plant/temperature", "payload_type": "json", "payload": "e30=", "timestamp": "2026-01-01T00:00:00Z"}`,
+	} {
+		w := httptest.NewRecorder()
+		handler.CreateSample(w, httptest.NewRequest(http.MethodPost, "/api/v1/samples", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("CreateSample() status = %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{"all flagged", "/api/v1/topics/flagged?sort=topic&order=asc", []string{"crm/contact", "svc/config"}},
+		{"by flag", "/api/v1/topics/flagged?flag=phone", []string{"crm/contact"}},
+		{"unknown flag", "/api/v1/topics/flagged?flag=gps", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.GetFlaggedTopics(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			var response models.TopicListResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var got []string
+			for _, topic := range response.Topics {
+				got = append(got, topic.Topic)
+			}
+			if !slices.Equal(got, tt.want) || response.Total != len(tt.want) {
+				t.Errorf("GetFlaggedTopics() = %v (total %d), want %v", got, response.Total, tt.want)
+			}
+		})
+	}
+
+	topic, _ := repo.GetByBrokerAndTopic("broker1", "crm/contact")
+	if !slices.Equal(topic.Flags, []string{"email", "phone"}) || !topic.Redacted {
+		t.Errorf("stored topic flags = %v (redacted %v)", topic.Flags, topic.Redacted)
+	}
+
+	w := httptest.NewRecorder()
+	handler.CreateSample(w, httptest.NewRequest(http.MethodPost, "/api/v1/samples",
+		strings.NewReader(`{"broker_id": "broker1", "topic": "t", "flags": ["Email Address"]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("CreateSample() with an invalid flag status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandler_Readiness(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewHandler(repository.NewTopicRepository(db))
+	handler.db = db
+
+	req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	w := httptest.NewRecorder()
+	handler.Readiness(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response models.ReadinessResponse
+	json.NewDecoder(w.Body).Decode(&response)
+
+	if response.Checks["database"].Status != models.CheckPass ||
+		response.Checks["migrations"].Status != models.CheckPass ||
+		response.Pool == nil {
+		t.Errorf("unexpected readiness response: %+v", response)
+	}
+
+	// Pending migrations make the server unready
+	db.Exec("DELETE FROM schema_migrations WHERE version = ?", database.LatestVersion())
+
+	w = httptest.NewRecorder()
+	handler.Readiness(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d with pending migrations, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	db.Close()
+
+	w = httptest.NewRecorder()
+	handler.Readiness(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d with closed database, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestHandler_Liveness(t *testing.T) {
+	handler := NewHandler(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/health/live", nil)
+	w := httptest.NewRecorder()
+	handler.Liveness(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
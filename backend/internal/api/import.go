@@ -0,0 +1,50 @@
+package api
+
+import (
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/importer"
+	"net/http"
+)
+
+// Merges an NDJSON export into the catalog. strategy picks the winner for
+// existing topics, broker_prefix remaps broker IDs and dry_run=true only
+// reports the inserts, updates and conflicts the import would cause
+func (h *Handler) ImportTopics(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	strategy := importer.Strategy(q.Get("strategy"))
+	if strategy == "" {
+		strategy = importer.StrategyNewest
+	}
+	if !strategy.Valid() {
+		badRequest(w, r, invalidParam("strategy", "invalid strategy %q, expected newest, keep or overwrite", strategy))
+		return
+	}
+
+	dryRun, err := parseBoolQuery(r, "dry_run")
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	opts := importer.Options{
+		Strategy:        strategy,
+		BrokerPrefix:    q.Get("broker_prefix"),
+		DryRun:          dryRun,
+		MaxSampleBytes:  h.limits.MaxSampleBytes,
+		TruncateSamples: h.limits.TruncateSamples,
+	}
+
+	report, err := importer.Import(r.Body, h.repo, opts)
+	if isBodyTooLarge(err) {
+		// Nothing is written until the whole body was read
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Error importing topics", err, "strategy", strategy, "dry_run", dryRun)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
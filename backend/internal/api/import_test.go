@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportTopics(t *testing.T) {
+	sourceDB := setupTestDB(t)
+	t.Cleanup(func() { sourceDB.Close() })
+	source := repository.NewTopicRepository(sourceDB)
+	seedContractTopics(t, source)
+	sourceRouter := NewRouter(sourceDB, source, &config.ServerConfig{}, nil)
+
+	w := httptest.NewRecorder()
+	sourceRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/export?format=ndjson&include_stale=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export failed with %d", w.Code)
+	}
+	export := w.Body.String()
+
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	router := NewRouter(db, repo, &config.ServerConfig{Limits: config.LimitsConfig{
+		RouteMaxBodyBytes: map[string]int64{"POST /api/v1/import": 64},
+	}}, nil)
+
+	post := func(target, body string) (*httptest.ResponseRecorder, models.ImportReport) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		var report models.ImportReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w, report
+	}
+
+	// The per-route body limit applies to imports as well
+	if w, _ := post("/api/v1/import", export); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized import = %d, want 413", w.Code)
+	}
+	// Nothing before the limit was stored
+	if topics, total, _ := repo.GetAll(10, 0); total != 0 {
+		t.Errorf("oversized import stored %v", topics)
+	}
+
+	router = NewRouter(db, repo, &config.ServerConfig{}, nil)
+
+	w, report := post("/api/v1/import?dry_run=true", export)
+	if w.Code != http.StatusOK || !report.DryRun || report.Inserted != 3 {
+		t.Fatalf("dry run = %d %s", w.Code, w.Body.String())
+	}
+	if _, count, _ := repo.GetAll(10, 0); count != 0 {
+		t.Errorf("dry run stored %d topics", count)
+	}
+
+	w, report = post("/api/v1/import?broker_prefix=copy-", export)
+	if w.Code != http.StatusOK || report.Inserted != 3 || report.Failed != 0 {
+		t.Fatalf("import = %d %s", w.Code, w.Body.String())
+	}
+
+	original, _ := source.GetByBrokerAndTopic("broker1", "plant1/line1/temperature")
+	imported, err := repo.GetByBrokerAndTopic("copy-broker1", "plant1/line1/temperature")
+	if err != nil || imported == nil {
+		t.Fatalf("imported topic not found: %v", err)
+	}
+	if string(imported.SamplePayload) != string(original.SamplePayload) ||
+		!imported.LastSeen.Equal(original.LastSeen) || !imported.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("imported %+v, want %+v", imported, original)
+	}
+
+	// Re-importing the same export changes nothing under the default strategy
+	_, report = post("/api/v1/import?broker_prefix=copy-", export)
+	if report.Inserted != 0 || report.Updated != 0 || report.Skipped != 3 {
+		t.Errorf("re-import = %+v", report)
+	}
+
+	// Without payloads only last_seen is merged, the stored samples stay
+	w = httptest.NewRecorder()
+	sourceRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/export?format=ndjson&payload=omit&include_stale=true", nil))
+	omitted := strings.ReplaceAll(w.Body.String(), `"broker_id":"`, `"broker_id":"copy-`)
+	before, _ := repo.GetByBrokerAndTopic("copy-broker1", "plant1/line1/temperature")
+	for _, target := range []string{"/api/v1/import?strategy=overwrite&dry_run=true", "/api/v1/import?strategy=overwrite"} {
+		w, report = post(target, omitted)
+		if w.Code != http.StatusOK || report.Updated != 3 || report.Conflicts != 0 || report.Failed != 0 {
+			t.Errorf("POST %s without payloads = %d %s", target, w.Code, w.Body.String())
+		}
+	}
+	after, _ := repo.GetByBrokerAndTopic("copy-broker1", "plant1/line1/temperature")
+	if string(after.SamplePayload) != string(before.SamplePayload) || after.PayloadType != before.PayloadType {
+		t.Errorf("import without payloads replaced the sample: %+v, was %+v", after, before)
+	}
+	// New topics cannot be created without a sample
+	_, report = post("/api/v1/import?broker_prefix=other-", omitted)
+	if report.Inserted != 0 || report.Failed != 3 || len(report.Errors) != 3 {
+		t.Errorf("new topics without payloads = %+v", report)
+	}
+
+	for _, target := range []string{
+		"/api/v1/import?strategy=merge",
+		"/api/v1/import?dry_run=maybe",
+	} {
+		if w, _ := post(target, export); w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestImportTopics_KeepsFlags(t *testing.T) {
+	sourceDB := setupTestDB(t)
+	t.Cleanup(func() { sourceDB.Close() })
+	source := repository.NewTopicRepository(sourceDB)
+	flagged := models.Sample{
+		BrokerID: "broker1", Topic: "crm/contacts", PayloadType: models.PayloadJSON,
+		Payload: []byte(`{"email": "[REDACTED]"}`), Timestamp: time.Now().UTC(),
+		Flags: []string{"email"}, Redacted: true,
+	}
+	if err := source.Upsert(flagged); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	NewRouter(sourceDB, source, &config.ServerConfig{}, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/export?format=ndjson", nil))
+
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	imported := httptest.NewRecorder()
+	NewRouter(db, repo, &config.ServerConfig{}, nil).ServeHTTP(imported, httptest.NewRequest(http.MethodPost, "/api/v1/import", strings.NewReader(w.Body.String())))
+	if imported.Code != http.StatusOK {
+		t.Fatalf("import = %d %s", imported.Code, imported.Body.String())
+	}
+
+	topic, err := repo.GetByBrokerAndTopic("broker1", "crm/contacts")
+	if err != nil || topic == nil {
+		t.Fatalf("imported topic not found: %v", err)
+	}
+	if strings.Join(topic.Flags, ",") != "email" || !topic.Redacted {
+		t.Errorf("imported flags = %v, redacted = %v", topic.Flags, topic.Redacted)
+	}
+}
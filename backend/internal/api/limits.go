@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/metrics"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Idle buckets are dropped after this long so memory stays bounded
+	bucketIdleTimeout = 10 * time.Minute
+	// A full bucket map drops its least recently used bucket for a new one
+	maxBuckets = 10000
+)
+
+// Caps the request body of a route; reads past the limit fail with
+// *http.MaxBytesError, which handlers answer with 413
+func limitBody(route string, limit int64, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			metrics.HTTPRequestsRejected.WithLabelValues(route, "body_too_large").Inc()
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge,
+				"request body too large", map[string]any{"max_body_bytes": limit})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reports whether a body read failed because the size limit was exceeded
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Token-bucket rate limiter keyed by client identity
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// Returns nil when rate limiting is disabled
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    cfg.RequestsPerSecond,
+		burst:   float64(cfg.Burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Takes a token for key, or reports how long until one is available
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, l.wait(b)
+}
+
+// Reports how long until key has a token, without taking it
+func (l *rateLimiter) peek(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b := l.bucket(key); b.tokens < 1 {
+		return l.wait(b)
+	}
+	return 0
+}
+
+// Takes a token for key, leaving the bucket empty rather than negative
+func (l *rateLimiter) take(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key)
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+// Returns the refilled bucket of key, creating a full one for a new key
+func (l *rateLimiter) bucket(key string) *tokenBucket {
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.evictOldest()
+		}
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	return b
+}
+
+func (l *rateLimiter) wait(b *tokenBucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, b := range l.buckets {
+		if oldestKey == "" || b.updated.Before(oldest) {
+			oldestKey, oldest = key, b.updated
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// Rejects requests over the client's rate with 429 and a Retry-After header
+func (l *rateLimiter) middleware(route string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(clientKey(r))
+		if !ok {
+			rateLimited(w, r, route, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Runs before authentication and limits the failed attempts of each client
+// IP: every 401 takes a token, and an IP without tokens gets 429 before its
+// credentials are checked. Verified callers never draw from it, so callers
+// sharing an address keep their own buckets
+func (l *rateLimiter) unverified(route string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "unverified:" + clientIP(r)
+		if wait := l.peek(key); wait > 0 {
+			rateLimited(w, r, route, wait)
+			return
+		}
+
+		rr := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rr, r)
+		if rr.status == http.StatusUnauthorized {
+			l.take(key)
+		}
+	})
+}
+
+func rateLimited(w http.ResponseWriter, r *http.Request, route string, wait time.Duration) {
+	metrics.HTTPRequestsRejected.WithLabelValues(route, "rate_limited").Inc()
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeRateLimited,
+		"rate limit exceeded", map[string]any{"retry_after_seconds": retryAfter})
+}
+
+// Identifies the caller by the principal authentication verified, falling
+// back to the client IP when authentication is disabled
+func clientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return "principal:" + p.Method + ":" + p.Subject
+	}
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
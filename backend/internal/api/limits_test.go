@@ -0,0 +1,242 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleBody(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	body, err := json.Marshal(models.Sample{
+		BrokerID:    "broker1",
+		Topic:       "sensors/big",
+		PayloadType: models.PayloadText,
+		Payload:     payload,
+		Timestamp:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestRouter_BodyLimit(t *testing.T) {
+	router := setupTestRouter(t, &config.ServerConfig{Limits: config.LimitsConfig{
+		MaxBodyBytes:      64,
+		RouteMaxBodyBytes: map[string]int64{"POST /api/samples": 1024},
+	}})
+
+	tests := []struct {
+		name       string
+		size       int
+		chunked    bool
+		wantStatus int
+	}{
+		{"within route limit", 100, false, http.StatusCreated},
+		{"over route limit", 2048, false, http.StatusRequestEntityTooLarge},
+		// Without Content-Length the limit is enforced while decoding
+		{"over route limit chunked", 2048, true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := sampleBody(t, bytes.Repeat([]byte("a"), tt.size))
+			var reader io.Reader = bytes.NewReader(body)
+			if tt.chunked {
+				reader = io.MultiReader(reader)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/samples", reader)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_CreateSample_MaxSampleSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		truncate      bool
+		wantStatus    int
+		wantPayload   string
+		wantTruncated bool
+	}{
+		{"truncate", strings.Repeat("x", 40), true, http.StatusCreated, strings.Repeat("x", 16), true},
+		{"truncate before a character", strings.Repeat("x", 15) + "äx", true, http.StatusCreated, strings.Repeat("x", 15), true},
+		{"reject", strings.Repeat("x", 40), false, http.StatusRequestEntityTooLarge, "", false},
+		{"fits", "small", true, http.StatusCreated, "small", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+
+			repo := repository.NewTopicRepository(db)
+			handler := NewHandler(repo)
+			handler.limits = config.LimitsConfig{MaxSampleBytes: 16, TruncateSamples: tt.truncate}
+
+			// The client's truncated flag is ignored
+			var sample map[string]any
+			json.Unmarshal(sampleBody(t, []byte(tt.payload)), &sample)
+			sample["truncated"] = true
+			body, _ := json.Marshal(sample)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/samples", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.CreateSample(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			topic, err := repo.GetByBrokerAndTopic("broker1", "sensors/big")
+			if err != nil {
+				t.Fatalf("GetByBrokerAndTopic failed: %v", err)
+			}
+			if !tt.truncate {
+				if topic != nil {
+					t.Error("expected rejected sample not to be stored")
+				}
+				return
+			}
+			if topic == nil || string(topic.SamplePayload) != tt.wantPayload || topic.Truncated != tt.wantTruncated {
+				t.Errorf("stored %+v, want payload %q truncated %v", topic, tt.wantPayload, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 2, Burst: 2})
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+
+	ok, wait := limiter.allow("a")
+	if ok {
+		t.Fatal("expected request over burst to be limited")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("expected wait of 500ms, got %v", wait)
+	}
+
+	// Buckets are independent per client
+	if ok, _ := limiter.allow("b"); !ok {
+		t.Error("expected other client to be allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Error("expected request to be allowed after refill")
+	}
+}
+
+func TestRouter_RateLimit(t *testing.T) {
+	router := setupTestRouter(t, &config.ServerConfig{Limits: config.LimitsConfig{
+		RateLimit: config.RateLimitConfig{RequestsPerSecond: 0.5, Burst: 1},
+	}})
+
+	request := func(router http.Handler, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(router, "/api/topics", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", w.Code)
+	}
+
+	w := request(router, "/api/topics", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+
+	// Without authentication a made-up key does not escape the client's bucket
+	if w := request(router, "/api/topics", "mqc_made_up"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected unverified key to be limited, got %d", w.Code)
+	}
+	if w := request(router, "/health", ""); w.Code != http.StatusOK {
+		t.Errorf("expected health check to pass, got %d", w.Code)
+	}
+
+	// Verified API keys get their own bucket
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	authn := auth.NewAPIKeyAuthenticator(auth.StaticKeyStore{
+		{Name: "a", SHA256: auth.HashAPIKey("mqc_a"), Scopes: []string{"read"}},
+		{Name: "b", SHA256: auth.HashAPIKey("mqc_b"), Scopes: []string{"read"}},
+	})
+	authRouter := NewRouter(db, repository.NewTopicRepository(db), &config.ServerConfig{Limits: config.LimitsConfig{
+		RateLimit: config.RateLimitConfig{RequestsPerSecond: 0.5, Burst: 1},
+	}}, authn)
+
+	for _, key := range []string{"mqc_a", "mqc_b"} {
+		if w := request(authRouter, "/api/topics", key); w.Code != http.StatusOK {
+			t.Errorf("expected first request of %s to pass, got %d", key, w.Code)
+		}
+	}
+	if w := request(authRouter, "/api/topics", "mqc_a"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected second request of mqc_a to be limited, got %d", w.Code)
+	}
+	// The verified requests above left the client IP's bucket for failed
+	// attempts full, so the first made-up key is checked and rejected
+	if w := request(authRouter, "/api/topics", "mqc_made_up"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected made-up key to be rejected, got %d", w.Code)
+	}
+
+	// Further attempts from that IP are limited before credentials are checked
+	for _, key := range []string{"mqc_other", "", "mqc_b"} {
+		w := request(authRouter, "/api/topics", key)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+			t.Errorf("expected request with key %q to be limited, got %d", key, w.Code)
+		}
+	}
+}
+
+func TestRateLimiter_MaxBuckets(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{RequestsPerSecond: 1, Burst: 1})
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+
+	for i := range maxBuckets + 10 {
+		now = now.Add(time.Millisecond)
+		limiter.allow(fmt.Sprintf("client-%d", i))
+	}
+	if len(limiter.buckets) != maxBuckets {
+		t.Errorf("len(buckets) = %d, want %d", len(limiter.buckets), maxBuckets)
+	}
+	if _, ok := limiter.buckets["client-0"]; ok {
+		t.Error("expected the least recently used bucket to be evicted")
+	}
+}
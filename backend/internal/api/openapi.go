@@ -0,0 +1,17 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI 3.1 description of the routes registered in NewRouter. Keep it in
+// sync with the handlers; TestOpenAPIContract checks real responses against it
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
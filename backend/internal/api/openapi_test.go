@@ -0,0 +1,490 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPISchema = map[string]any
+
+func loadOpenAPISpec(t *testing.T) openAPISchema {
+	t.Helper()
+	var spec openAPISchema
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if spec["openapi"] != "3.1.0" {
+		t.Fatalf("expected OpenAPI 3.1.0, got %v", spec["openapi"])
+	}
+	return spec
+}
+
+// Follows a local reference such as #/components/schemas/Topic
+func resolveRef(spec openAPISchema, ref string) (openAPISchema, error) {
+	node := any(spec)
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+		node = m[part]
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %s", ref)
+	}
+	return m, nil
+}
+
+func deref(spec, node openAPISchema) (openAPISchema, error) {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node, nil
+		}
+		var err error
+		if node, err = resolveRef(spec, ref); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func jsonType(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// Validates a decoded JSON value against the subset of JSON Schema used by
+// openapi.json: $ref, oneOf, type, enum, required, properties,
+// additionalProperties, items, minimum and the date-time format
+func validateSchema(spec, schema openAPISchema, value any, path string) []string {
+	schema, err := deref(spec, schema)
+	if err != nil {
+		return []string{path + ": " + err.Error()}
+	}
+
+	if variants, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, v := range variants {
+			if len(validateSchema(spec, v.(map[string]any), value, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s: matches %d oneOf variants, expected 1", path, matches)}
+		}
+		return nil
+	}
+
+	actual := jsonType(value)
+	if typ, ok := schema["type"]; ok {
+		var allowed []string
+		switch tv := typ.(type) {
+		case string:
+			allowed = []string{tv}
+		case []any:
+			for _, a := range tv {
+				allowed = append(allowed, a.(string))
+			}
+		}
+		if !slices.Contains(allowed, actual) && !(actual == "integer" && slices.Contains(allowed, "number")) {
+			return []string{fmt.Sprintf("%s: type %s, expected %v", path, actual, allowed)}
+		}
+	}
+
+	var errs []string
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+	}
+
+	if min, ok := schema["minimum"].(float64); ok {
+		if n, isNum := value.(float64); isNum && n < min {
+			errs = append(errs, fmt.Sprintf("%s: %v is below minimum %v", path, n, min))
+		}
+	}
+
+	if schema["format"] == "date-time" {
+		if s, isStr := value.(string); isStr {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a date-time", path, s))
+			}
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if _, present := val[r.(string)]; !present {
+					errs = append(errs, fmt.Sprintf("%s: missing required property %s", path, r))
+				}
+			}
+		}
+		for key, v := range val {
+			if prop, ok := props[key].(map[string]any); ok {
+				errs = append(errs, validateSchema(spec, prop, v, path+"."+key)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %s", path, key))
+				}
+			case map[string]any:
+				errs = append(errs, validateSchema(spec, extra, v, path+"."+key)...)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				errs = append(errs, validateSchema(spec, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Finds the documented response for an operation, e.g. ("/api/topics", "get", 200)
+// Returns the documented path template such as /api/v1/annotations/{id}
+// that a request path matches, or the path itself when none does
+func specPath(spec openAPISchema, path string) string {
+	paths := spec["paths"].(map[string]any)
+	if _, ok := paths[path]; ok {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	for template := range paths {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if part != segments[i] && !strings.HasPrefix(part, "{") {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return template
+		}
+	}
+	return path
+}
+
+func specResponse(spec openAPISchema, path, method string, status int) (openAPISchema, error) {
+	paths := spec["paths"].(map[string]any)
+	item, ok := paths[path].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("path %s is not documented", path)
+	}
+	op, ok := item[method].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not documented", strings.ToUpper(method), path)
+	}
+	responses := op["responses"].(map[string]any)
+	resp, ok := responses[strconv.Itoa(status)].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s does not document status %d", strings.ToUpper(method), path, status)
+	}
+	return deref(spec, resp)
+}
+
+func seedContractTopics(t *testing.T, repo *repository.TopicRepository) {
+	t.Helper()
+	samples := []models.Sample{
+		{BrokerID: "broker1", Topic: "plant1/line1/temperature", PayloadType: models.PayloadJSON, Payload: []byte(`{"temperature": 21.5}`), Timestamp: time.Now()},
+		{BrokerID: "broker1", Topic: "plant1/line2/status", PayloadType: models.PayloadText, Payload: []byte("running"), Timestamp: time.Now().Add(-time.Minute)},
+		{BrokerID: "broker2", Topic: "legacy/sensor", PayloadType: models.PayloadBinary, Payload: []byte{0x01, 0x02}, Timestamp: time.Now().AddDate(0, 0, -30)},
+	}
+	for _, s := range samples {
+		if err := repo.Upsert(s); err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+	}
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	seedContractTopics(t, repo)
+
+	retention := config.RetentionConfig{Default: config.RetentionPolicy{StaleAfterDays: 7, PurgeAfterDays: 90}}
+	governance := config.GovernanceConfig{Rules: []config.GovernanceRule{
+		{Name: "depth", Severity: config.SeverityError, MinDepth: 3},
+		{Name: "lowercase", Severity: config.SeverityWarning, AllowedChars: "a-z0-9_-"},
+	}}
+	router := NewRouter(db, repo, &config.ServerConfig{Retention: retention, Governance: governance}, nil)
+
+	authn := auth.NewAPIKeyAuthenticator(auth.StaticKeyStore{
+		{Name: "ui", SHA256: auth.HashAPIKey("mqc_read"), Scopes: []string{"read"}},
+	})
+	authRouter := NewRouter(db, repo, &config.ServerConfig{}, authn)
+
+	limitedRouter := NewRouter(db, repo, &config.ServerConfig{Limits: config.LimitsConfig{
+		MaxBodyBytes: 16,
+		RateLimit:    config.RateLimitConfig{RequestsPerSecond: 0.001, Burst: 1},
+	}}, nil)
+
+	validSample, _ := json.Marshal(models.Sample{
+		BrokerID: "broker3", Topic: "new/topic", PayloadType: models.PayloadText,
+		Payload: []byte("hello [REDACTED:email]"), Timestamp: time.Now(),
+		Flags: []string{"email"}, Redacted: true,
+	})
+
+	// An existing topic with a different sample, an invalid line and a new topic
+	importLines := []byte(`{"broker_id":"broker1","topic":"plant1/line2/status","payload_type":"text","sample_payload":"c3RvcHBlZA==","last_seen":"2026-01-01T00:00:00Z"}
+{"broker_id":"broker1"}
+{"broker_id":"broker9","topic":"imported","sample_payload":"e30=","last_seen":"2026-01-01T00:00:00Z"}
+`)
+
+	annotation := []byte(`{"broker_id": "broker1", "topic_filter": "plant1/+/temperature", "owner": "process-team",
+		"tags": ["sensor"], "classification": "internal", "links": ["https://wiki.example.com/plant1"]}`)
+	webhook := []byte(`{"url": "https://hooks.example.com/catalog", "events": ["topic.created", "topic.stale"],
+		"broker_id": "broker1", "topic_filter": "plant1/#"}`)
+
+	// The first page's cursor exercises keyset responses without a total
+	firstPage := httptest.NewRecorder()
+	router.ServeHTTP(firstPage, httptest.NewRequest(http.MethodGet, "/api/topics?limit=1&include_stale=true", nil))
+	var page models.TopicListResponse
+	json.Unmarshal(firstPage.Body.Bytes(), &page)
+
+	tests := []struct {
+		name       string
+		router     http.Handler
+		method     string
+		target     string
+		body       []byte
+		key        string
+		wantStatus int
+	}{
+		{"create annotation", router, "POST", "/api/v1/annotations", annotation, "", 201},
+		{"create duplicate annotation", router, "POST", "/api/v1/annotations", annotation, "", 409},
+		{"create annotation invalid", router, "POST", "/api/v1/annotations", []byte(`{"topic_filter": "a/#/b"}`), "", 400},
+		{"list annotations", router, "GET", "/api/v1/annotations?tag=sensor", nil, "", 200},
+		{"get annotation", router, "GET", "/api/v1/annotations/1", nil, "", 200},
+		{"get missing annotation", router, "GET", "/api/v1/annotations/999", nil, "", 404},
+		{"get annotation bad id", router, "GET", "/api/v1/annotations/abc", nil, "", 400},
+		{"update annotation", router, "PUT", "/api/v1/annotations/1", annotation, "", 200},
+		{"update missing annotation", router, "PUT", "/api/v1/annotations/999", annotation, "", 404},
+		{"create webhook", router, "POST", "/api/v1/webhooks", webhook, "", 201},
+		{"create webhook invalid event", router, "POST", "/api/v1/webhooks", []byte(`{"url": "https://a.example.com", "events": ["topic.deleted"]}`), "", 400},
+		{"list webhooks", router, "GET", "/api/v1/webhooks", nil, "", 200},
+		{"get webhook", router, "GET", "/api/v1/webhooks/1", nil, "", 200},
+		{"get missing webhook", router, "GET", "/api/v1/webhooks/999", nil, "", 404},
+		{"update webhook", router, "PUT", "/api/v1/webhooks/1", webhook, "", 200},
+		{"update webhook bad id", router, "PUT", "/api/v1/webhooks/abc", webhook, "", 400},
+		{"webhook deliveries", router, "GET", "/api/v1/webhooks/1/deliveries?status=failed", nil, "", 200},
+		{"webhook deliveries missed", router, "GET", "/api/v1/webhooks/1/deliveries?status=missed", nil, "", 200},
+		{"webhook deliveries bad status", router, "GET", "/api/v1/webhooks/1/deliveries?status=lost", nil, "", 400},
+		{"missing webhook deliveries", router, "GET", "/api/v1/webhooks/999/deliveries", nil, "", 404},
+		{"list topics", router, "GET", "/api/v1/topics?include_stale=true", nil, "", 200},
+		{"list topics by tag", router, "GET", "/api/v1/topics?tag=sensor&owner=process-team", nil, "", 200},
+		{"list topics empty", router, "GET", "/api/v1/topics?broker_id=none", nil, "", 200},
+		{"list topics cursor", router, "GET", "/api/v1/topics?include_stale=true&limit=1&cursor=" + url.QueryEscape(page.NextCursor), nil, "", 200},
+		{"list topics estimated", router, "GET", "/api/v1/topics?count=estimate", nil, "", 200},
+		{"list topics bad sort", router, "GET", "/api/v1/topics?sort=nope", nil, "", 400},
+		{"list topics negative limit", router, "GET", "/api/v1/topics?limit=-1", nil, "", 400},
+		{"stale topics", router, "GET", "/api/v1/topics/stale", nil, "", 200},
+		{"search topics", router, "GET", "/api/v1/topics/search?q=plant1/%2B/temperature", nil, "", 200},
+		{"lookup topic", router, "GET", "/api/v1/topics/search?broker_id=broker1&topic=plant1/line2/status", nil, "", 200},
+		{"lookup missing topic", router, "GET", "/api/v1/topics/search?broker_id=broker1&topic=missing", nil, "", 404},
+		{"search topics bad filter", router, "GET", "/api/v1/topics/search?q=a/%23/b", nil, "", 400},
+		{"tail topics bad filter", router, "GET", "/api/v1/topics/tail?broker_id=broker1&filter=a/%23/b", nil, "", 400},
+		{"tail topics unknown broker", router, "GET", "/api/v1/topics/tail?broker_id=broker1&filter=%23", nil, "", 404},
+		{"governance violations", router, "GET", "/api/v1/governance/violations?include_stale=true&limit=1", nil, "", 200},
+		{"governance bad severity", router, "GET", "/api/v1/governance/violations?severity=fatal", nil, "", 400},
+		{"search payloads", router, "GET", "/api/v1/search?q=running", nil, "", 200},
+		{"search payloads without q", router, "GET", "/api/v1/search", nil, "", 400},
+		{"create sample", router, "POST", "/api/v1/samples", validSample, "", 201},
+		{"update sample", router, "POST", "/api/v1/samples", validSample, "", 200},
+		{"create sample invalid", router, "POST", "/api/v1/samples", []byte(`{"broker_id": ""}`), "", 400},
+		{"create sample invalid flag", router, "POST", "/api/v1/samples", []byte(`{"broker_id": "b", "topic": "t", "flags": ["E-Mail"]}`), "", 400},
+		{"flagged topics", router, "GET", "/api/v1/topics/flagged?flag=email,credential", nil, "", 200},
+		{"flagged topics bad sort", router, "GET", "/api/v1/topics/flagged?sort=nope", nil, "", 400},
+		{"export csv", router, "GET", "/api/v1/export?include_stale=true", nil, "", 200},
+		{"export ndjson", router, "GET", "/api/v1/export?format=ndjson&payload=omit", nil, "", 200},
+		{"export bad format", router, "GET", "/api/v1/export?format=xlsx", nil, "", 400},
+		{"import dry run", router, "POST", "/api/v1/import?dry_run=true&strategy=keep", importLines, "", 200},
+		{"import bad strategy", router, "POST", "/api/v1/import?strategy=merge", importLines, "", 400},
+		{"known topics", router, "GET", "/api/v1/samples/known?broker_id=broker1&seen_after=2024-01-01T00:00:00Z", nil, "", 200},
+		{"known topics missing since", router, "GET", "/api/v1/samples/known?broker_id=broker1", nil, "", 400},
+		{"known topics page", router, "GET", "/api/v1/samples/known?broker_id=broker1&seen_after=2024-01-01T00:00:00Z&limit=1&after=a", nil, "", 200},
+		{"known topics bad limit", router, "GET", "/api/v1/samples/known?broker_id=broker1&seen_after=2024-01-01T00:00:00Z&limit=0", nil, "", 400},
+		{"claim sample", router, "POST", "/api/v1/samples/claims", []byte(`{"broker_id": "broker1", "topic": "plant1/temp", "instance_id": "collector-a", "ttl_seconds": 60}`), "", 200},
+		{"claim sample missing topic", router, "POST", "/api/v1/samples/claims", []byte(`{"broker_id": "broker1", "instance_id": "collector-a", "ttl_seconds": 60}`), "", 400},
+		{"release sample claim", router, "DELETE", "/api/v1/samples/claims?broker_id=broker1&topic=plant1/temp&instance_id=collector-a", nil, "", 204},
+		{"release missing sample claim", router, "DELETE", "/api/v1/samples/claims?broker_id=broker1&topic=plant1/temp&instance_id=collector-a", nil, "", 404},
+		{"release sample claim bad id", router, "DELETE", "/api/v1/samples/claims?broker_id=broker1&topic=plant1/temp&instance_id=a%20b", nil, "", 400},
+		{"renew collector lease", router, "PUT", "/api/v1/collectors/collector-a/lease", []byte(`{"brokers": ["broker1"], "ttl_seconds": 30}`), "", 200},
+		{"renew collector lease bad ttl", router, "PUT", "/api/v1/collectors/collector-a/lease", []byte(`{"brokers": ["broker1"], "ttl_seconds": 1}`), "", 400},
+		{"renew collector lease bad id", router, "PUT", "/api/v1/collectors/a%20b/lease", []byte(`{"brokers": [], "ttl_seconds": 30}`), "", 400},
+		{"list collectors", router, "GET", "/api/v1/collectors", nil, "", 200},
+		{"stream topics", router, "GET", "/api/v1/stream/topics?broker_id=broker1&filter=plant1/%23&last_event_id=1", nil, "", 200},
+		{"stream topics bad filter", router, "GET", "/api/v1/stream/topics?filter=a/%23/b", nil, "", 400},
+		{"delete annotation", router, "DELETE", "/api/v1/annotations/1", nil, "", 204},
+		{"delete missing annotation", router, "DELETE", "/api/v1/annotations/1", nil, "", 404},
+		{"delete webhook", router, "DELETE", "/api/v1/webhooks/1", nil, "", 204},
+		{"delete missing webhook", router, "DELETE", "/api/v1/webhooks/1", nil, "", 404},
+		{"release collector lease", router, "DELETE", "/api/v1/collectors/collector-a/lease", nil, "", 204},
+		{"release missing collector lease", router, "DELETE", "/api/v1/collectors/collector-a/lease", nil, "", 404},
+		{"openapi", router, "GET", "/api/v1/openapi.json", nil, "", 200},
+		{"legacy alias", router, "GET", "/api/topics?broker_id=broker1", nil, "", 200},
+		{"health", router, "GET", "/health", nil, "", 200},
+		{"liveness", router, "GET", "/health/live", nil, "", 200},
+		{"readiness", router, "GET", "/health/ready", nil, "", 200},
+		{"metrics", router, "GET", "/metrics", nil, "", 200},
+		{"unauthorized", authRouter, "GET", "/api/v1/topics", nil, "", 401},
+		{"forbidden", authRouter, "POST", "/api/v1/samples", validSample, "mqc_read", 403},
+		{"annotate forbidden", authRouter, "POST", "/api/v1/annotations", annotation, "mqc_read", 403},
+		{"webhooks forbidden", authRouter, "GET", "/api/v1/webhooks", nil, "mqc_read", 403},
+		{"body too large", limitedRouter, "POST", "/api/v1/samples", validSample, "", 413},
+		{"rate limited", limitedRouter, "POST", "/api/v1/samples", validSample, "", 429},
+	}
+
+	exercised := map[string]bool{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			// Event streams stay open until the client goes away
+			if strings.Contains(tt.target, "/stream/") {
+				ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			tt.router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			// Unversioned aliases share the documented /api/v1 operation
+			path := req.URL.Path
+			if !strings.HasPrefix(path, apiPrefix) && strings.HasPrefix(path, legacyPrefix+"/") {
+				path = apiPrefix + strings.TrimPrefix(path, legacyPrefix)
+			}
+			path = specPath(spec, path)
+			method := strings.ToLower(tt.method)
+			exercised[method+" "+path] = true
+
+			resp, err := specResponse(spec, path, method, w.Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Responses documented without content must not carry a body
+			if _, ok := resp["content"]; !ok {
+				if w.Body.Len() > 0 {
+					t.Fatalf("undocumented response body: %s", w.Body.String())
+				}
+				return
+			}
+
+			mediaType, _, _ := strings.Cut(w.Header().Get("Content-Type"), ";")
+			content, _ := resp["content"].(map[string]any)
+			media, ok := content[mediaType].(map[string]any)
+			if !ok {
+				t.Fatalf("response content type %q is not documented", mediaType)
+			}
+
+			var body any = w.Body.String()
+			if mediaType == "application/json" {
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid JSON body: %v", err)
+				}
+			}
+
+			for _, e := range validateSchema(spec, media["schema"].(map[string]any), body, "body") {
+				t.Error(e)
+			}
+
+			if headers, ok := resp["headers"].(map[string]any); ok {
+				for name := range headers {
+					if w.Header().Get(name) == "" {
+						t.Errorf("documented header %s missing", name)
+					}
+				}
+			}
+		})
+	}
+
+	// Every documented operation must be exercised, so the spec cannot drift
+	// from the routes without this test noticing
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			if !exercised[method+" "+path] {
+				t.Errorf("%s %s is documented but not covered by the contract test", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	topic := openAPISchema{"$ref": "#/components/schemas/Topic"}
+
+	valid := map[string]any{
+		"id": 1.0, "broker_id": "b", "topic": "t", "payload_type": "json",
+		"sample_payload": "AQI=", "last_seen": "2024-01-01T00:00:00Z",
+		"created_at": "2024-01-01T00:00:00Z", "truncated": false,
+	}
+	if errs := validateSchema(spec, topic, valid, "topic"); len(errs) > 0 {
+		t.Errorf("expected valid topic, got %v", errs)
+	}
+
+	invalid := map[string]any{
+		"id": 1.5, "broker_id": "b", "topic": "t", "payload_type": "yaml",
+		"last_seen": "yesterday", "created_at": "2024-01-01T00:00:00Z",
+		"truncated": false, "extra": true,
+	}
+	// id type, payload_type enum, last_seen format, missing sample_payload, extra property
+	if errs := validateSchema(spec, topic, invalid, "topic"); len(errs) != 5 {
+		t.Errorf("expected 5 errors, got %d: %v", len(errs), errs)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parses and validates the filter, sort and paging parameters of topic listings
+func parseListOptions(r *http.Request) (repository.ListOptions, error) {
+	q := r.URL.Query()
+
+	opts, err := parseListFilters(r)
+	if err != nil {
+		return opts, err
+	}
+
+	if opts.Limit, opts.Offset, err = parsePageQuery(r, 100); err != nil {
+		return opts, err
+	}
+
+	switch count := repository.CountMode(q.Get("count")); count {
+	case repository.CountExact, repository.CountEstimate, repository.CountNone:
+		opts.Count = count
+	case "":
+		// Keyset pages skip the count unless asked, offset pages keep it
+		if q.Get("cursor") != "" {
+			opts.Count = repository.CountNone
+		}
+	default:
+		return opts, invalidParam("count", "invalid count %q, expected exact, estimate or none", count)
+	}
+
+	if token := q.Get("cursor"); token != "" {
+		if q.Get("offset") != "" {
+			return opts, invalidParam("cursor", "cursor and offset cannot be combined")
+		}
+		cursor, err := repository.DecodeCursor(token)
+		if err != nil {
+			return opts, invalidParam("cursor", "%v", err)
+		}
+		opts.After = cursor
+	}
+
+	return opts, nil
+}
+
+// Parses the filter and sort parameters shared by listings and exports
+func parseListFilters(r *http.Request) (repository.ListOptions, error) {
+	q := r.URL.Query()
+
+	opts := repository.ListOptions{
+		BrokerIDs:   parseListQuery(r, "broker_id"),
+		TopicPrefix: q.Get("prefix"),
+		Tags:        parseListQuery(r, "tag"),
+		Owners:      parseListQuery(r, "owner"),
+		Flags:       parseListQuery(r, "flag"),
+		Sort:        repository.SortField(q.Get("sort")),
+		Desc:        true,
+	}
+
+	var err error
+	for _, pt := range parseListQuery(r, "payload_type") {
+		switch models.PayloadType(pt) {
+		case models.PayloadJSON, models.PayloadXML, models.PayloadText, models.PayloadBinary:
+			opts.PayloadTypes = append(opts.PayloadTypes, models.PayloadType(pt))
+		default:
+			return opts, invalidParam("payload_type", "invalid payload_type %q", pt)
+		}
+	}
+
+	switch opts.Sort {
+	case "", repository.SortLastSeen, repository.SortTopic, repository.SortBroker,
+		repository.SortCreatedAt, repository.SortSize:
+	default:
+		return opts, invalidParam("sort", "invalid sort %q", opts.Sort)
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		opts.Desc = false
+	default:
+		return opts, invalidParam("order", "invalid order %q, expected asc or desc", q.Get("order"))
+	}
+
+	times := []struct {
+		key  string
+		dest *time.Time
+	}{
+		{"last_seen_after", &opts.LastSeenAfter},
+		{"last_seen_before", &opts.LastSeenBefore},
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+	}
+	for _, t := range times {
+		parsed, err := parseTimeQuery(r, t.key)
+		if err != nil {
+			return opts, err
+		}
+		*t.dest = parsed
+	}
+
+	if opts.MinSize, err = parseSizeQuery(r, "min_size"); err != nil {
+		return opts, err
+	}
+	if opts.MaxSize, err = parseSizeQuery(r, "max_size"); err != nil {
+		return opts, err
+	}
+	if opts.MinSize != nil && opts.MaxSize != nil && *opts.MinSize > *opts.MaxSize {
+		return opts, invalidParam("min_size", "min_size must not exceed max_size")
+	}
+
+	return opts, nil
+}
+
+// Parses an optional RFC 3339 timestamp parameter
+func parseTimeQuery(r *http.Request, key string) (time.Time, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, invalidParam(key, "invalid %s, expected RFC 3339 timestamp", key)
+	}
+	return parsed, nil
+}
+
+// Parses an optional non-negative byte size parameter
+func parseSizeQuery(r *http.Request, key string) (*int64, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || parsed < 0 {
+		return nil, invalidParam(key, "invalid %s, expected a non-negative integer", key)
+	}
+	return &parsed, nil
+}
+
+// Largest page a client may request
+const maxPageLimit = 1000
+
+// A query parameter that failed validation, answered with invalid_parameter
+type paramError struct {
+	param   string
+	message string
+}
+
+func (e *paramError) Error() string {
+	return e.message
+}
+
+func invalidParam(param, format string, args ...any) error {
+	return &paramError{param: param, message: fmt.Sprintf(format, args...)}
+}
+
+// Parses limit (1 to maxPageLimit) and offset (non-negative)
+func parsePageQuery(r *http.Request, defaultLimit int) (limit, offset int, err error) {
+	if limit, err = parseIntQuery(r, "limit", defaultLimit); err != nil {
+		return 0, 0, err
+	}
+	if limit < 1 || limit > maxPageLimit {
+		return 0, 0, invalidParam("limit", "invalid limit, expected 1 to %d", maxPageLimit)
+	}
+
+	if offset, err = parseIntQuery(r, "offset", 0); err != nil {
+		return 0, 0, err
+	}
+	return limit, offset, nil
+}
+
+// Parses an optional non-negative integer parameter
+func parseIntQuery(r *http.Request, key string, defaultValue int) (int, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed < 0 {
+		return 0, invalidParam(key, "invalid %s, expected a non-negative integer", key)
+	}
+	return parsed, nil
+}
+
+// Collects a multi-valued query parameter given either repeated or comma-separated
+func parseListQuery(r *http.Request, key string) []string {
+	var values []string
+	for _, raw := range r.URL.Query()[key] {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// Parses an optional boolean query parameter, false when absent
+func parseBoolQuery(r *http.Request, key string) (bool, error) {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, invalidParam(key, "invalid %s, expected true or false", key)
+	}
+	return parsed, nil
+}
@@ -1,41 +1,275 @@
 package api
 
 import (
-	"log"
+	"bufio"
+	"database/sql"
+	"log/slog"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/events"
+	"mqtt-catalog/internal/governance"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/payload"
 	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/tail"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func NewRouter(repo *repository.TopicRepository) http.Handler {
+// Builds the API router. A nil authenticator leaves every route public
+func NewRouter(db *sql.DB, repo *repository.TopicRepository, cfg *config.ServerConfig, authn auth.Authenticator) http.Handler {
 	mux := http.NewServeMux()
 	handler := NewHandler(repo)
+	handler.db = db
+	handler.annotations = repository.NewAnnotationRepository(db)
+	handler.webhooks = repository.NewWebhookRepository(db)
+	handler.leases = repository.NewLeaseRepository(db)
+	handler.retention = cfg.Retention
+	handler.limits = cfg.Limits
+	handler.stream = cfg.Stream
 
-	mux.HandleFunc("POST /api/samples", handler.CreateSample)
-	mux.HandleFunc("GET /api/topics", handler.GetTopics)
-	mux.HandleFunc("GET /api/topics/search", handler.GetTopic)
-	mux.HandleFunc("GET /health", handler.HealthCheck)
+	// The repository publishes topic changes for the event stream
+	if repo.Events() == nil {
+		repo.SetEvents(events.NewHub(cfg.Stream.BufferSize))
+	}
+	handler.drift = &driftInterest{webhooks: handler.webhooks}
+	repo.SetDriftCheck(handler.drift.wanted)
 
-	return corsMiddleware(loggingMiddleware(mux))
+	cors := newCORSPolicy(cfg.CORS, mux)
+	handler.tailer = tail.NewTailer(cfg.Tail, cfg.Limits.MaxSampleBytes, tail.MQTTSource{})
+	if cfg.Scan.Enabled {
+		handler.tailer.SetScanner(payload.NewScanner(cfg.Scan))
+	}
+	handler.upgrader = newUpgrader(cors)
+	handler.linter = governance.NewLinter(cfg.Governance)
+
+	limiter := newRateLimiter(cfg.Limits.RateLimit)
+
+	// Every route is timed under its pattern so metrics stay low-cardinality
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, instrument(pattern, h))
+	}
+	// Registers a route under /api/v1 and its deprecated unversioned alias
+	versioned := func(method, path string, h http.Handler) {
+		current := method + " " + apiPrefix + path
+		legacy := method + " " + legacyPrefix + path
+		handle(current, h)
+		handle(legacy, deprecated(apiPrefix+path, h))
+	}
+	// API routes are rate limited per verified caller, so made-up
+	// credentials cannot dodge the limit, and then size limited. Failed
+	// authentications are limited per client IP before the credentials
+	// are checked
+	api := func(method, path string, scope auth.Scope, h http.HandlerFunc) {
+		pattern := method + " " + apiPrefix + path
+		limit := cfg.Limits.BodyLimitFor(pattern, method+" "+legacyPrefix+path)
+		limited := limiter.middleware(pattern, limitBody(pattern, limit, h))
+		if authn == nil {
+			versioned(method, path, limited)
+			return
+		}
+		versioned(method, path, limiter.unverified(pattern, auth.Require(authn, scope, limited)))
+	}
+
+	api("POST", "/samples", auth.ScopeIngest, handler.CreateSample)
+	api("POST", "/samples/claims", auth.ScopeIngest, handler.ClaimSample)
+	api("DELETE", "/samples/claims", auth.ScopeIngest, handler.ReleaseClaim)
+	api("GET", "/samples/known", auth.ScopeIngest, handler.KnownTopics)
+	api("GET", "/topics", auth.ScopeRead, handler.GetTopics)
+	api("GET", "/topics/stale", auth.ScopeRead, handler.GetStaleTopics)
+	api("GET", "/topics/flagged", auth.ScopeRead, handler.GetFlaggedTopics)
+	api("GET", "/topics/search", auth.ScopeRead, handler.SearchTopics)
+	api("GET", "/topics/tail", auth.ScopeRead, handler.TailTopics)
+	api("GET", "/search", auth.ScopeRead, handler.SearchPayloads)
+	api("GET", "/export", auth.ScopeRead, handler.ExportTopics)
+	api("POST", "/import", auth.ScopeIngest, handler.ImportTopics)
+	api("GET", "/stream/topics", auth.ScopeRead, handler.StreamTopics)
+	api("GET", "/governance/violations", auth.ScopeRead, handler.GetGovernanceViolations)
+	api("GET", "/annotations", auth.ScopeRead, handler.ListAnnotations)
+	api("POST", "/annotations", auth.ScopeAnnotate, handler.CreateAnnotation)
+	api("GET", "/annotations/{id}", auth.ScopeRead, handler.GetAnnotation)
+	api("PUT", "/annotations/{id}", auth.ScopeAnnotate, handler.UpdateAnnotation)
+	api("DELETE", "/annotations/{id}", auth.ScopeAnnotate, handler.DeleteAnnotation)
+	api("GET", "/collectors", auth.ScopeRead, handler.ListCollectors)
+	api("PUT", "/collectors/{instance_id}/lease", auth.ScopeIngest, handler.RenewLease)
+	api("DELETE", "/collectors/{instance_id}/lease", auth.ScopeIngest, handler.ReleaseLease)
+	api("GET", "/webhooks", auth.ScopeWebhooks, handler.ListWebhooks)
+	api("POST", "/webhooks", auth.ScopeWebhooks, handler.CreateWebhook)
+	api("GET", "/webhooks/{id}", auth.ScopeWebhooks, handler.GetWebhook)
+	api("PUT", "/webhooks/{id}", auth.ScopeWebhooks, handler.UpdateWebhook)
+	api("DELETE", "/webhooks/{id}", auth.ScopeWebhooks, handler.DeleteWebhook)
+	api("GET", "/webhooks/{id}/deliveries", auth.ScopeWebhooks, handler.ListWebhookDeliveries)
+	// The spec, probes and metrics stay public for clients, orchestrators and scrapers
+	versioned("GET", "/openapi.json", http.HandlerFunc(handler.OpenAPISpec))
+	handle("GET /health", http.HandlerFunc(handler.HealthCheck))
+	handle("GET /health/live", http.HandlerFunc(handler.Liveness))
+	handle("GET /health/ready", http.HandlerFunc(handler.Readiness))
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Logging runs first so every response, preflights included, carries a request ID
+	return loggingMiddleware(cors.middleware(unmatched(mux)))
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
+const (
+	apiPrefix    = "/api/v1"
+	legacyPrefix = "/api"
+)
+
+// Marks responses of unversioned aliases as deprecated in favour of successor
+func deprecated(successor string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// Methods probed against the router to find what a path supports
+var routeProbeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// Returns the candidate methods that some route serves for the request path
+func routeMethods(mux *http.ServeMux, r *http.Request, candidates []string) []string {
+	var methods []string
+	probe := *r
+	for _, m := range candidates {
+		probe.Method = m
+		if _, pattern := mux.Handler(&probe); pattern != "" {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// Answers requests no route matches with the JSON error envelope instead of
+// the mux's plain-text 404 and 405 responses
+func unmatched(mux *http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if methods := routeMethods(mux, r, routeProbeMethods); len(methods) > 0 {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed,
+				"method "+r.Method+" not allowed", map[string]any{"allowed": methods})
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "no route for "+r.URL.Path, nil)
+	})
+}
+
+// Captures the status code and body size written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.size += n
+	return n, err
+}
+
+// Lets streaming handlers flush through the recorder
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Lets WebSocket handlers take over the connection through the recorder
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rr.ResponseWriter).Hijack()
+	if err == nil && rr.status == 0 {
+		rr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Records request latency for a route pattern
+func instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// Assigns each request an ID (reusing a valid incoming X-Request-ID), exposes
+// it to handlers through the request context and logs the completed request
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(ctx).Log(ctx, level, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"size", rec.size,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
 	})
 }
+
+// Accepts client-supplied request IDs only if they are short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
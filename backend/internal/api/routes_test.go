@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mqtt-catalog/internal/auth"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setupTestRouter(t *testing.T, cfg *config.ServerConfig) http.Handler {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	if cfg == nil {
+		cfg = &config.ServerConfig{}
+	}
+	return NewRouter(db, repository.NewTopicRepository(db), cfg, nil)
+}
+
+func TestRouter_Metrics(t *testing.T) {
+	router := setupTestRouter(t, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body, _ := io.ReadAll(w.Body)
+	expected := []string{
+		`mqtt_catalog_http_request_duration_seconds_count{code="200",method="GET",route="GET /api/topics"}`,
+		`mqtt_catalog_repository_query_duration_seconds_count{operation="list"}`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(body), e) {
+			t.Errorf("metrics output missing %s", e)
+		}
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "json", "info")
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	var handlerRequestID string
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("inside handler")
+		handlerRequestID = w.Header().Get("X-Request-ID")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Request-ID") != "abc-123" || handlerRequestID != "abc-123" {
+		t.Errorf("expected request ID to be propagated, got %q", w.Header().Get("X-Request-ID"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log records, got %d: %s", len(lines), buf.String())
+	}
+
+	var inside, access map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &inside)
+	json.Unmarshal([]byte(lines[1]), &access)
+
+	if inside["request_id"] != "abc-123" {
+		t.Errorf("handler log missing request_id: %v", inside)
+	}
+
+	if access["status"] != float64(http.StatusTeapot) || access["size"] != float64(15) || access["path"] != "/api/topics" {
+		t.Errorf("unexpected access log: %v", access)
+	}
+	if _, ok := access["duration_ms"]; !ok {
+		t.Errorf("access log missing duration_ms: %v", access)
+	}
+}
+
+func TestRouter_Auth(t *testing.T) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	key := "mqc_read"
+	authn := auth.NewAPIKeyAuthenticator(auth.StaticKeyStore{
+		{Name: "ui", SHA256: auth.HashAPIKey(key), Scopes: []string{"read"}},
+	})
+	router := NewRouter(db, repository.NewTopicRepository(db), &config.ServerConfig{}, authn)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{"health is public", http.MethodGet, "/health", "", http.StatusOK},
+		{"metrics is public", http.MethodGet, "/metrics", "", http.StatusOK},
+		{"read requires key", http.MethodGet, "/api/topics", "", http.StatusUnauthorized},
+		{"read with key", http.MethodGet, "/api/topics", key, http.StatusOK},
+		{"ingest needs ingest scope", http.MethodPost, "/api/samples", key, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_Versioning(t *testing.T) {
+	router := setupTestRouter(t, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/topics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Deprecation") != "" {
+		t.Error("expected versioned route not to be deprecated")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Deprecation") != "true" {
+		t.Error("expected alias to be marked deprecated")
+	}
+	if got := w.Header().Get("Link"); got != `</api/v1/topics>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+}
+
+func TestRouter_ErrorEnvelope(t *testing.T) {
+	router := setupTestRouter(t, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantCode   string
+		wantParam  string
+	}{
+		{"unknown route", http.MethodGet, "/api/v1/nope", http.StatusNotFound, "not_found", ""},
+		{"wrong method", http.MethodDelete, "/api/v1/topics", http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{"non-numeric limit", http.MethodGet, "/api/v1/topics?limit=ten", http.StatusBadRequest, "invalid_parameter", "limit"},
+		{"negative offset", http.MethodGet, "/api/v1/topics/stale?offset=-5", http.StatusBadRequest, "invalid_parameter", "offset"},
+		{"limit too large", http.MethodGet, "/api/v1/search?q=x&limit=5000", http.StatusBadRequest, "invalid_parameter", "limit"},
+		{"unknown mode", http.MethodGet, "/api/v1/topics/search?q=x&mode=glob", http.StatusBadRequest, "invalid_parameter", "mode"},
+		{"bad body", http.MethodPost, "/api/v1/samples", http.StatusBadRequest, "invalid_body", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader("{"))
+			req.Header.Set("X-Request-ID", "req-123")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected JSON error, got %q", ct)
+			}
+
+			var body models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode error: %v", err)
+			}
+			if body.Code != tt.wantCode || body.Message == "" {
+				t.Errorf("unexpected error %+v", body)
+			}
+			if body.RequestID != "req-123" {
+				t.Errorf("expected request_id req-123, got %q", body.RequestID)
+			}
+			if tt.wantParam != "" && body.Details["parameter"] != tt.wantParam {
+				t.Errorf("expected parameter %q, got %v", tt.wantParam, body.Details["parameter"])
+			}
+		})
+	}
+}
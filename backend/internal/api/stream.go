@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Delay clients wait before reconnecting to a dropped stream
+	streamRetry = 3 * time.Second
+	// Keep-alive interval when none is configured
+	defaultStreamHeartbeat = 15 * time.Second
+	// How long the answer to whether a webhook wants schema drift is reused
+	driftCheckInterval = 10 * time.Second
+)
+
+// Tracks whether anyone listens for schema drift, so saving a sample only
+// parses and compares payloads while an event stream is open or a webhook
+// subscribes to topic.schema_drift
+type driftInterest struct {
+	streams    atomic.Int64
+	webhooks   *repository.WebhookRepository
+	mu         sync.Mutex
+	checkedAt  time.Time
+	subscribed bool
+}
+
+func (d *driftInterest) wanted() bool {
+	if d.streams.Load() > 0 {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.checkedAt) >= driftCheckInterval {
+		subscribed, err := d.webhooks.Subscribed(models.EventTopicSchemaDrift)
+		if err != nil {
+			// Computing drift needlessly is better than missing it
+			slog.Error("Failed to look up schema drift webhooks", "error", err)
+			subscribed = true
+		}
+		d.subscribed, d.checkedAt = subscribed, time.Now()
+	}
+	return d.subscribed
+}
+
+// Selects the events a stream client asked for
+type streamFilter struct {
+	brokerIDs []string
+	topic     *regexp.Regexp
+}
+
+func (f streamFilter) match(e models.TopicEvent) bool {
+	if len(f.brokerIDs) > 0 && !slices.Contains(f.brokerIDs, e.Topic.BrokerID) {
+		return false
+	}
+	return f.topic == nil || f.topic.MatchString(e.Topic.Topic)
+}
+
+// Streams topic changes as Server-Sent Events. Clients resume after a
+// reconnect with Last-Event-ID; a reset event tells them events were missed
+func (h *Handler) StreamTopics(w http.ResponseWriter, r *http.Request) {
+	filter := streamFilter{brokerIDs: parseListQuery(r, "broker_id")}
+	if f := r.URL.Query().Get("filter"); f != "" {
+		pattern, err := repository.TopicFilterRegex(f)
+		if err != nil {
+			badRequest(w, r, invalidParam("filter", "%v", err))
+			return
+		}
+		filter.topic = regexp.MustCompile(pattern)
+	}
+
+	lastID, err := parseLastEventID(r)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server write timeout would otherwise cut long-lived streams
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		serverError(w, r, "Error preparing event stream", err)
+		return
+	}
+
+	sub, backlog, complete := h.repo.Events().Subscribe(lastID)
+	defer sub.Close()
+	if h.drift != nil {
+		h.drift.streams.Add(1)
+		defer h.drift.streams.Add(-1)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range backlog {
+		if filter.match(e) {
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	interval := h.stream.Heartbeat
+	if interval <= 0 {
+		interval = defaultStreamHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind or shutting down; the client reconnects
+				return
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Reads the resume position from the Last-Event-ID header, or the
+// last_event_id parameter for clients that cannot set headers
+func parseLastEventID(r *http.Request) (uint64, error) {
+	val := r.Header.Get("Last-Event-ID")
+	if val == "" {
+		val = r.URL.Query().Get("last_event_id")
+	}
+	if val == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, invalidParam("last_event_id", "invalid last event ID, expected a non-negative integer")
+	}
+	return id, nil
+}
+
+func writeEvent(w http.ResponseWriter, e models.TopicEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
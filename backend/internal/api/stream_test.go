@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// Reads events from an SSE body, skipping comments and the retry hint
+func readSSE(t *testing.T, scanner *bufio.Scanner, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var cur sseEvent
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			cur.id = value
+		case "event":
+			cur.event = value
+		case "data":
+			cur.data = value
+		case "":
+			if cur.event != "" {
+				events = append(events, cur)
+			}
+			cur = sseEvent{}
+		}
+	}
+	if len(events) < n {
+		t.Fatalf("stream ended after %d of %d events: %v", len(events), n, scanner.Err())
+	}
+	return events
+}
+
+func openStream(t *testing.T, srv *httptest.Server, query, lastEventID string) *bufio.Scanner {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/stream/topics"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewScanner(resp.Body)
+}
+
+func TestStreamTopics(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	eventSchema, _ := resolveRef(spec, "#/components/schemas/TopicEvent")
+
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	srv := httptest.NewServer(NewRouter(db, repo, &config.ServerConfig{}, nil))
+	t.Cleanup(srv.Close)
+
+	filtered := openStream(t, srv, "?broker_id=broker1&filter=plant1/%2B/temperature", "")
+	all := openStream(t, srv, "", "")
+
+	samples := []models.Sample{
+		{BrokerID: "broker2", Topic: "plant1/line1/temperature", PayloadType: models.PayloadJSON, Payload: []byte(`{"t":1}`)},
+		{BrokerID: "broker1", Topic: "plant1/line1/status", PayloadType: models.PayloadText, Payload: []byte("ok")},
+		{BrokerID: "broker1", Topic: "plant1/line1/temperature", PayloadType: models.PayloadJSON, Payload: []byte(`{"t":2}`)},
+		{BrokerID: "broker1", Topic: "plant1/line1/temperature", PayloadType: models.PayloadText, Payload: []byte("2")},
+	}
+	for _, s := range samples {
+		s.Timestamp = time.Now()
+		if err := repo.Upsert(s); err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+	}
+
+	got := readSSE(t, all, 4)
+	for _, e := range got {
+		var data any
+		if err := json.Unmarshal([]byte(e.data), &data); err != nil {
+			t.Fatalf("invalid event data %q: %v", e.data, err)
+		}
+		for _, msg := range validateSchema(spec, eventSchema, data, "data") {
+			t.Error(msg)
+		}
+	}
+
+	ids := make([]string, len(got))
+	for i, e := range got {
+		ids[i] = e.id
+	}
+
+	got = readSSE(t, filtered, 2)
+	if got[0].id != ids[2] || got[0].event != models.EventTopicCreated {
+		t.Errorf("first filtered event = %+v, want id %s %s", got[0], ids[2], models.EventTopicCreated)
+	}
+	if got[1].id != ids[3] || got[1].event != models.EventTopicPayloadTypeChanged {
+		t.Errorf("second filtered event = %+v, want id %s %s", got[1], ids[3], models.EventTopicPayloadTypeChanged)
+	}
+
+	// Resuming replays only what came after the client's last event
+	resumed := readSSE(t, openStream(t, srv, "", ids[1]), 2)
+	if resumed[0].id != ids[2] || resumed[1].id != ids[3] {
+		t.Errorf("resumed events = %+v, want ids %s and %s", resumed, ids[2], ids[3])
+	}
+
+	// IDs the hub never issued, e.g. from before a restart, ask for a reset
+	for _, lastID := range []string{"99", ids[3] + "0"} {
+		reset := readSSE(t, openStream(t, srv, "", lastID), 1)
+		if reset[0].event != "reset" {
+			t.Errorf("last ID %s: expected reset event, got %+v", lastID, reset[0])
+		}
+	}
+}
+
+func TestStreamTopics_InvalidParams(t *testing.T) {
+	router := setupTestRouter(t, nil)
+
+	tests := []struct {
+		name        string
+		target      string
+		lastEventID string
+		wantParam   string
+	}{
+		{"bad filter", "/api/v1/stream/topics?filter=a/%23/b", "", "filter"},
+		{"bad last event id", "/api/v1/stream/topics", "abc", "last_event_id"},
+		{"negative last event id", "/api/v1/stream/topics?last_event_id=-1", "", "last_event_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var resp models.ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != http.StatusBadRequest || resp.Details["parameter"] != tt.wantParam {
+				t.Errorf("got %d %s, want 400 for %s", w.Code, w.Body.String(), tt.wantParam)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/tail"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Deadline for each frame written to a tail client
+	tailWriteTimeout = 10 * time.Second
+	// Keeps proxies from closing quiet tail connections
+	tailPingInterval = 30 * time.Second
+)
+
+// Answers failed WebSocket handshakes with the JSON error envelope
+func newUpgrader(cors *corsPolicy) websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin: cors.websocketOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			code := apierror.CodeBadRequest
+			if status == http.StatusForbidden {
+				code = apierror.CodeForbidden
+			}
+			apierror.Write(w, r, status, code, reason.Error(), nil)
+		},
+	}
+}
+
+// Opens a WebSocket that streams live messages matching filter on one
+// configured broker as JSON frames until the session ends
+func (h *Handler) TailTopics(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	brokerID := q.Get("broker_id")
+	if brokerID == "" {
+		badRequest(w, r, invalidParam("broker_id", "broker_id is required"))
+		return
+	}
+	filter := q.Get("filter")
+	if err := repository.ValidateTopicFilter(filter); err != nil {
+		badRequest(w, r, invalidParam("filter", "%v", err))
+		return
+	}
+
+	broker, ok := h.tailer.Broker(brokerID)
+	if !ok {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "unknown broker "+brokerID,
+			map[string]any{"broker_id": brokerID})
+		return
+	}
+
+	release, err := h.tailer.Acquire()
+	if errors.Is(err, tail.ErrTooManySessions) {
+		apierror.Write(w, r, http.StatusTooManyRequests, apierror.CodeRateLimited, err.Error(), nil)
+		return
+	}
+	defer release()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	// Hijacked connections no longer cancel the request context, so the
+	// session ends when reading (which also handles pongs and close frames) fails
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(tailPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(tailWriteTimeout))
+			}
+		}
+	}()
+
+	send := func(e models.TailEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+		return conn.WriteJSON(e)
+	}
+
+	logger := logging.FromContext(r.Context()).With("broker_id", brokerID, "filter", filter)
+	logger.Info("Tail session started")
+	if err := h.tailer.Run(ctx, broker, filter, send); err != nil {
+		logger.Warn("Tail session failed", "error", err)
+	}
+
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+}
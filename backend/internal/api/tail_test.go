@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/tail"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Replays fixed messages for any subscription
+type replaySource []tail.Message
+
+func (s replaySource) Subscribe(broker config.BrokerConfig, filter string, deliver func(tail.Message)) (func(), error) {
+	for _, m := range s {
+		deliver(m)
+	}
+	return func() {}, nil
+}
+
+func setupTailServer(t *testing.T, cfg config.TailConfig, source tail.Source) *httptest.Server {
+	t.Helper()
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	handler := NewHandler(repository.NewTopicRepository(db))
+	handler.tailer = tail.NewTailer(cfg, 0, source)
+	handler.upgrader = newUpgrader(newCORSPolicy(config.CORSConfig{}, http.NewServeMux()))
+
+	srv := httptest.NewServer(http.HandlerFunc(handler.TailTopics))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTailTopics(t *testing.T) {
+	cfg := config.TailConfig{
+		Brokers:           []config.BrokerConfig{{ID: "broker1"}},
+		MessagesPerSecond: 100,
+		Burst:             10,
+		IdleTimeout:       50 * time.Millisecond,
+		MaxDuration:       time.Minute,
+		MaxSessions:       1,
+	}
+	srv := setupTailServer(t, cfg, replaySource{
+		{Topic: "plant1/temp", Payload: []byte(`{"t": 21}`), Time: time.Now()},
+	})
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "?broker_id=broker1&filter=plant1/%23"
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	spec := loadOpenAPISpec(t)
+	frameSchema, _ := resolveRef(spec, "#/components/schemas/TailEvent")
+	readFrame := func(e *models.TailEvent) error {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var frame any
+		json.Unmarshal(data, &frame)
+		for _, msg := range validateSchema(spec, frameSchema, frame, "frame") {
+			t.Error(msg)
+		}
+		return json.Unmarshal(data, e)
+	}
+
+	var msg, closed models.TailEvent
+	if err := readFrame(&msg); err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	if msg.Type != models.TailMessage || msg.Topic != "plant1/temp" || msg.PayloadType != models.PayloadJSON || msg.Payload != `{"t": 21}` {
+		t.Errorf("message = %+v", msg)
+	}
+	if err := readFrame(&closed); err != nil {
+		t.Fatalf("read closed event: %v", err)
+	}
+	if closed.Type != models.TailClosed || closed.Reason != tail.ReasonIdle {
+		t.Errorf("closed = %+v, want reason %s", closed, tail.ReasonIdle)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected normal closure, got %v", err)
+	}
+
+	// A session slot is free again once the previous one ended
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("second dial failed: %v", err)
+	}
+	second.Close()
+}
+
+func TestTailTopics_Rejected(t *testing.T) {
+	cfg := config.TailConfig{Brokers: []config.BrokerConfig{{ID: "broker1"}}, MaxSessions: 1}
+	srv := setupTailServer(t, cfg, replaySource{})
+
+	tests := []struct {
+		name       string
+		query      string
+		origin     string
+		websocket  bool
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing broker", "?filter=a/b", "", true, 400, "invalid_parameter"},
+		{"invalid filter", "?broker_id=broker1&filter=a/%23/b", "", true, 400, "invalid_parameter"},
+		{"unknown broker", "?broker_id=other&filter=a/b", "", true, 404, "not_found"},
+		{"plain HTTP", "?broker_id=broker1&filter=a/b", "", false, 400, "bad_request"},
+		{"foreign origin", "?broker_id=broker1&filter=a/b", "https://evil.example", true, 403, "forbidden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.query, nil)
+			if tt.websocket {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Sec-WebSocket-Version", "13")
+				req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var body models.ErrorResponse
+			json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != tt.wantStatus || body.Code != tt.wantCode {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRouter_TailUpgrade(t *testing.T) {
+	// Nothing listens on port 1, so the session reports a failed subscription
+	router := setupTestRouter(t, &config.ServerConfig{Tail: config.TailConfig{
+		Brokers:           []config.BrokerConfig{{ID: "broker1", URL: "tcp://127.0.0.1:1"}},
+		MessagesPerSecond: 1,
+		Burst:             1,
+		IdleTimeout:       time.Minute,
+		MaxDuration:       time.Minute,
+		MaxSessions:       1,
+	}})
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	// Upgrades pass through the logging and metrics response wrappers
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/topics/tail?broker_id=broker1&filter=%23"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var closed models.TailEvent
+	if err := conn.ReadJSON(&closed); err != nil {
+		t.Fatalf("read closed event: %v", err)
+	}
+	if closed.Type != models.TailClosed || closed.Reason != tail.ReasonSubscribeFailed {
+		t.Errorf("closed = %+v, want reason %s", closed, tail.ReasonSubscribeFailed)
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/internal/webhook"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// Request body of webhook create and update; Active defaults to true
+type webhookInput struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	BrokerID    string   `json:"broker_id"`
+	TopicFilter string   `json:"topic_filter"`
+	Active      *bool    `json:"active"`
+	Secret      string   `json:"secret"`
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+
+	webhooks, total, err := h.webhooks.List(limit, offset)
+	if err != nil {
+		serverError(w, r, "Error listing webhooks", err)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	writeJSON(w, http.StatusOK, models.WebhookListResponse{Webhooks: webhooks, Total: total})
+}
+
+// Subscribes a URL to topic events. The response is the only one carrying
+// the signing secret, generated when the request does not set one
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	if wh.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			serverError(w, r, "Error generating webhook secret", err)
+			return
+		}
+		wh.Secret = secret
+	}
+
+	if err := h.webhooks.Create(&wh); err != nil {
+		serverError(w, r, "Error creating webhook", err, "url", wh.URL)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, wh)
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	wh, err := h.webhooks.Get(id)
+	if err != nil {
+		serverError(w, r, "Error getting webhook", err, "id", id)
+		return
+	}
+	if wh == nil {
+		webhookNotFound(w, r, id)
+		return
+	}
+
+	wh.Secret = ""
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// Replaces every field of a webhook; the secret is only rotated when the
+// request sets one
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	wh, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	wh.ID = id
+
+	found, err := h.webhooks.Update(&wh)
+	if err != nil {
+		serverError(w, r, "Error updating webhook", err, "id", id)
+		return
+	}
+	if !found {
+		webhookNotFound(w, r, id)
+		return
+	}
+
+	wh.Secret = ""
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// Removes a webhook together with its delivery log
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := h.webhooks.Delete(id)
+	if err != nil {
+		serverError(w, r, "Error deleting webhook", err, "id", id)
+		return
+	}
+	if !found {
+		webhookNotFound(w, r, id)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists a webhook's deliveries newest first, optionally only those with the
+// given status
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePageQuery(r, 100)
+	if err != nil {
+		badRequest(w, r, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryFailed, models.DeliveryMissed:
+	default:
+		badRequest(w, r, invalidParam("status", "invalid status %q, expected pending, succeeded, failed or missed", status))
+		return
+	}
+
+	wh, err := h.webhooks.Get(id)
+	if err != nil {
+		serverError(w, r, "Error getting webhook", err, "id", id)
+		return
+	}
+	if wh == nil {
+		webhookNotFound(w, r, id)
+		return
+	}
+
+	deliveries, total, err := h.webhooks.ListDeliveries(id, status, limit, offset)
+	if err != nil {
+		serverError(w, r, "Error listing webhook deliveries", err, "id", id)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.WebhookDeliveryListResponse{Deliveries: deliveries, Total: total})
+}
+
+// Parses the {id} path value
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		badRequest(w, r, invalidParam("id", "invalid webhook id %q", r.PathValue("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+// Decodes and validates a webhook request body, answering 400 or 413 when it
+// is unusable
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	var in webhookInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		if isBodyTooLarge(err) {
+			apierror.Write(w, r, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "request body too large", nil)
+			return models.Webhook{}, false
+		}
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, fmt.Sprintf("invalid request body: %v", err), nil)
+		return models.Webhook{}, false
+	}
+
+	if err := validateWebhook(in); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidBody, err.Error(), nil)
+		return models.Webhook{}, false
+	}
+
+	wh := models.Webhook{
+		URL:         in.URL,
+		Events:      in.Events,
+		BrokerID:    in.BrokerID,
+		TopicFilter: in.TopicFilter,
+		Active:      in.Active == nil || *in.Active,
+		Secret:      in.Secret,
+	}
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	return wh, true
+}
+
+func validateWebhook(in webhookInput) error {
+	u, err := url.Parse(in.URL)
+	if in.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q, expected an http or https URL", in.URL)
+	}
+
+	for _, event := range in.Events {
+		if !slices.Contains(webhook.Events, event) {
+			return fmt.Errorf("invalid event %q, expected one of %v", event, webhook.Events)
+		}
+	}
+
+	if in.TopicFilter != "" {
+		if err := repository.ValidateTopicFilter(in.TopicFilter); err != nil {
+			return err
+		}
+	}
+
+	if in.Secret != "" && len(in.Secret) < 16 {
+		return errors.New("secret must be at least 16 characters")
+	}
+	return nil
+}
+
+// Returns a random signing secret
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func webhookNotFound(w http.ResponseWriter, r *http.Request, id int64) {
+	apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "webhook not found", map[string]any{"id": id})
+}
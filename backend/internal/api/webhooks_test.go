@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	repo := repository.NewTopicRepository(db)
+	router := NewRouter(db, repo, &config.ServerConfig{}, nil)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := do("POST", "/api/v1/webhooks", `{"url": "https://hooks.example.com/catalog", "topic_filter": "plant1/#"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body.String())
+	}
+	var created models.Webhook
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Secret, "whsec_") || !created.Active || created.Events == nil {
+		t.Errorf("created webhook = %+v", created)
+	}
+
+	// Gaps the dispatcher records show up as missed deliveries
+	if _, err := repository.NewWebhookRepository(db).RecordMissed(41, "events after 41 were dropped", time.Now()); err != nil {
+		t.Fatalf("RecordMissed() error = %v", err)
+	}
+	w = do("GET", "/api/v1/webhooks/1/deliveries?status=missed", "")
+	var missed any
+	if err := json.Unmarshal(w.Body.Bytes(), &missed); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("missed deliveries = %d %s", w.Code, w.Body.String())
+	}
+	spec := loadOpenAPISpec(t)
+	listSchema, _ := resolveRef(spec, "#/components/schemas/WebhookDeliveryListResponse")
+	for _, msg := range validateSchema(spec, listSchema, missed, "body") {
+		t.Error(msg)
+	}
+	if !strings.Contains(w.Body.String(), `"event_type":"events.missed"`) || !strings.Contains(w.Body.String(), `"event_id":41`) {
+		t.Errorf("missed deliveries = %s", w.Body.String())
+	}
+
+	// The secret is only returned on create and kept when an update omits it
+	w = do("PUT", "/api/v1/webhooks/1", `{"url": "https://hooks.example.com/v2", "active": false}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "secret") {
+		t.Fatalf("update = %d %s", w.Code, w.Body.String())
+	}
+	for _, target := range []string{"/api/v1/webhooks/1", "/api/v1/webhooks"} {
+		if w := do("GET", target, ""); strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("GET %s exposes the secret: %s", target, w.Body.String())
+		}
+	}
+	stored, _ := repository.NewWebhookRepository(db).Get(1)
+	if stored.Secret != created.Secret || stored.Active || stored.TopicFilter != "" {
+		t.Errorf("stored webhook = %+v", stored)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing url", `{"events": ["topic.created"]}`},
+		{"unsupported scheme", `{"url": "ftp://hooks.example.com"}`},
+		{"unknown event", `{"url": "https://hooks.example.com", "events": ["topic.sample_refreshed"]}`},
+		{"invalid topic filter", `{"url": "https://hooks.example.com", "topic_filter": "a/#/b"}`},
+		{"short secret", `{"url": "https://hooks.example.com", "secret": "abc"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do("POST", "/api/v1/webhooks", tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("create = %d %s, want 400", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Writes the JSON error envelope shared by every API endpoint
+package apierror
+
+import (
+	"encoding/json"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+)
+
+// Machine-readable error codes, stable across releases
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// Writes an error response carrying the request ID of r
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// Writes a 500 without exposing the underlying error, which callers log
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusInternalServerError, CodeInternal, "internal server error", nil)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"net/http"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Resolves the SHA-256 hash of an API key to its principal, nil when unknown
+type KeyStore interface {
+	LookupAPIKey(hash string) (*Principal, error)
+}
+
+// Authenticates requests carrying an API key; only key hashes are ever stored
+type APIKeyAuthenticator struct {
+	stores []KeyStore
+}
+
+func NewAPIKeyAuthenticator(stores ...KeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{stores: stores}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	hash := HashAPIKey(key)
+	for _, store := range a.stores {
+		p, err := store.LookupAPIKey(hash)
+		if err != nil {
+			return nil, fmt.Errorf("lookup api key: %w", err)
+		}
+		if p != nil {
+			p.Method = "api_key"
+			return p, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Returns the hex-encoded SHA-256 hash under which a key is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generates a new random API key
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "mqc_" + hex.EncodeToString(b), nil
+}
+
+// Key store backed by hashed keys from the auth config file
+type StaticKeyStore []config.APIKeyConfig
+
+func (s StaticKeyStore) LookupAPIKey(hash string) (*Principal, error) {
+	for _, k := range s {
+		if subtle.ConstantTimeCompare([]byte(k.SHA256), []byte(hash)) == 1 {
+			return &Principal{Subject: k.Name, Scopes: k.Scopes}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Key store backed by the api_keys table
+type DBKeyStore struct {
+	Repo *repository.APIKeyRepository
+}
+
+func (s DBKeyStore) LookupAPIKey(hash string) (*Principal, error) {
+	key, err := s.Repo.GetByHash(hash)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	return &Principal{Subject: key.Name, Scopes: key.Scopes}, nil
+}
@@ -0,0 +1,138 @@
+// Authentication and scope-based authorization for the REST API.
+// Requests authenticate with a static API key (X-API-Key header) or a JWT
+// bearer token verified against a local JWKS file
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mqtt-catalog/internal/apierror"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/logging"
+	"mqtt-catalog/internal/repository"
+	"net/http"
+	"slices"
+)
+
+type Scope string
+
+const (
+	// ScopeIngest allows collectors to write samples
+	ScopeIngest Scope = "ingest"
+	// ScopeRead allows UI users and tools to query the catalog
+	ScopeRead Scope = "read"
+	// ScopeAnnotate allows data owners to edit topic annotations
+	ScopeAnnotate Scope = "annotate"
+	// ScopeWebhooks allows managing webhook subscriptions and their delivery log
+	ScopeWebhooks Scope = "webhooks"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// The authenticated caller of a request
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+func (p *Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, string(scope))
+}
+
+// Identifies the caller of a request. Implementations return ErrNoCredentials
+// when the request carries none of their credential type
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Tries each authenticator in turn until one finds credentials on the request
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// Builds the authenticator described by the config, nil when auth is disabled
+func FromConfig(cfg config.AuthConfig, db *sql.DB) (Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var chain Chain
+
+	var stores []KeyStore
+	if len(cfg.APIKeys) > 0 {
+		stores = append(stores, StaticKeyStore(cfg.APIKeys))
+	}
+	if cfg.DatabaseKeys {
+		stores = append(stores, DBKeyStore{Repo: repository.NewAPIKeyRepository(db)})
+	}
+	if len(stores) > 0 {
+		chain = append(chain, NewAPIKeyAuthenticator(stores...))
+	}
+
+	if cfg.JWT != nil {
+		jwtAuth, err := NewJWTAuthenticator(*cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("configure jwt: %w", err)
+		}
+		chain = append(chain, jwtAuth)
+	}
+
+	return chain, nil
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// Returns the authenticated principal, nil when authentication is disabled
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Wraps a handler so it only runs for callers holding scope.
+// A nil authenticator disables authentication
+func Require(authn Authenticator, scope Scope, next http.Handler) http.Handler {
+	if authn == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := authn.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidCredentials) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mqtt-catalog"`)
+			apierror.Write(w, r, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required", nil)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to authenticate request", "error", err)
+			apierror.Internal(w, r)
+			return
+		}
+
+		if !p.HasScope(scope) {
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "missing scope "+string(scope),
+				map[string]any{"required_scope": scope})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"database/sql"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	if FromContext(r.Context()) == nil {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRequire(t *testing.T) {
+	readKey := "mqc_read"
+	ingestKey := "mqc_ingest"
+	authn := NewAPIKeyAuthenticator(StaticKeyStore{
+		{Name: "ui", SHA256: HashAPIKey(readKey), Scopes: []string{"read"}},
+		{Name: "collector", SHA256: HashAPIKey(ingestKey), Scopes: []string{"ingest"}},
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		scope      Scope
+		wantStatus int
+	}{
+		{"no credentials", "", ScopeRead, http.StatusUnauthorized},
+		{"unknown key", "mqc_unknown", ScopeRead, http.StatusUnauthorized},
+		{"matching scope", readKey, ScopeRead, http.StatusOK},
+		{"missing scope", readKey, ScopeIngest, http.StatusForbidden},
+		{"ingest scope", ingestKey, ScopeIngest, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			Require(authn, tt.scope, http.HandlerFunc(okHandler)).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestRequire_Disabled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/topics", nil)
+	w := httptest.NewRecorder()
+
+	Require(nil, ScopeRead, http.HandlerFunc(okHandler)).ServeHTTP(w, req)
+
+	// The handler runs without a principal when auth is disabled
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected status %d, got %d", http.StatusTeapot, w.Code)
+	}
+}
+
+func TestDBKeyStore(t *testing.T) {
+	db, err := sql.Open(database.SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	repo := repository.NewAPIKeyRepository(db)
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey failed: %v", err)
+	}
+	if err := repo.Create(HashAPIKey(key), "collector", []string{"ingest"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	authn, err := FromConfig(config.AuthConfig{Enabled: true, DatabaseKeys: true}, db)
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/samples", nil)
+	req.Header.Set(APIKeyHeader, key)
+
+	p, err := authn.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if p.Subject != "collector" || !p.HasScope(ScopeIngest) {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	if _, err := repo.Revoke("collector"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := authn.Authenticate(req); err == nil {
+		t.Error("expected revoked key to be rejected")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/metrics"
 	"mqtt-catalog/internal/payload"
 	"mqtt-catalog/pkg/dbclient"
 	"mqtt-catalog/pkg/models"
@@ -14,20 +16,39 @@ import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// Sampled topics remembered per broker unless configured otherwise
+const defaultMaxTrackedTopics = 100000
+
 type BrokerCollector struct {
-	brokerID      string
-	brokerURL     string
-	mqttClient    mqtt.Client
-	dbClient      *dbclient.Client
-	sampledTopics map[string]bool
-	mu            sync.Mutex
-	ctx           context.Context
-	wg            *sync.WaitGroup
+	brokerID     string
+	brokerURL    string
+	mqttClient   mqtt.Client
+	dbClient     *dbclient.Client
+	scanner      *payload.Scanner
+	subscription string
+	// claim is set for shared subscriptions, whose topics are claimed on
+	// the server so only one of the sharing instances uploads each
+	claim *sampleClaim
+	// knownTopicsMaxAge preloads sampledTopics with the topics the catalog
+	// saw this recently, zero samples every topic again
+	knownTopicsMaxAge time.Duration
+	sampledTopics     *topicSet
+	// patterns collapses high-cardinality topic levels, nil keeps topics
+	// as they are
+	patterns   *patternCollapser
+	logger     *slog.Logger
+	connected  bool
+	stateSince time.Time
+	lastError  string
+	mu         sync.Mutex
+	ctx        context.Context
+	wg         *sync.WaitGroup
 }
 
 func NewBrokerCollector(
 	brokerID, brokerURL, clientID, username, password string,
 	dbClient *dbclient.Client,
+	scanner *payload.Scanner,
 	ctx context.Context,
 	wg *sync.WaitGroup,
 ) *BrokerCollector {
@@ -36,44 +57,83 @@ func NewBrokerCollector(
 		brokerID:      brokerID,
 		brokerURL:     brokerURL,
 		dbClient:      dbClient,
-		sampledTopics: make(map[string]bool),
+		scanner:       scanner,
+		subscription:  "#",
+		sampledTopics: newTopicSet(defaultMaxTrackedTopics),
+		logger:        slog.Default().With("broker_id", brokerID),
+		stateSince:    time.Now(),
 		ctx:           ctx,
 		wg:            wg,
 	}
 
+	opts := ClientOptions(brokerURL, clientID, username, password).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			bc.setConnected(true, nil)
+		}).
+		SetConnectionLostHandler(func(client mqtt.Client, err error) {
+			bc.setConnected(false, err)
+			bc.logger.Warn("Connection lost", "error", err)
+		}).
+		SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
+			metrics.BrokerReconnects.WithLabelValues(brokerID).Inc()
+		}).
+		SetDefaultPublishHandler(bc.messageHandler)
+
+	bc.mqttClient = mqtt.NewClient(opts)
+
+	return bc
+}
+
+// Returns the connection settings shared by every client of a broker
+func ClientOptions(brokerURL, clientID, username, password string) *mqtt.ClientOptions {
 	// For now, we trust self-signed certificate
 	tlsConfig := &tls.Config{InsecureSkipVerify: true}
 
-	opts := mqtt.NewClientOptions().
+	return mqtt.NewClientOptions().
 		AddBroker(brokerURL).
 		SetClientID(clientID).
 		SetUsername(username).
 		SetPassword(password).
 		SetCleanSession(true).
 		SetTLSConfig(tlsConfig).
-		SetAutoReconnect(true).
-		SetConnectTimeout(10 * time.Second).
-		SetConnectionLostHandler(func(client mqtt.Client, err error) {
-			log.Printf("[%s] Connection lost: %v", brokerID, err)
-		}).
-		SetDefaultPublishHandler(bc.messageHandler)
-
-	bc.mqttClient = mqtt.NewClient(opts)
-
-	return bc
+		SetConnectTimeout(10 * time.Second)
 }
 
 func (bc *BrokerCollector) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	topic := msg.Topic()
+	metrics.MessagesReceived.WithLabelValues(bc.brokerID).Inc()
 
 	bc.mu.Lock()
-	if bc.sampledTopics[topic] {
-		bc.mu.Unlock()
-		return
+	collapsed := false
+	if bc.patterns != nil {
+		topic, collapsed = bc.patterns.Normalize(topic)
 	}
-	bc.sampledTopics[topic] = true
+	added, evicted := bc.sampledTopics.Add(topic)
+	patterns := bc.patterns.Patterns()
 	bc.mu.Unlock()
 
+	if collapsed {
+		metrics.TopicPatterns.WithLabelValues(bc.brokerID).Set(float64(patterns))
+		bc.logger.Info("Collapsing high-cardinality topic level", "pattern", topic)
+	}
+	if evicted {
+		metrics.TrackedTopicsEvicted.WithLabelValues(bc.brokerID).Inc()
+	}
+	if !added {
+		return
+	}
+
+	if bc.claim != nil {
+		if retryAt, ok := bc.claimTopic(topic); !ok {
+			bc.mu.Lock()
+			bc.sampledTopics.RetryAt(topic, retryAt)
+			bc.mu.Unlock()
+			return
+		}
+	}
+	metrics.TopicsSampled.WithLabelValues(bc.brokerID).Inc()
+
 	payloadData := msg.Payload()
 	payloadType := payload.DetectType(payloadData)
 
@@ -84,45 +144,212 @@ func (bc *BrokerCollector) messageHandler(client mqtt.Client, msg mqtt.Message)
 		Payload:     payloadData,
 		Timestamp:   time.Now(),
 	}
+	if bc.scanner != nil {
+		bc.scan(&sample)
+	}
 
-	if err := bc.dbClient.SendSample(bc.ctx, sample); err != nil {
-		log.Printf("[%s] Error sending sample for topic %s: %v", bc.brokerID, topic, err)
+	start := time.Now()
+	err := bc.dbClient.SendSample(bc.ctx, sample)
+	metrics.SampleSendDuration.WithLabelValues(bc.brokerID).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.SampleSendErrors.WithLabelValues(bc.brokerID).Inc()
+		bc.logger.Error("Error sending sample",
+			"topic", topic,
+			"payload_type", payloadType,
+			"error", err,
+		)
+		if bc.claim != nil {
+			bc.releaseClaim(topic)
+		}
 	} else {
-		log.Printf("[%s] Sampled topic: %s (type: %s, size: %d bytes)", bc.brokerID, topic, payloadType, len(payloadData))
+		bc.logger.Info("Sampled topic",
+			"topic", topic,
+			"payload_type", payloadType,
+			"size", len(payloadData),
+		)
+	}
+}
+
+// Bounds the topics remembered for the broker and, when a threshold is set,
+// collapses topic levels with more distinct values than that into {id}
+func (bc *BrokerCollector) limitCardinality(cfg config.CardinalityConfig) {
+	if cfg.MaxTopics > 0 {
+		bc.sampledTopics = newTopicSet(cfg.MaxTopics)
+	}
+	if cfg.PatternThreshold > 0 {
+		bc.patterns = newPatternCollapser(cfg.PatternThreshold, bc.sampledTopics.max*patternLevelsPerTopic)
 	}
 }
 
+// Instance name and duration of the claims taken on sampled topics
+type sampleClaim struct {
+	instanceID string
+	ttl        time.Duration
+}
+
+// Subscribes through the broker's shared group, so the instances in it
+// split the messages, and claims each new topic before sampling it
+func (bc *BrokerCollector) shareSubscription(subscription, instanceID string, ttl time.Duration) {
+	bc.subscription = subscription
+	bc.claim = &sampleClaim{instanceID: instanceID, ttl: ttl}
+}
+
+// Longest wait before a topic claimed by another instance is claimed again,
+// in case its holder fails to upload the sample and releases the claim
+const claimRetryInterval = time.Minute
+
+// Reports whether this instance should sample the topic, and if not when to
+// ask again. When the server cannot be asked the topic is sampled anyway: a
+// duplicate upload is harmless, a topic nobody samples is not
+func (bc *BrokerCollector) claimTopic(topic string) (time.Time, bool) {
+	claim, err := bc.dbClient.ClaimSample(bc.ctx, models.ClaimRequest{
+		BrokerID:   bc.brokerID,
+		Topic:      topic,
+		InstanceID: bc.claim.instanceID,
+		TTLSeconds: int(bc.claim.ttl.Seconds()),
+	})
+	if err != nil {
+		metrics.SampleClaims.WithLabelValues(bc.brokerID, "error").Inc()
+		bc.logger.Warn("Failed to claim topic, sampling it anyway", "topic", topic, "error", err)
+		return time.Time{}, true
+	}
+	if !claim.Claimed {
+		metrics.SampleClaims.WithLabelValues(bc.brokerID, "taken").Inc()
+		bc.logger.Debug("Topic claimed by another collector", "topic", topic, "claimed_by", claim.ClaimedBy)
+		retryAt := time.Now().Add(claimRetryInterval)
+		if claim.ExpiresAt.Before(retryAt) {
+			retryAt = claim.ExpiresAt
+		}
+		return retryAt, false
+	}
+	metrics.SampleClaims.WithLabelValues(bc.brokerID, "claimed").Inc()
+	return time.Time{}, true
+}
+
+// Gives up the claim on a topic whose sample could not be uploaded, so any
+// of the sharing instances samples it on a later message; this one retries
+// after claimRetryInterval
+func (bc *BrokerCollector) releaseClaim(topic string) {
+	if err := bc.dbClient.ReleaseClaim(bc.ctx, bc.brokerID, topic, bc.claim.instanceID); err != nil {
+		bc.logger.Warn("Failed to release topic claim", "topic", topic, "error", err)
+	}
+
+	bc.mu.Lock()
+	bc.sampledTopics.RetryAt(topic, time.Now().Add(claimRetryInterval))
+	bc.mu.Unlock()
+}
+
+// Flags and, when configured, redacts PII and secrets before the sample
+// leaves the collector
+func (bc *BrokerCollector) scan(sample *models.Sample) {
+	if len(bc.scanner.Apply(sample)) == 0 {
+		return
+	}
+	for _, flag := range sample.Flags {
+		metrics.SamplesFlagged.WithLabelValues(bc.brokerID, flag).Inc()
+	}
+	bc.logger.Warn("Sample contains likely PII or secrets",
+		"topic", sample.Topic,
+		"flags", sample.Flags,
+		"redacted", sample.Redacted,
+	)
+}
+
 func (bc *BrokerCollector) Run(duration time.Duration) error {
 	defer bc.wg.Done()
+	bc.setConnected(false, nil)
 
-	log.Printf("[%s] Connecting to MQTT broker at %s...", bc.brokerID, bc.brokerURL)
+	if bc.knownTopicsMaxAge > 0 {
+		bc.preloadKnownTopics()
+	}
+
+	bc.logger.Info("Connecting to MQTT broker", "url", bc.brokerURL)
 	if token := bc.mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("[%s] connect error: %w", bc.brokerID, token.Error())
+		bc.setConnected(false, token.Error())
+		return fmt.Errorf("connect error: %w", token.Error())
 	}
-	defer bc.mqttClient.Disconnect(250)
+	defer func() {
+		bc.mqttClient.Disconnect(250)
+		bc.setConnected(false, nil)
+	}()
 
-	log.Printf("[%s] Connected. Subscribing to all topics (#)...", bc.brokerID)
-	if token := bc.mqttClient.Subscribe("#", 0, nil); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("[%s] subscribe error: %w", bc.brokerID, token.Error())
+	bc.logger.Info("Connected, subscribing to all topics", "subscription", bc.subscription)
+	if token := bc.mqttClient.Subscribe(bc.subscription, 0, nil); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe error: %w", token.Error())
 	}
 
-	log.Printf("[%s] Collecting samples for %v...", bc.brokerID, duration)
+	bc.logger.Info("Collecting samples", "duration", duration)
 
 	timer := time.NewTimer(duration)
 	defer timer.Stop()
 
 	select {
 	case <-timer.C:
-		log.Printf("[%s] Collection period completed", bc.brokerID)
+		bc.logger.Info("Collection period completed")
 	case <-bc.ctx.Done():
-		log.Printf("[%s] Context canceled", bc.brokerID)
+		bc.logger.Info("Context canceled")
 	}
 
 	bc.mu.Lock()
-	count := len(bc.sampledTopics)
+	count := bc.sampledTopics.Len()
 	bc.mu.Unlock()
 
-	log.Printf("[%s] Collection finished. Sampled %d unique topics", bc.brokerID, count)
+	bc.logger.Info("Collection finished", "unique_topics", count)
 
 	return nil
 }
+
+// Marks the topics the catalog saw within knownTopicsMaxAge as sampled, so
+// a restart only uploads new and stale topics. Without an answer from the
+// server every topic is sampled again
+func (bc *BrokerCollector) preloadKnownTopics() {
+	topics, err := bc.dbClient.KnownTopics(bc.ctx, bc.brokerID, time.Now().Add(-bc.knownTopicsMaxAge))
+	if err != nil {
+		bc.logger.Warn("Failed to load known topics, sampling every topic", "error", err)
+		return
+	}
+
+	bc.mu.Lock()
+	for _, topic := range topics {
+		bc.sampledTopics.Add(topic)
+	}
+	bc.mu.Unlock()
+	metrics.TopicsPreloaded.WithLabelValues(bc.brokerID).Set(float64(len(topics)))
+
+	bc.logger.Info("Skipping recently sampled topics", "known_topics", len(topics), "max_age", bc.knownTopicsMaxAge)
+}
+
+// Records a connection state change for health reporting and metrics
+func (bc *BrokerCollector) setConnected(connected bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if connected != bc.connected {
+		bc.stateSince = time.Now()
+	}
+	bc.connected = connected
+	if err != nil {
+		bc.lastError = err.Error()
+	}
+
+	gauge := 0.0
+	if connected {
+		gauge = 1
+	}
+	metrics.BrokerConnected.WithLabelValues(bc.brokerID).Set(gauge)
+}
+
+// Returns the broker's current connection state
+func (bc *BrokerCollector) Status() BrokerStatus {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return BrokerStatus{
+		BrokerID:      bc.brokerID,
+		Connected:     bc.connected,
+		Since:         bc.stateSince,
+		LastError:     bc.lastError,
+		SampledTopics: bc.sampledTopics.Len(),
+	}
+}
@@ -0,0 +1,212 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/pkg/dbclient"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m testMessage) Duplicate() bool   { return false }
+func (m testMessage) Qos() byte         { return 0 }
+func (m testMessage) Retained() bool    { return false }
+func (m testMessage) Topic() string     { return m.topic }
+func (m testMessage) MessageID() uint16 { return 0 }
+func (m testMessage) Payload() []byte   { return m.payload }
+func (m testMessage) Ack()              {}
+
+func TestBrokerCollector_SharedSubscription(t *testing.T) {
+	var mu sync.Mutex
+	var claims []models.ClaimRequest
+	var uploaded, released []string
+	claimStatus, uploadStatus := http.StatusOK, http.StatusCreated
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v1/samples/claims":
+			if r.Method == http.MethodDelete {
+				released = append(released, r.URL.Query().Get("topic"))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if claimStatus != http.StatusOK {
+				w.WriteHeader(claimStatus)
+				return
+			}
+			var req models.ClaimRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			claims = append(claims, req)
+			// Another instance already sampled plant1/pressure
+			holder := req.InstanceID
+			if req.Topic == "plant1/pressure" {
+				holder = "collector-b"
+			}
+			json.NewEncoder(w).Encode(models.ClaimResponse{Claimed: holder == req.InstanceID, ClaimedBy: holder, ExpiresAt: time.Now().Add(time.Hour)})
+		case "/api/v1/samples":
+			var sample models.Sample
+			json.NewDecoder(r.Body).Decode(&sample)
+			uploaded = append(uploaded, sample.Topic)
+			w.WriteHeader(uploadStatus)
+		}
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	bc := NewBrokerCollector("broker1", "tcp://localhost:1883", "", "", "", dbclient.New(server.URL), nil, context.Background(), &wg)
+	bc.shareSubscription("$share/catalog/#", "collector-a", time.Minute)
+	now := time.Now()
+	bc.sampledTopics.now = func() time.Time { return now }
+
+	for _, topic := range []string{"plant1/temp", "plant1/pressure", "plant1/temp"} {
+		bc.messageHandler(nil, testMessage{topic: topic, payload: []byte(`{"v": 1}`)})
+	}
+
+	if len(claims) != 2 || claims[0].InstanceID != "collector-a" || claims[0].TTLSeconds != 60 {
+		t.Errorf("claims = %+v, want one per new topic", claims)
+	}
+	if !slices.Equal(uploaded, []string{"plant1/temp"}) {
+		t.Errorf("uploaded = %v, want only the claimed topic", uploaded)
+	}
+
+	// Without an answer from the server the topic is sampled anyway
+	claimStatus = http.StatusServiceUnavailable
+	bc.messageHandler(nil, testMessage{topic: "plant1/flow", payload: []byte("1")})
+	if !slices.Equal(uploaded, []string{"plant1/temp", "plant1/flow"}) {
+		t.Errorf("uploaded after claim error = %v", uploaded)
+	}
+
+	// A taken topic is claimed again once the retry interval has passed
+	claimStatus = http.StatusOK
+	now = now.Add(claimRetryInterval + time.Second)
+	bc.messageHandler(nil, testMessage{topic: "plant1/pressure", payload: []byte("1")})
+	if len(claims) != 3 || claims[2].Topic != "plant1/pressure" {
+		t.Errorf("claims = %+v, want plant1/pressure claimed again", claims)
+	}
+
+	// A failed upload gives the claim back
+	uploadStatus = http.StatusInternalServerError
+	bc.messageHandler(nil, testMessage{topic: "plant1/level", payload: []byte("1")})
+	if !slices.Equal(released, []string{"plant1/level"}) {
+		t.Errorf("released = %v, want the claim on plant1/level", released)
+	}
+}
+
+func TestBrokerCollector_PreloadKnownTopics(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	knownStatus := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v1/samples/known":
+			if knownStatus != http.StatusOK {
+				w.WriteHeader(knownStatus)
+				return
+			}
+			seenAfter, _ := time.Parse(time.RFC3339, r.URL.Query().Get("seen_after"))
+			if age := time.Since(seenAfter); age < 59*time.Minute || age > 61*time.Minute {
+				t.Errorf("seen_after = %v, want an hour ago", seenAfter)
+			}
+			json.NewEncoder(w).Encode(models.KnownTopicsResponse{BrokerID: "broker1", Topics: []string{"plant1/temp"}})
+		case "/api/v1/samples":
+			var sample models.Sample
+			json.NewDecoder(r.Body).Decode(&sample)
+			uploaded = append(uploaded, sample.Topic)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	newCollector := func() *BrokerCollector {
+		var wg sync.WaitGroup
+		bc := NewBrokerCollector("broker1", "tcp://localhost:1883", "", "", "", dbclient.New(server.URL), nil, context.Background(), &wg)
+		bc.knownTopicsMaxAge = time.Hour
+		bc.preloadKnownTopics()
+		return bc
+	}
+
+	bc := newCollector()
+	for _, topic := range []string{"plant1/temp", "plant1/flow"} {
+		bc.messageHandler(nil, testMessage{topic: topic, payload: []byte("1")})
+	}
+	if !slices.Equal(uploaded, []string{"plant1/flow"}) {
+		t.Errorf("uploaded = %v, want only the unknown topic", uploaded)
+	}
+
+	// Without the known topics every topic is sampled
+	knownStatus = http.StatusInternalServerError
+	uploaded = nil
+	bc = newCollector()
+	bc.messageHandler(nil, testMessage{topic: "plant1/temp", payload: []byte("1")})
+	if !slices.Equal(uploaded, []string{"plant1/temp"}) {
+		t.Errorf("uploaded after failed preload = %v", uploaded)
+	}
+}
+
+func TestBrokerCollector_LimitCardinality(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var sample models.Sample
+		json.NewDecoder(r.Body).Decode(&sample)
+		uploaded = append(uploaded, sample.Topic)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	bc := NewBrokerCollector("broker1", "tcp://localhost:1883", "", "", "", dbclient.New(server.URL), nil, context.Background(), &wg)
+	bc.limitCardinality(config.CardinalityConfig{MaxTopics: 3, PatternThreshold: 2})
+
+	for i := range 10 {
+		bc.messageHandler(nil, testMessage{topic: fmt.Sprintf("devices/%d/status", i), payload: []byte("1")})
+	}
+
+	want := []string{"devices/0/status", "devices/1/status", "devices/{id}/status"}
+	if !slices.Equal(uploaded, want) {
+		t.Errorf("uploaded = %v, want %v", uploaded, want)
+	}
+	if status := bc.Status(); status.SampledTopics != 3 {
+		t.Errorf("SampledTopics = %d, want 3", status.SampledTopics)
+	}
+}
+
+func TestClaimTTL(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     time.Duration
+	}{
+		{time.Minute, time.Minute},
+		{1500 * time.Millisecond, 2 * time.Second},
+		{100 * time.Millisecond, time.Second},
+		{48 * time.Hour, 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := claimTTL(tt.duration); got != tt.want {
+			t.Errorf("claimTTL(%v) = %v, want %v", tt.duration, got, tt.want)
+		}
+	}
+}
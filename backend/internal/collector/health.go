@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type BrokerStatus struct {
+	BrokerID      string    `json:"broker_id"`
+	Connected     bool      `json:"connected"`
+	Since         time.Time `json:"since"`
+	LastError     string    `json:"last_error,omitempty"`
+	SampledTopics int       `json:"sampled_topics"`
+}
+
+type healthResponse struct {
+	Status  string         `json:"status"`
+	Brokers []BrokerStatus `json:"brokers"`
+}
+
+// Returns the connection state of every broker assigned to this instance,
+// including those whose collector has not started yet
+func (mc *MultiCollector) Statuses() []BrokerStatus {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	statuses := make([]BrokerStatus, 0, len(mc.assigned))
+	for _, broker := range mc.assigned {
+		if bc, ok := mc.collectors[broker.ID]; ok {
+			statuses = append(statuses, bc.Status())
+			continue
+		}
+		statuses = append(statuses, BrokerStatus{BrokerID: broker.ID, Since: mc.started})
+	}
+	return statuses
+}
+
+// Fails once any broker has stayed disconnected for longer than the grace
+// period, so an orchestrator restarts a collector that is stuck
+func (mc *MultiCollector) liveness(w http.ResponseWriter, r *http.Request) {
+	statuses := mc.Statuses()
+
+	healthy := true
+	for _, s := range statuses {
+		if !s.Connected && time.Since(s.Since) > mc.disconnectGrace {
+			healthy = false
+		}
+	}
+
+	writeHealth(w, healthy, "alive", "stuck", statuses)
+}
+
+// Succeeds only while every broker is connected
+func (mc *MultiCollector) readiness(w http.ResponseWriter, r *http.Request) {
+	statuses := mc.Statuses()
+
+	ready := true
+	for _, s := range statuses {
+		if !s.Connected {
+			ready = false
+		}
+	}
+
+	writeHealth(w, ready, "ready", "not_ready", statuses)
+}
+
+func writeHealth(w http.ResponseWriter, ok bool, okStatus, failStatus string, statuses []BrokerStatus) {
+	response := healthResponse{Status: okStatus, Brokers: statuses}
+	code := http.StatusOK
+	if !ok {
+		response.Status = failStatus
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"mqtt-catalog/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMultiCollector() *MultiCollector {
+	return NewMultiCollector(&config.CollectorConfig{
+		Brokers: []config.BrokerConfig{
+			{ID: "broker1", URL: "tcp://localhost:1883"},
+			{ID: "broker2", URL: "tcp://localhost:1884"},
+		},
+		DBServiceURL:    "http://localhost:8080",
+		DisconnectGrace: time.Minute,
+	})
+}
+
+func TestMultiCollector_Health(t *testing.T) {
+	mc := newTestMultiCollector()
+	handler := mc.AdminHandler()
+
+	var wg sync.WaitGroup
+	for _, b := range mc.brokers {
+		mc.collectors[b.ID] = NewBrokerCollector(b.ID, b.URL, "", "", "", mc.dbClient, nil, mc.ctx, &wg)
+	}
+	mc.collectors["broker1"].setConnected(true, nil)
+
+	check := func(path string, want int) healthResponse {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d", path, want, w.Code)
+		}
+
+		var response healthResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		return response
+	}
+
+	// broker2 is disconnected but still within the grace period
+	check("/health/live", http.StatusOK)
+	ready := check("/health/ready", http.StatusServiceUnavailable)
+	if len(ready.Brokers) != 2 || !ready.Brokers[0].Connected || ready.Brokers[1].Connected {
+		t.Errorf("unexpected broker states: %+v", ready.Brokers)
+	}
+
+	// Stuck past the grace period
+	bc := mc.collectors["broker2"]
+	bc.setConnected(false, errors.New("connection refused"))
+	bc.mu.Lock()
+	bc.stateSince = time.Now().Add(-2 * time.Minute)
+	bc.mu.Unlock()
+
+	live := check("/health/live", http.StatusServiceUnavailable)
+	if live.Brokers[1].LastError != "connection refused" {
+		t.Errorf("expected last error to be reported, got %+v", live.Brokers[1])
+	}
+
+	bc.setConnected(true, nil)
+	check("/health/live", http.StatusOK)
+	check("/health/ready", http.StatusOK)
+}
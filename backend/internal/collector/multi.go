@@ -2,9 +2,12 @@ package collector
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/payload"
 	"mqtt-catalog/pkg/dbclient"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -12,46 +15,105 @@ import (
 	"time"
 )
 
+// Longest topic claim the server accepts
+const maxClaimTTL = 24 * time.Hour
+
 type MultiCollector struct {
-	brokers  []config.BrokerConfig
-	dbClient *dbclient.Client
-	ctx      context.Context
-	cancel   context.CancelFunc
+	brokers         []config.BrokerConfig
+	dbClient        *dbclient.Client
+	scanner         *payload.Scanner
+	disconnectGrace time.Duration
+	knownMaxAge     time.Duration
+	cardinality     config.CardinalityConfig
+	shard           config.ShardConfig
+	// Brokers this instance collects: all of them unless sharding is enabled
+	assigned   []config.BrokerConfig
+	collectors map[string]*BrokerCollector
+	stops      map[string]context.CancelFunc
+	// Closed when the broker's collector has returned from Run
+	done    map[string]chan struct{}
+	started time.Time
+	mu      sync.Mutex
+	// Serializes lease changes; leaseExpires is when the leases of the last
+	// successful renewal run out, zero while none are held
+	leaseMu      sync.Mutex
+	leaseExpires time.Time
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
-func NewMultiCollector(brokers []config.BrokerConfig, dbServiceURL string) *MultiCollector {
+func NewMultiCollector(cfg *config.CollectorConfig) *MultiCollector {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	var scanner *payload.Scanner
+	if cfg.Scan.Enabled {
+		scanner = payload.NewScanner(cfg.Scan)
+	}
+
+	// Sharded instances learn their brokers from the lease table, except
+	// the shared ones every instance collects
+	assigned := cfg.Brokers
+	if cfg.Shard.Enabled {
+		assigned = sharedBrokers(cfg.Brokers)
+	}
+
 	return &MultiCollector{
-		brokers:  brokers,
-		dbClient: dbclient.New(dbServiceURL),
-		ctx:      ctx,
-		cancel:   cancel,
+		brokers:         cfg.Brokers,
+		dbClient:        newDBClient(cfg),
+		scanner:         scanner,
+		disconnectGrace: cfg.DisconnectGrace,
+		knownMaxAge:     cfg.KnownTopicsMaxAge,
+		cardinality:     cfg.Cardinality,
+		shard:           cfg.Shard,
+		assigned:        assigned,
+		collectors:      make(map[string]*BrokerCollector),
+		stops:           make(map[string]context.CancelFunc),
+		done:            make(map[string]chan struct{}),
+		started:         time.Now(),
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 }
 
+// Returns the brokers collected through a shared subscription
+func sharedBrokers(brokers []config.BrokerConfig) []config.BrokerConfig {
+	var shared []config.BrokerConfig
+	for _, broker := range brokers {
+		if broker.SharedGroup != "" {
+			shared = append(shared, broker)
+		}
+	}
+	return shared
+}
+
 func (mc *MultiCollector) Run(duration time.Duration) error {
 	var wg sync.WaitGroup
+	deadline := time.Now().Add(duration)
+
+	// The shard loop starts and stops brokers as leases change; it is done
+	// before the collectors are awaited so none is added afterwards
+	shardCtx, stopShard := context.WithCancel(mc.ctx)
+	defer stopShard()
+	shardDone := make(chan struct{})
 
-	log.Printf("Starting collection from %d brokers...", len(mc.brokers))
-
-	for _, broker := range mc.brokers {
-		wg.Add(1)
-		bc := NewBrokerCollector(
-			broker.ID,
-			broker.URL,
-			broker.ClientID,
-			broker.Username,
-			broker.Password,
-			mc.dbClient,
-			mc.ctx,
-			&wg,
+	if mc.shard.Enabled {
+		slog.Info("Starting sharded collection",
+			"brokers", len(mc.brokers),
+			"instance_id", mc.shard.InstanceID,
 		)
-		go func(collector *BrokerCollector) {
-			if err := collector.Run(duration); err != nil {
-				log.Printf("Error in collector: %v", err)
-			}
-		}(bc)
+		for _, broker := range sharedBrokers(mc.brokers) {
+			mc.startBroker(broker, duration, &wg)
+		}
+		go func() {
+			defer close(shardDone)
+			mc.runShard(shardCtx, deadline, &wg)
+		}()
+	} else {
+		slog.Info("Starting collection", "brokers", len(mc.brokers))
+		close(shardDone)
+		for _, broker := range mc.brokers {
+			mc.startBroker(broker, duration, &wg)
+		}
 	}
 
 	sigChan := make(chan os.Signal, 1)
@@ -62,15 +124,115 @@ func (mc *MultiCollector) Run(duration time.Duration) error {
 
 	select {
 	case <-timer.C:
-		log.Printf("Collection timer expired")
+		slog.Info("Collection timer expired")
 	case <-sigChan:
-		log.Printf("Received interrupt signal")
+		slog.Info("Received interrupt signal")
 		mc.cancel()
 	}
 
-	log.Printf("Waiting for all broker collectors to finish...")
+	stopShard()
+	<-shardDone
+
+	slog.Info("Waiting for all broker collectors to finish")
 	wg.Wait()
 
-	log.Printf("All collectors finished")
+	if mc.shard.Enabled {
+		mc.releaseLease()
+	}
+
+	slog.Info("All collectors finished")
 	return nil
 }
+
+// Starts collecting from a broker for the given duration or until the
+// broker is stopped
+func (mc *MultiCollector) startBroker(broker config.BrokerConfig, duration time.Duration, wg *sync.WaitGroup) {
+	ctx, stop := context.WithCancel(mc.ctx)
+
+	// Every member of a shared group needs its own session on the broker
+	clientID := broker.ClientID
+	if broker.SharedGroup != "" && clientID != "" {
+		clientID += "-" + mc.shard.InstanceID
+	}
+
+	wg.Add(1)
+	bc := NewBrokerCollector(
+		broker.ID,
+		broker.URL,
+		clientID,
+		broker.Username,
+		broker.Password,
+		mc.dbClient,
+		mc.scanner,
+		ctx,
+		wg,
+	)
+	bc.knownTopicsMaxAge = mc.knownMaxAge
+	bc.limitCardinality(mc.cardinality)
+	if broker.SharedGroup != "" {
+		bc.shareSubscription(broker.Subscription(), mc.shard.InstanceID, claimTTL(duration))
+	}
+	done := make(chan struct{})
+	mc.mu.Lock()
+	mc.collectors[broker.ID] = bc
+	mc.stops[broker.ID] = stop
+	mc.done[broker.ID] = done
+	mc.mu.Unlock()
+
+	go func(collector *BrokerCollector) {
+		defer close(done)
+		if err := collector.Run(duration); err != nil {
+			slog.Error("Broker collector failed", "broker_id", collector.brokerID, "error", err)
+		}
+	}(bc)
+}
+
+// Returns how long topic claims last: the collection period, so each topic
+// is sampled once per run, within the limits the server accepts
+func claimTTL(duration time.Duration) time.Duration {
+	return min(max(duration.Round(time.Second), time.Second), maxClaimTTL)
+}
+
+// Disconnects from a broker another instance takes over and waits until its
+// collector has returned, so the broker's lease is only given up afterwards.
+// The broker counts as running until then and is not started again
+func (mc *MultiCollector) stopBroker(brokerID string) {
+	mc.mu.Lock()
+	stop, ok := mc.stops[brokerID]
+	done := mc.done[brokerID]
+	mc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	stop()
+	<-done
+
+	mc.mu.Lock()
+	if mc.done[brokerID] == done {
+		delete(mc.stops, brokerID)
+		delete(mc.collectors, brokerID)
+		delete(mc.done, brokerID)
+	}
+	mc.mu.Unlock()
+}
+
+// Serves the collector's operational endpoints on the optional admin listener
+func (mc *MultiCollector) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /health/live", mc.liveness)
+	mux.HandleFunc("GET /health/ready", mc.readiness)
+	return mux
+}
+
+func newDBClient(cfg *config.CollectorConfig) *dbclient.Client {
+	var opts []dbclient.Option
+	if cfg.DBServiceAPIKey != "" {
+		opts = append(opts, dbclient.WithAPIKey(cfg.DBServiceAPIKey))
+	}
+	if cfg.DBServiceToken != "" {
+		opts = append(opts, dbclient.WithBearerToken(cfg.DBServiceToken))
+	}
+	return dbclient.New(cfg.DBServiceURL, opts...)
+}
@@ -0,0 +1,118 @@
+package collector
+
+import "strings"
+
+// Placeholder replacing a collapsed topic level
+const patternPlaceholder = "{id}"
+
+// Topic levels counted per tracked topic; topics share most of their levels
+// with their siblings, so this leaves room for deep hierarchies
+const patternLevelsPerTopic = 4
+
+// Detects topic levels holding IDs or timestamps and collapses them into
+// {id}, so devices/a1/status and devices/b2/status are sampled once as
+// devices/{id}/status. A level is collapsed below a parent once more than
+// threshold distinct values were seen there; parents are keyed by their
+// already collapsed path, so nested ID levels collapse one after another.
+// Only topics seen afterwards map to the pattern: topics sampled before the
+// collapse keep their own catalog entries next to it
+type patternCollapser struct {
+	threshold int
+	// maxChildren bounds the child levels counted over all parents
+	maxChildren int
+	counted     int
+	patterns    int
+	root        *patternNode
+}
+
+// A topic level counted below its parent. A collapsed node only has the
+// {id} child, its earlier children are dropped
+type patternNode struct {
+	children  map[string]*patternNode
+	collapsed bool
+}
+
+func newPatternCollapser(threshold, maxChildren int) *patternCollapser {
+	return &patternCollapser{
+		threshold:   threshold,
+		maxChildren: maxChildren,
+		root:        &patternNode{children: make(map[string]*patternNode)},
+	}
+}
+
+// Returns the topic with its collapsed levels replaced by {id}, and whether
+// this call collapsed a level
+func (p *patternCollapser) Normalize(topic string) (pattern string, collapsed bool) {
+	levels := strings.Split(topic, "/")
+
+	node := p.root
+	for i, level := range levels {
+		if node.collapsed {
+			levels[i] = patternPlaceholder
+			node = node.children[patternPlaceholder]
+			continue
+		}
+
+		var grew bool
+		node, grew = p.observe(node, level)
+		if grew {
+			levels[i] = patternPlaceholder
+			collapsed = true
+		}
+		if node == nil {
+			// Levels below an uncounted one cannot have collapsed
+			break
+		}
+	}
+	return strings.Join(levels, "/"), collapsed
+}
+
+// Number of parents whose children are collapsed, zero on a nil collapser
+func (p *patternCollapser) Patterns() int {
+	if p == nil {
+		return 0
+	}
+	return p.patterns
+}
+
+// Counts level as a child of node and returns the child's node, nil when
+// the limit leaves it uncounted. Reports whether the new child pushed node
+// over the threshold, collapsing it
+func (p *patternCollapser) observe(node *patternNode, level string) (*patternNode, bool) {
+	if child, ok := node.children[level]; ok {
+		return child, false
+	}
+	// Beyond the limit new levels go uncounted; the topic set still bounds
+	// the memory their topics take
+	if p.counted >= p.maxChildren {
+		return nil, false
+	}
+
+	if len(node.children) < p.threshold {
+		child := &patternNode{children: make(map[string]*patternNode)}
+		node.children[level] = child
+		p.counted++
+		return child, false
+	}
+
+	// Counts below the parent are never reached again, their paths now pass
+	// through {id}, so only its subtree is released
+	p.release(node)
+	placeholder := &patternNode{children: make(map[string]*patternNode)}
+	node.children = map[string]*patternNode{patternPlaceholder: placeholder}
+	node.collapsed = true
+	p.counted++
+	p.patterns++
+	return placeholder, true
+}
+
+// Uncounts the levels below node, including patterns collapsed there
+func (p *patternCollapser) release(node *patternNode) {
+	for _, child := range node.children {
+		p.release(child)
+		if child.collapsed {
+			p.patterns--
+		}
+		p.counted--
+	}
+}
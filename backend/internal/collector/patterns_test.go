@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPatternCollapser_Normalize(t *testing.T) {
+	p := newPatternCollapser(3, 100)
+
+	// Three devices stay below the threshold and keep their names
+	for _, id := range []string{"a1", "b2", "c3"} {
+		topic := "devices/" + id + "/status"
+		if got, collapsed := p.Normalize(topic); got != topic || collapsed {
+			t.Errorf("Normalize(%q) = %q, %v", topic, got, collapsed)
+		}
+	}
+
+	// The fourth collapses the level, later devices map to the pattern
+	if got, collapsed := p.Normalize("devices/d4/status"); got != "devices/{id}/status" || !collapsed {
+		t.Errorf("Normalize() over the threshold = %q, %v", got, collapsed)
+	}
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{"devices/a1/status", "devices/{id}/status"},
+		{"devices/e5/config", "devices/{id}/config"},
+		{"plant1/temp", "plant1/temp"},
+		{"/devices/a1", "/devices/a1"},
+	}
+	for _, tt := range tests {
+		if got, collapsed := p.Normalize(tt.topic); got != tt.want || collapsed {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.topic, got, collapsed, tt.want)
+		}
+	}
+	if p.Patterns() != 1 {
+		t.Errorf("Patterns() = %d, want 1", p.Patterns())
+	}
+}
+
+func TestPatternCollapser_NestedLevels(t *testing.T) {
+	p := newPatternCollapser(5, 1000)
+
+	// Request IDs followed by timestamps collapse level by level
+	patterns := map[string]bool{}
+	for i := range 100 {
+		got, _ := p.Normalize(fmt.Sprintf("requests/req-%d/%d", i, 1700000000+i))
+		patterns[got] = true
+	}
+
+	if !patterns["requests/{id}/{id}"] || len(patterns) > 12 {
+		t.Errorf("expected requests/{id}/{id} after a few distinct topics, got %d patterns: %v", len(patterns), patterns)
+	}
+	if got, _ := p.Normalize("requests/req-x/1800000000"); got != "requests/{id}/{id}" {
+		t.Errorf("Normalize() after collapse = %q", got)
+	}
+	// Only requests, its {id} and that one's {id} are still counted
+	if p.counted != 3 || p.Patterns() != 2 {
+		t.Errorf("%d levels and %d patterns counted after collapsing, want 3 and 2", p.counted, p.Patterns())
+	}
+}
+
+func TestPatternCollapser_MaxChildren(t *testing.T) {
+	p := newPatternCollapser(2, 2)
+
+	// Only a and a/1 are counted, so b/ never collapses
+	for _, topic := range []string{"a/1", "b/1", "b/2", "b/3", "b/4"} {
+		if got, _ := p.Normalize(topic); got != topic {
+			t.Errorf("Normalize(%q) = %q", topic, got)
+		}
+	}
+
+	// The bound covers the children of every parent together
+	p = newPatternCollapser(1000, 50)
+	for i := range 200 {
+		p.Normalize(fmt.Sprintf("devices/d%d/status", i))
+	}
+	if p.counted > 50 {
+		t.Errorf("%d levels counted, want at most 50", p.counted)
+	}
+}
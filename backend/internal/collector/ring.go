@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"strconv"
+)
+
+// Consistent hash ring assigning broker IDs to collector instances. Every
+// instance is placed at several virtual points so brokers spread evenly, and
+// adding or removing an instance only moves the brokers next to its points
+type Ring struct {
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint64
+	member string
+}
+
+func NewRing(members []string, virtualNodes int) *Ring {
+	r := &Ring{points: make([]ringPoint, 0, len(members)*virtualNodes)}
+	for _, member := range members {
+		for i := range virtualNodes {
+			r.points = append(r.points, ringPoint{hash: ringHash(member + "#" + strconv.Itoa(i)), member: member})
+		}
+	}
+	// Ties are broken by name so every instance builds the same ring
+	slices.SortFunc(r.points, func(a, b ringPoint) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.member, b.member))
+	})
+	return r
+}
+
+// Returns the member owning the key: the first point at or after the key's
+// hash, wrapping around. Empty when the ring has no members
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := ringHash(key)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p ringPoint, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].member
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
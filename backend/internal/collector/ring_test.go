@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing_Owner(t *testing.T) {
+	if owner := NewRing(nil, 64).Owner("broker1"); owner != "" {
+		t.Errorf("empty ring Owner() = %q", owner)
+	}
+
+	members := []string{"collector-a", "collector-b", "collector-c"}
+	ring := NewRing(members, 64)
+	// Member order must not matter, every instance builds the same ring
+	reordered := NewRing([]string{"collector-c", "collector-a", "collector-b"}, 64)
+
+	counts := map[string]int{}
+	keys := make([]string, 300)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("broker-%d", i)
+		owner := ring.Owner(keys[i])
+		if owner != reordered.Owner(keys[i]) {
+			t.Fatalf("Owner(%s) depends on member order", keys[i])
+		}
+		counts[owner]++
+	}
+	for _, m := range members {
+		if counts[m] < 50 || counts[m] > 150 {
+			t.Errorf("%s owns %d of %d brokers, expected an even spread: %v", m, counts[m], len(keys), counts)
+		}
+	}
+
+	// A new member only takes brokers over, the others keep theirs
+	grown := NewRing(append(members, "collector-d"), 64)
+	moved := 0
+	for _, key := range keys {
+		before, after := ring.Owner(key), grown.Owner(key)
+		if before != after {
+			moved++
+			if after != "collector-d" {
+				t.Errorf("Owner(%s) moved from %s to %s", key, before, after)
+			}
+		}
+	}
+	if moved == 0 || moved > len(keys)/2 {
+		t.Errorf("%d of %d brokers moved after adding a member", moved, len(keys))
+	}
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+// How long a stopping instance waits for the server to release its leases
+const releaseTimeout = 5 * time.Second
+
+// What the shard loop knows from its last successful lease renewal
+type shardState struct {
+	members []string
+	// renewed is when the last successful renewal was sent; the leases it
+	// returned expire no earlier than renewed plus the lease TTL
+	renewed time.Time
+}
+
+// Renews this instance's leases every renew interval until ctx is done and
+// collects the brokers it was granted. Brokers are split by consistent
+// hashing of their IDs over the live instances, so when an instance joins or
+// its lease expires only the brokers next to it on the ring move
+func (mc *MultiCollector) runShard(ctx context.Context, deadline time.Time, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(mc.shard.RenewInterval)
+	defer ticker.Stop()
+
+	// The leases are given up when they run out, even while a renewal is
+	// still pending
+	var expiry *time.Timer
+	var expires time.Time
+	defer func() {
+		if expiry != nil {
+			expiry.Stop()
+		}
+	}()
+
+	var state shardState
+	for {
+		mc.rebalance(ctx, &state, deadline, wg)
+		if renewed := state.renewed.Add(mc.shard.LeaseTTL); !state.renewed.IsZero() && !renewed.Equal(expires) {
+			expires = renewed
+			if expiry == nil {
+				expiry = time.AfterFunc(time.Until(expires), func() { mc.expireLease() })
+			} else {
+				expiry.Reset(time.Until(expires))
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Renews the leases on the brokers this instance owns on the ring of the
+// last known members. A renewal that reports different members is repeated
+// with the new ring, so a membership change settles within one round
+func (mc *MultiCollector) rebalance(ctx context.Context, state *shardState, deadline time.Time, wg *sync.WaitGroup) {
+	for range 2 {
+		wanted := mc.ownedBrokers(state.members)
+		// Brokers moving away are disconnected before their leases are
+		// released, so two instances never collect one broker at once
+		mc.stopBrokersExcept(wanted)
+
+		sent := time.Now()
+		lease, err := mc.dbClient.RenewLease(ctx, mc.shard.InstanceID, wanted, mc.shard.LeaseTTL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.LeaseRenewErrors.Inc()
+			slog.Warn("Failed to renew collector lease", "instance_id", mc.shard.InstanceID, "error", err)
+			if mc.expireLease() {
+				state.members = nil
+			}
+			return
+		}
+
+		state.renewed = sent
+		mc.applyLease(lease.Brokers, sent.Add(mc.shard.LeaseTTL), deadline, wg)
+
+		changed := !slices.Equal(lease.Members, state.members)
+		if changed {
+			slog.Info("Collector membership changed", "instance_id", mc.shard.InstanceID, "members", lease.Members)
+		}
+		state.members = lease.Members
+		if !changed {
+			return
+		}
+	}
+}
+
+// Returns the IDs of the configured brokers this instance owns on the ring.
+// Shared brokers are collected by every instance and never leased
+func (mc *MultiCollector) ownedBrokers(members []string) []string {
+	ring := NewRing(members, mc.shard.VirtualNodes)
+	owned := []string{}
+	for _, broker := range mc.brokers {
+		if broker.SharedGroup == "" && ring.Owner(broker.ID) == mc.shard.InstanceID {
+			owned = append(owned, broker.ID)
+		}
+	}
+	return owned
+}
+
+// Stops the running leased brokers not in keep
+func (mc *MultiCollector) stopBrokersExcept(keep []string) {
+	mc.mu.Lock()
+	var stop []string
+	for id := range mc.stops {
+		if mc.collectors[id].claim == nil && !slices.Contains(keep, id) {
+			stop = append(stop, id)
+		}
+	}
+	mc.mu.Unlock()
+
+	for _, id := range stop {
+		slog.Info("Broker moved to another collector", "broker_id", id)
+		mc.stopBroker(id)
+	}
+}
+
+// Collects exactly the granted brokers, besides the shared ones, until the
+// deadline or until their leases expire
+func (mc *MultiCollector) applyLease(granted []string, expires, deadline time.Time, wg *sync.WaitGroup) {
+	mc.leaseMu.Lock()
+	defer mc.leaseMu.Unlock()
+
+	mc.leaseExpires = expires
+	mc.stopBrokersExcept(granted)
+
+	assigned := make([]config.BrokerConfig, 0, len(granted))
+	for _, broker := range mc.brokers {
+		if broker.SharedGroup != "" || slices.Contains(granted, broker.ID) {
+			assigned = append(assigned, broker)
+		}
+	}
+
+	mc.mu.Lock()
+	mc.assigned = assigned
+	var start []config.BrokerConfig
+	for _, broker := range assigned {
+		if _, running := mc.stops[broker.ID]; !running {
+			start = append(start, broker)
+		}
+	}
+	mc.mu.Unlock()
+	metrics.BrokersLeased.Set(float64(len(granted)))
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return
+	}
+	for _, broker := range start {
+		slog.Info("Broker assigned to this collector", "broker_id", broker.ID)
+		mc.startBroker(broker, remaining, wg)
+	}
+}
+
+// Stops every leased broker once the leases of the last successful renewal
+// have run out. Reports whether they have, which is also the case when no
+// leases were held
+func (mc *MultiCollector) expireLease() bool {
+	mc.leaseMu.Lock()
+	defer mc.leaseMu.Unlock()
+
+	if mc.leaseExpires.IsZero() {
+		return true
+	}
+	if time.Now().Before(mc.leaseExpires) {
+		return false
+	}
+
+	slog.Warn("Collector lease expired, stopping all brokers", "instance_id", mc.shard.InstanceID)
+	mc.leaseExpires = time.Time{}
+	mc.stopBrokersExcept(nil)
+
+	mc.mu.Lock()
+	mc.assigned = sharedBrokers(mc.brokers)
+	mc.mu.Unlock()
+	metrics.BrokersLeased.Set(0)
+	return true
+}
+
+// Gives up this instance's leases so other instances take its brokers over
+// without waiting for them to expire
+func (mc *MultiCollector) releaseLease() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := mc.dbClient.ReleaseLease(ctx, mc.shard.InstanceID); err != nil {
+		slog.Warn("Failed to release collector lease", "instance_id", mc.shard.InstanceID, "error", err)
+		return
+	}
+	slog.Info("Released collector lease", "instance_id", mc.shard.InstanceID)
+}
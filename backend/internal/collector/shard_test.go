@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Lease endpoint that reports fixed members and grants every requested broker
+type leaseServer struct {
+	mu       sync.Mutex
+	members  []string
+	failing  bool
+	requests [][]string
+	released bool
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodDelete {
+		s.released = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if s.failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var req models.LeaseRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.requests = append(s.requests, req.Brokers)
+	json.NewEncoder(w).Encode(models.LeaseResponse{InstanceID: r.PathValue("instance_id"), Members: s.members, Brokers: req.Brokers})
+}
+
+func TestMultiCollector_Rebalance(t *testing.T) {
+	ls := &leaseServer{members: []string{"collector-a", "collector-b"}}
+	server := httptest.NewServer(ls)
+	defer server.Close()
+
+	var brokers []config.BrokerConfig
+	for _, id := range []string{"broker1", "broker2", "broker3", "broker4", "broker5", "broker6"} {
+		// Nothing listens there, so the collectors fail to connect and exit
+		brokers = append(brokers, config.BrokerConfig{ID: id, URL: "tcp://127.0.0.1:1"})
+	}
+	mc := NewMultiCollector(&config.CollectorConfig{
+		Brokers:      brokers,
+		DBServiceURL: server.URL,
+		Shard:        config.ShardConfig{Enabled: true, InstanceID: "collector-a", LeaseTTL: 30 * time.Second, VirtualNodes: 64},
+	})
+	defer mc.cancel()
+
+	assigned := func() []string {
+		var ids []string
+		for _, s := range mc.Statuses() {
+			ids = append(ids, s.BrokerID)
+		}
+		return ids
+	}
+
+	var wg sync.WaitGroup
+	var state shardState
+	deadline := time.Now().Add(time.Minute)
+
+	// The first renewal learns the members, the second claims the brokers
+	mc.rebalance(context.Background(), &state, deadline, &wg)
+	owned := mc.ownedBrokers(ls.members)
+	if len(ls.requests) != 2 || len(ls.requests[0]) != 0 || !slices.Equal(ls.requests[1], owned) {
+		t.Fatalf("lease requests = %v, want [] then %v", ls.requests, owned)
+	}
+	if len(owned) == 0 || len(owned) == len(brokers) {
+		t.Fatalf("collector-a owns %v of two members' brokers", owned)
+	}
+	if !slices.Equal(assigned(), owned) {
+		t.Errorf("assigned = %v, want %v", assigned(), owned)
+	}
+
+	// collector-b's lease expired, so collector-a takes every broker
+	ls.members = []string{"collector-a"}
+	mc.rebalance(context.Background(), &state, deadline, &wg)
+	if len(assigned()) != len(brokers) {
+		t.Errorf("assigned after failover = %v", assigned())
+	}
+
+	// Without renewals the leases run out and the brokers are given up
+	ls.failing = true
+	mc.rebalance(context.Background(), &state, deadline, &wg)
+	if len(assigned()) != len(brokers) {
+		t.Errorf("brokers given up before the lease expired: %v", assigned())
+	}
+	mc.leaseExpires = time.Now().Add(-time.Second)
+	mc.rebalance(context.Background(), &state, deadline, &wg)
+	if len(assigned()) != 0 || len(mc.stops) != 0 {
+		t.Errorf("assigned after lease expiry = %v", assigned())
+	}
+
+	mc.releaseLease()
+	if !ls.released {
+		t.Error("lease was not released")
+	}
+	wg.Wait()
+}
+
+// Lease endpoint that answers the first renewal and then hangs until released
+type stallingLeaseServer struct {
+	calls   chan struct{}
+	release chan struct{}
+}
+
+func (s *stallingLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var req models.LeaseRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	select {
+	case s.calls <- struct{}{}:
+	default:
+		<-s.release
+	}
+	json.NewEncoder(w).Encode(models.LeaseResponse{InstanceID: r.PathValue("instance_id"), Members: []string{"collector-a"}, Brokers: req.Brokers})
+}
+
+func TestMultiCollector_LeaseExpiresDuringRenewal(t *testing.T) {
+	ls := &stallingLeaseServer{calls: make(chan struct{}, 2), release: make(chan struct{})}
+	server := httptest.NewServer(ls)
+	defer server.Close()
+	defer close(ls.release)
+
+	mc := NewMultiCollector(&config.CollectorConfig{
+		Brokers:      []config.BrokerConfig{{ID: "broker1", URL: "tcp://127.0.0.1:1"}},
+		DBServiceURL: server.URL,
+		Shard:        config.ShardConfig{Enabled: true, InstanceID: "collector-a", LeaseTTL: 300 * time.Millisecond, RenewInterval: 100 * time.Millisecond, VirtualNodes: 64},
+	})
+	defer mc.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mc.runShard(ctx, time.Now().Add(time.Minute), &wg)
+	}()
+
+	running := func() int {
+		mc.mu.Lock()
+		defer mc.mu.Unlock()
+		return len(mc.stops)
+	}
+
+	// The first two renewals learn the members and lease broker1, every
+	// later one hangs past the lease TTL
+	waitFor(t, func() bool { return running() == 1 })
+	waitFor(t, func() bool { return running() == 0 })
+	if len(mc.Statuses()) != 0 {
+		t.Errorf("assigned after lease expiry = %+v", mc.Statuses())
+	}
+
+	cancel()
+	<-done
+	wg.Wait()
+}
+
+// Polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("condition not met within a second")
+		}
+	}
+}
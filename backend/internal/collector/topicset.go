@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"container/list"
+	"time"
+)
+
+// Set of sampled topics holding at most max entries; adding to a full set
+// forgets the least recently seen topic
+type topicSet struct {
+	max   int
+	order *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type topicEntry struct {
+	topic string
+	// retryAt, when set, reports the topic as new again once it has passed
+	retryAt time.Time
+}
+
+func newTopicSet(max int) *topicSet {
+	return &topicSet{max: max, order: list.New(), items: make(map[string]*list.Element), now: time.Now}
+}
+
+// Marks the topic as seen and reports whether it was new, and whether an
+// older topic had to be forgotten to make room
+func (s *topicSet) Add(topic string) (added, evicted bool) {
+	if e, ok := s.items[topic]; ok {
+		s.order.MoveToFront(e)
+		entry := e.Value.(*topicEntry)
+		if entry.retryAt.IsZero() || s.now().Before(entry.retryAt) {
+			return false, false
+		}
+		entry.retryAt = time.Time{}
+		return true, false
+	}
+
+	s.items[topic] = s.order.PushFront(&topicEntry{topic: topic})
+	if s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*topicEntry).topic)
+		evicted = true
+	}
+	return true, evicted
+}
+
+// Has Add report a tracked topic as new again once at has passed, so a topic
+// that was not sampled is retried without asking on every message
+func (s *topicSet) RetryAt(topic string, at time.Time) {
+	if e, ok := s.items[topic]; ok {
+		e.Value.(*topicEntry).retryAt = at
+	}
+}
+
+func (s *topicSet) Len() int {
+	return s.order.Len()
+}
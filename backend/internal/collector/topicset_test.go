@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicSet(t *testing.T) {
+	s := newTopicSet(2)
+
+	steps := []struct {
+		topic       string
+		wantAdded   bool
+		wantEvicted bool
+	}{
+		{"a", true, false},
+		{"b", true, false},
+		{"a", false, false},
+		// b is the least recently seen and makes room for c
+		{"c", true, true},
+		{"a", false, false},
+		{"b", true, true},
+		{"c", true, true},
+	}
+
+	for i, step := range steps {
+		added, evicted := s.Add(step.topic)
+		if added != step.wantAdded || evicted != step.wantEvicted {
+			t.Errorf("step %d: Add(%q) = %v, %v, want %v, %v", i, step.topic, added, evicted, step.wantAdded, step.wantEvicted)
+		}
+		if s.Len() > 2 {
+			t.Fatalf("step %d: Len() = %d, exceeds the limit", i, s.Len())
+		}
+	}
+}
+
+func TestTopicSet_RetryAt(t *testing.T) {
+	now := time.Now()
+	s := newTopicSet(10)
+	s.now = func() time.Time { return now }
+
+	s.Add("a")
+	s.RetryAt("a", now.Add(time.Minute))
+	if added, _ := s.Add("a"); added {
+		t.Error("Add() before the retry time reported the topic as new")
+	}
+
+	now = now.Add(time.Minute)
+	if added, _ := s.Add("a"); !added {
+		t.Error("Add() after the retry time did not report the topic as new")
+	}
+	// The retry is used up once reported
+	if added, _ := s.Add("a"); added {
+		t.Error("Add() reported the topic as new twice")
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type APIKeyConfig struct {
+	Name string `json:"name"`
+	// SHA256 is the hex-encoded SHA-256 hash of the key, never the key itself
+	SHA256 string   `json:"sha256"`
+	Scopes []string `json:"scopes"`
+}
+
+type JWTConfig struct {
+	JWKSFile string `json:"jwks_file"`
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	// Claim holding the scopes as a space-separated string or an array,
+	// "scope" when empty
+	ScopeClaim string `json:"scope_claim,omitempty"`
+}
+
+type AuthConfig struct {
+	Enabled bool
+	APIKeys []APIKeyConfig `json:"api_keys"`
+	// DatabaseKeys also accepts keys whose hashes are stored in api_keys
+	DatabaseKeys bool       `json:"database_keys"`
+	JWT          *JWTConfig `json:"jwt,omitempty"`
+}
+
+// Reads the auth config from the JSON file in AUTH_CONFIG. Authentication
+// stays disabled when the variable is unset
+func loadAuthConfig() (AuthConfig, error) {
+	var cfg AuthConfig
+
+	path := getEnv("AUTH_CONFIG", "")
+	if path == "" {
+		return cfg, nil
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read auth file: %w", err)
+	}
+
+	if err := json.Unmarshal(file, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse auth file: %w", err)
+	}
+
+	for i, k := range cfg.APIKeys {
+		// Keys are matched against lowercase hex digests
+		hash := strings.ToLower(k.SHA256)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+			return cfg, fmt.Errorf("api key %q: sha256 must be a hex-encoded SHA-256 hash", k.Name)
+		}
+		cfg.APIKeys[i].SHA256 = hash
+	}
+
+	if cfg.JWT != nil && cfg.JWT.JWKSFile == "" {
+		return cfg, fmt.Errorf("jwt: jwks_file is required")
+	}
+
+	if len(cfg.APIKeys) == 0 && !cfg.DatabaseKeys && cfg.JWT == nil {
+		return cfg, fmt.Errorf("auth file configures no api keys, database keys or jwt")
+	}
+
+	cfg.Enabled = true
+	return cfg, nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Bounds the topics a collector tracks per broker on brokers that put IDs or
+// timestamps into topic names
+type CardinalityConfig struct {
+	// MaxTopics caps the sampled topics remembered per broker; the least
+	// recently seen are forgotten and sampled again when they reappear
+	MaxTopics int
+	// PatternThreshold is the number of distinct values of a topic level
+	// below one parent after which the level is collapsed into {id}, zero
+	// disables collapsing
+	PatternThreshold int
+}
+
+func loadCardinalityConfig() (CardinalityConfig, error) {
+	var cfg CardinalityConfig
+	var err error
+
+	if cfg.MaxTopics, err = strconv.Atoi(getEnv("COLLECTOR_MAX_TRACKED_TOPICS", "100000")); err != nil || cfg.MaxTopics < 1 {
+		return cfg, fmt.Errorf("invalid COLLECTOR_MAX_TRACKED_TOPICS: must be a positive integer")
+	}
+	if cfg.PatternThreshold, err = strconv.Atoi(getEnv("COLLECTOR_PATTERN_THRESHOLD", "0")); err != nil || cfg.PatternThreshold < 0 {
+		return cfg, fmt.Errorf("invalid COLLECTOR_PATTERN_THRESHOLD: must be a non-negative integer")
+	}
+	return cfg, nil
+}
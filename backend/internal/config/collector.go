@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -15,12 +16,38 @@ type BrokerConfig struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
 	ClientID string `json:"client_id,omitempty"`
+	// SharedGroup subscribes through the MQTT shared subscription
+	// $share/<group>/# so collector instances split the broker's messages
+	SharedGroup string `json:"shared_group,omitempty"`
+}
+
+// Returns the topic filter the collector subscribes to
+func (b BrokerConfig) Subscription() string {
+	if b.SharedGroup == "" {
+		return "#"
+	}
+	return "$share/" + b.SharedGroup + "/#"
 }
 
 type CollectorConfig struct {
-	Brokers            []BrokerConfig
-	DBServiceURL       string
+	Brokers      []BrokerConfig
+	DBServiceURL string
+	// Credentials sent to the database service when it requires authentication
+	DBServiceAPIKey    string
+	DBServiceToken     string
 	CollectionDuration time.Duration
+	// AdminAddr is the listen address for /metrics and /health, empty disables it
+	AdminAddr string
+	// DisconnectGrace is how long a broker may stay disconnected before
+	// the liveness check fails
+	DisconnectGrace time.Duration
+	// KnownTopicsMaxAge makes a starting collector skip topics the catalog
+	// saw this recently instead of sampling them again, zero disables it
+	KnownTopicsMaxAge time.Duration
+	Scan              ScanConfig
+	Shard             ShardConfig
+	Cardinality       CardinalityConfig
+	Log               LogConfig
 }
 
 // Reads broker config from JSON file and environment variables with fallback defaults
@@ -28,21 +55,58 @@ func LoadCollectorConfig() (*CollectorConfig, error) {
 	configPath := getEnv("BROKERS_CONFIG", "brokers.json")
 	dbServiceURL := getEnv("DB_SERVICE_URL", "http://localhost:8080")
 	durationStr := getEnv("COLLECTION_DURATION", "1m")
+	adminAddr := getEnv("ADMIN_ADDR", "")
+	graceStr := getEnv("HEALTH_DISCONNECT_GRACE", "5m")
+	knownStr := getEnv("COLLECTOR_KNOWN_TOPICS_MAX_AGE", "0")
 
 	duration, err := time.ParseDuration(durationStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid duration: %w", err)
 	}
 
+	grace, err := time.ParseDuration(graceStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid disconnect grace: %w", err)
+	}
+
+	knownMaxAge, err := time.ParseDuration(knownStr)
+	if err != nil || knownMaxAge < 0 {
+		return nil, fmt.Errorf("invalid COLLECTOR_KNOWN_TOPICS_MAX_AGE %q", knownStr)
+	}
+
 	brokers, err := loadBrokersConfig(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("load brokers config: %w", err)
 	}
 
+	scan, err := loadScanConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	shard, err := loadShardConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cardinality, err := loadCardinalityConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	return &CollectorConfig{
 		Brokers:            brokers,
 		DBServiceURL:       dbServiceURL,
+		DBServiceAPIKey:    getEnv("DB_SERVICE_API_KEY", ""),
+		DBServiceToken:     getEnv("DB_SERVICE_TOKEN", ""),
 		CollectionDuration: duration,
+		AdminAddr:          adminAddr,
+		DisconnectGrace:    grace,
+		KnownTopicsMaxAge:  knownMaxAge,
+		Scan:               scan,
+		Shard:              shard,
+		Cardinality:        cardinality,
+		Log:                loadLogConfig(),
 	}, nil
 }
 
@@ -58,5 +122,12 @@ func loadBrokersConfig(configPath string) ([]BrokerConfig, error) {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
+	for _, b := range brokers {
+		// Share names are a single topic level without wildcards
+		if strings.ContainsAny(b.SharedGroup, "/+#") {
+			return nil, fmt.Errorf("broker %s: invalid shared_group %q", b.ID, b.SharedGroup)
+		}
+	}
+
 	return brokers, nil
 }
@@ -3,6 +3,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -111,3 +112,223 @@ func TestLoad(t *testing.T) {
 		t.Errorf("expected 1 broker, got %d", len(cfg.Brokers))
 	}
 }
+
+func TestLoadCollectorConfigKnownTopics(t *testing.T) {
+	brokers := filepath.Join(t.TempDir(), "brokers.json")
+	if err := os.WriteFile(brokers, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		maxAge  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"disabled by default", "", 0, false},
+		{"max age", "6h", 6 * time.Hour, false},
+		{"negative", "-1h", 0, true},
+		{"not a duration", "six hours", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROKERS_CONFIG", brokers)
+			t.Setenv("COLLECTOR_KNOWN_TOPICS_MAX_AGE", tt.maxAge)
+
+			cfg, err := LoadCollectorConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCollectorConfig() error = %v", err)
+			}
+			if cfg.KnownTopicsMaxAge != tt.want {
+				t.Errorf("KnownTopicsMaxAge = %v, want %v", cfg.KnownTopicsMaxAge, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfigCardinality(t *testing.T) {
+	brokers := filepath.Join(t.TempDir(), "brokers.json")
+	if err := os.WriteFile(brokers, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    CardinalityConfig
+		wantErr bool
+	}{
+		{"defaults", nil, CardinalityConfig{MaxTopics: 100000}, false},
+		{"patterns", map[string]string{"COLLECTOR_MAX_TRACKED_TOPICS": "5000", "COLLECTOR_PATTERN_THRESHOLD": "200"}, CardinalityConfig{MaxTopics: 5000, PatternThreshold: 200}, false},
+		{"no tracked topics", map[string]string{"COLLECTOR_MAX_TRACKED_TOPICS": "0"}, CardinalityConfig{}, true},
+		{"negative threshold", map[string]string{"COLLECTOR_PATTERN_THRESHOLD": "-1"}, CardinalityConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROKERS_CONFIG", brokers)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := LoadCollectorConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCollectorConfig() error = %v", err)
+			}
+			if cfg.Cardinality != tt.want {
+				t.Errorf("Cardinality = %+v, want %+v", cfg.Cardinality, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfigSharedGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		brokers string
+		want    string
+		wantErr bool
+	}{
+		{"plain subscription", `[{"id": "b1", "url": "tcp://localhost:1883"}]`, "#", false},
+		{"shared subscription", `[{"id": "b1", "url": "tcp://localhost:1883", "shared_group": "catalog"}]`, "$share/catalog/#", false},
+		{"group with level separator", `[{"id": "b1", "url": "tcp://localhost:1883", "shared_group": "a/b"}]`, "", true},
+		{"group with wildcard", `[{"id": "b1", "url": "tcp://localhost:1883", "shared_group": "a+"}]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "brokers.json")
+			if err := os.WriteFile(path, []byte(tt.brokers), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("BROKERS_CONFIG", path)
+
+			cfg, err := LoadCollectorConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCollectorConfig() error = %v", err)
+			}
+			if got := cfg.Brokers[0].Subscription(); got != tt.want {
+				t.Errorf("Subscription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfigScan(t *testing.T) {
+	brokers := filepath.Join(t.TempDir(), "brokers.json")
+	if err := os.WriteFile(brokers, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		patterns  string
+		wantErr   bool
+		detectors int
+	}{
+		{"defaults", nil, "", false, len(ScanDetectors)},
+		{"detector subset", map[string]string{"PAYLOAD_SCAN_DETECTORS": "email, jwt"}, "", false, 2},
+		{"unknown detector", map[string]string{"PAYLOAD_SCAN_DETECTORS": "email,ssn"}, "", true, 0},
+		{"bad entropy", map[string]string{"PAYLOAD_SCAN_ENTROPY": "0"}, "", true, 0},
+		{"custom pattern", nil, `{"patterns": [{"name": "employee_id", "pattern": "EMP-\\d{6}"}]}`, false, len(ScanDetectors)},
+		{"pattern shadows detector", nil, `{"patterns": [{"name": "email", "pattern": "x+"}]}`, true, 0},
+		{"bad pattern name", nil, `{"patterns": [{"name": "Employee ID", "pattern": "x+"}]}`, true, 0},
+		{"bad pattern", nil, `{"patterns": [{"name": "a", "pattern": "("}]}`, true, 0},
+		{"empty match", nil, `{"patterns": [{"name": "a", "pattern": "x*"}]}`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROKERS_CONFIG", brokers)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if tt.patterns != "" {
+				path := filepath.Join(t.TempDir(), "scan.json")
+				if err := os.WriteFile(path, []byte(tt.patterns), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("PAYLOAD_SCAN_CONFIG", path)
+			}
+
+			cfg, err := LoadCollectorConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCollectorConfig() error = %v", err)
+			}
+			if !cfg.Scan.Enabled || cfg.Scan.Redact || len(cfg.Scan.Detectors) != tt.detectors {
+				t.Errorf("unexpected scan config %+v", cfg.Scan)
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfigShard(t *testing.T) {
+	brokers := filepath.Join(t.TempDir(), "brokers.json")
+	if err := os.WriteFile(brokers, []byte(`[]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantErr  bool
+		instance string
+	}{
+		{"disabled", nil, false, hostname},
+		{"enabled", map[string]string{"COLLECTOR_SHARDING": "true", "COLLECTOR_INSTANCE_ID": "collector-0"}, false, "collector-0"},
+		{"ttl too short", map[string]string{"COLLECTOR_SHARDING": "true", "COLLECTOR_LEASE_TTL": "1s"}, true, ""},
+		{"fractional ttl", map[string]string{"COLLECTOR_SHARDING": "true", "COLLECTOR_LEASE_TTL": "7500ms"}, true, ""},
+		{"renew too slow", map[string]string{"COLLECTOR_SHARDING": "true", "COLLECTOR_LEASE_RENEW_INTERVAL": "20s"}, true, ""},
+		{"no virtual nodes", map[string]string{"COLLECTOR_SHARDING": "true", "COLLECTOR_VIRTUAL_NODES": "0"}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROKERS_CONFIG", brokers)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := LoadCollectorConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCollectorConfig() error = %v", err)
+			}
+			if cfg.Shard.InstanceID != tt.instance || cfg.Shard.LeaseTTL != 30*time.Second || cfg.Shard.VirtualNodes != 64 {
+				t.Errorf("unexpected shard config %+v", cfg.Shard)
+			}
+		})
+	}
+}
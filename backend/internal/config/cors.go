@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Cross-origin policy for the API server. Origins are exact values such as
+// https://catalog.example.com, patterns with a single "*" such as
+// https://*.example.com, or "*" for any origin
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Reads the CORS policy from environment variables. Without
+// CORS_ALLOWED_ORIGINS no cross-origin request is allowed
+func loadCORSConfig() (CORSConfig, error) {
+	cfg := CORSConfig{
+		AllowedOrigins: splitList(getEnv("CORS_ALLOWED_ORIGINS", "")),
+		AllowedMethods: splitList(strings.ToUpper(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE"))),
+		AllowedHeaders: splitList(getEnv("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,X-Request-ID")),
+		ExposedHeaders: splitList(getEnv("CORS_EXPOSED_HEADERS", "X-Request-ID")),
+	}
+
+	switch v := getEnv("CORS_ALLOW_CREDENTIALS", "false"); v {
+	case "true":
+		cfg.AllowCredentials = true
+	case "false":
+	default:
+		return cfg, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS: %q", v)
+	}
+
+	var err error
+	if cfg.MaxAge, err = time.ParseDuration(getEnv("CORS_MAX_AGE", "10m")); err != nil {
+		return cfg, fmt.Errorf("invalid CORS_MAX_AGE: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c CORSConfig) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin != "*" && strings.Count(origin, "*") > 1 {
+			return fmt.Errorf("cors origin %q: at most one wildcard is allowed", origin)
+		}
+	}
+
+	// Browsers reject credentialed responses for a wildcard origin
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("cors: credentials cannot be allowed for origin \"*\"")
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors: max age must not be negative")
+	}
+	return nil
+}
+
+// Splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// A topic naming rule. Every check that is set must pass; a rule without
+// brokers applies to all of them
+type GovernanceRule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Severity    string   `json:"severity,omitempty"`
+	Brokers     []string `json:"brokers,omitempty"`
+	// Pattern is a regular expression the whole topic must match
+	Pattern  string `json:"pattern,omitempty"`
+	MinDepth int    `json:"min_depth,omitempty"`
+	MaxDepth int    `json:"max_depth,omitempty"`
+	// AllowedChars is the content of a character class such as a-z0-9_-
+	// that every level must consist of
+	AllowedChars     string   `json:"allowed_chars,omitempty"`
+	ReservedPrefixes []string `json:"reserved_prefixes,omitempty"`
+}
+
+type GovernanceConfig struct {
+	Rules []GovernanceRule `json:"rules"`
+}
+
+// Reads the naming rules from the JSON file in GOVERNANCE_CONFIG. Without
+// the file no rules apply
+func loadGovernanceConfig() (GovernanceConfig, error) {
+	var cfg GovernanceConfig
+
+	path := getEnv("GOVERNANCE_CONFIG", "")
+	if path == "" {
+		return cfg, nil
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read governance file: %w", err)
+	}
+
+	if err := json.Unmarshal(file, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse governance file: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *GovernanceConfig) validate() error {
+	names := map[string]bool{}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			return fmt.Errorf("governance rule %d: name is required", i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("governance rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityError
+		case SeverityError, SeverityWarning:
+		default:
+			return fmt.Errorf("governance rule %q: invalid severity %q, expected error or warning", r.Name, r.Severity)
+		}
+
+		if r.Pattern != "" {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("governance rule %q: invalid pattern: %w", r.Name, err)
+			}
+		}
+		if r.AllowedChars != "" {
+			if _, err := regexp.Compile("[^" + r.AllowedChars + "]"); err != nil {
+				return fmt.Errorf("governance rule %q: invalid allowed_chars: %w", r.Name, err)
+			}
+		}
+
+		if r.MinDepth < 0 || r.MaxDepth < 0 || (r.MaxDepth > 0 && r.MinDepth > r.MaxDepth) {
+			return fmt.Errorf("governance rule %q: invalid depth range", r.Name)
+		}
+
+		if r.Pattern == "" && r.AllowedChars == "" && r.MinDepth == 0 && r.MaxDepth == 0 && len(r.ReservedPrefixes) == 0 {
+			return fmt.Errorf("governance rule %q: no checks configured", r.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Request size, stored sample size and rate limits of the API server
+type LimitsConfig struct {
+	// MaxBodyBytes caps every request body, 0 disables the cap
+	MaxBodyBytes int64
+	// RouteMaxBodyBytes overrides MaxBodyBytes per route pattern,
+	// e.g. "POST /api/samples"
+	RouteMaxBodyBytes map[string]int64
+	// MaxSampleBytes caps stored sample payloads, 0 disables the cap
+	MaxSampleBytes int
+	// TruncateSamples stores oversized payloads cut to MaxSampleBytes instead
+	// of rejecting them
+	TruncateSamples bool
+	RateLimit       RateLimitConfig
+}
+
+// Token bucket applied per API key, bearer token or client IP
+type RateLimitConfig struct {
+	// RequestsPerSecond refills each bucket, 0 disables rate limiting
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// Returns the body size limit of the first route pattern with an override,
+// so a route can be configured by its current or legacy path
+func (c LimitsConfig) BodyLimitFor(patterns ...string) int64 {
+	for _, pattern := range patterns {
+		if limit, ok := c.RouteMaxBodyBytes[pattern]; ok {
+			return limit
+		}
+	}
+	return c.MaxBodyBytes
+}
+
+func loadLimitsConfig() (LimitsConfig, error) {
+	var cfg LimitsConfig
+	var err error
+
+	if cfg.MaxBodyBytes, err = parseByteSize(getEnv("MAX_BODY_BYTES", "4M")); err != nil {
+		return cfg, fmt.Errorf("invalid MAX_BODY_BYTES: %w", err)
+	}
+
+	if routes := getEnv("MAX_BODY_BYTES_ROUTES", ""); routes != "" {
+		cfg.RouteMaxBodyBytes = make(map[string]int64)
+		for _, entry := range splitList(routes) {
+			pattern, size, ok := strings.Cut(entry, "=")
+			if !ok {
+				return cfg, fmt.Errorf("invalid MAX_BODY_BYTES_ROUTES entry %q: expected PATTERN=SIZE", entry)
+			}
+			limit, err := parseByteSize(size)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid MAX_BODY_BYTES_ROUTES entry %q: %w", entry, err)
+			}
+			cfg.RouteMaxBodyBytes[strings.TrimSpace(pattern)] = limit
+		}
+	}
+
+	maxSample, err := parseByteSize(getEnv("MAX_SAMPLE_BYTES", "1M"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid MAX_SAMPLE_BYTES: %w", err)
+	}
+	cfg.MaxSampleBytes = int(maxSample)
+
+	if cfg.TruncateSamples, err = strconv.ParseBool(getEnv("TRUNCATE_SAMPLES", "true")); err != nil {
+		return cfg, fmt.Errorf("invalid TRUNCATE_SAMPLES: %w", err)
+	}
+
+	if cfg.RateLimit.RequestsPerSecond, err = strconv.ParseFloat(getEnv("RATE_LIMIT_RPS", "0"), 64); err != nil {
+		return cfg, fmt.Errorf("invalid RATE_LIMIT_RPS: %w", err)
+	}
+	if cfg.RateLimit.Burst, err = strconv.Atoi(getEnv("RATE_LIMIT_BURST", "20")); err != nil {
+		return cfg, fmt.Errorf("invalid RATE_LIMIT_BURST: %w", err)
+	}
+
+	if cfg.RateLimit.RequestsPerSecond < 0 || cfg.RateLimit.Burst < 1 {
+		return cfg, fmt.Errorf("rate limit must have a non-negative rate and a burst of at least 1")
+	}
+	return cfg, nil
+}
+
+// Parses sizes such as 512, 64K or 4M (binary multiples)
+func parseByteSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * multiplier, nil
+}
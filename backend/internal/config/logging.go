@@ -0,0 +1,14 @@
+package config
+
+// Output format (text or json) and minimum level shared by both binaries
+type LogConfig struct {
+	Format string
+	Level  string
+}
+
+func loadLogConfig() LogConfig {
+	return LogConfig{
+		Format: getEnv("LOG_FORMAT", "text"),
+		Level:  getEnv("LOG_LEVEL", "info"),
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Built-in payload detectors of the collector's scanning stage
+var ScanDetectors = []string{
+	"email", "phone", "gps", "credit_card",
+	"private_key", "aws_access_key", "jwt", "credential", "high_entropy",
+}
+
+var scanNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// A custom detector. Pattern is a regular expression; when it has a
+// capture group only the first group is flagged and redacted
+type ScanPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// Scanning of sampled payloads for PII and secrets before they are sent
+type ScanConfig struct {
+	Enabled bool
+	// Redact replaces matched spans in the sample with [REDACTED:<detector>]
+	Redact bool
+	// Detectors are the enabled built-in detectors, all of them by default
+	Detectors []string
+	// Tokens of at least EntropyMinLength characters whose Shannon entropy
+	// in bits per character reaches EntropyThreshold are flagged high_entropy
+	EntropyThreshold float64
+	EntropyMinLength int
+	// Patterns come from the JSON file in PAYLOAD_SCAN_CONFIG
+	Patterns []ScanPattern
+}
+
+func loadScanConfig() (ScanConfig, error) {
+	var cfg ScanConfig
+	var err error
+
+	if cfg.Enabled, err = strconv.ParseBool(getEnv("PAYLOAD_SCAN", "true")); err != nil {
+		return cfg, fmt.Errorf("invalid PAYLOAD_SCAN: %w", err)
+	}
+	if cfg.Redact, err = strconv.ParseBool(getEnv("PAYLOAD_REDACT", "false")); err != nil {
+		return cfg, fmt.Errorf("invalid PAYLOAD_REDACT: %w", err)
+	}
+	if cfg.EntropyThreshold, err = strconv.ParseFloat(getEnv("PAYLOAD_SCAN_ENTROPY", "4.2"), 64); err != nil {
+		return cfg, fmt.Errorf("invalid PAYLOAD_SCAN_ENTROPY: %w", err)
+	}
+	if cfg.EntropyMinLength, err = strconv.Atoi(getEnv("PAYLOAD_SCAN_ENTROPY_MIN_LENGTH", "20")); err != nil {
+		return cfg, fmt.Errorf("invalid PAYLOAD_SCAN_ENTROPY_MIN_LENGTH: %w", err)
+	}
+
+	cfg.Detectors = ScanDetectors
+	if list := getEnv("PAYLOAD_SCAN_DETECTORS", ""); list != "" {
+		cfg.Detectors = nil
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.Detectors = append(cfg.Detectors, name)
+			}
+		}
+	}
+
+	if path := getEnv("PAYLOAD_SCAN_CONFIG", ""); path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("read payload scan file: %w", err)
+		}
+		var custom struct {
+			Patterns []ScanPattern `json:"patterns"`
+		}
+		if err := json.Unmarshal(file, &custom); err != nil {
+			return cfg, fmt.Errorf("parse payload scan file: %w", err)
+		}
+		cfg.Patterns = custom.Patterns
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *ScanConfig) validate() error {
+	for _, name := range c.Detectors {
+		if !slices.Contains(ScanDetectors, name) {
+			return fmt.Errorf("unknown payload detector %q, expected one of %s", name, strings.Join(ScanDetectors, ", "))
+		}
+	}
+
+	if c.EntropyThreshold <= 0 || c.EntropyMinLength < 8 {
+		return fmt.Errorf("payload scan entropy threshold must be positive with a minimum length of at least 8")
+	}
+
+	names := map[string]bool{}
+	for i, p := range c.Patterns {
+		if !scanNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("payload scan pattern %d: name %q must be lowercase letters, digits and underscores", i+1, p.Name)
+		}
+		if names[p.Name] || slices.Contains(ScanDetectors, p.Name) {
+			return fmt.Errorf("payload scan pattern %q: duplicate name", p.Name)
+		}
+		names[p.Name] = true
+
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("payload scan pattern %q: invalid pattern: %w", p.Name, err)
+		}
+		if re.MatchString("") {
+			return fmt.Errorf("payload scan pattern %q: pattern matches the empty string", p.Name)
+		}
+	}
+	return nil
+}
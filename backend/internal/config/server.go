@@ -1,12 +1,69 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 )
 
 type ServerConfig struct {
 	ServerAddr  string
 	DatabaseURL string
+	Retention   RetentionConfig
+	Auth        AuthConfig
+	CORS        CORSConfig
+	Limits      LimitsConfig
+	Stream      StreamConfig
+	Tail        TailConfig
+	Governance  GovernanceConfig
+	Webhooks    WebhookConfig
+	// Scan flags and, with PAYLOAD_REDACT, redacts live tail payloads
+	Scan ScanConfig
+	Log  LogConfig
+}
+
+// Number of days after which a topic without new samples is considered stale
+// or removed from the catalog. Zero disables the step
+type RetentionPolicy struct {
+	StaleAfterDays int `json:"stale_after_days"`
+	PurgeAfterDays int `json:"purge_after_days"`
+}
+
+// Marks a per-broker retention step as disabled, overriding the default
+const RetentionDisabled = -1
+
+type RetentionConfig struct {
+	Default RetentionPolicy
+	// Per-broker overrides, zero fields inherit the default and
+	// RetentionDisabled fields turn the step off
+	Brokers       map[string]RetentionPolicy
+	PurgeInterval time.Duration
+	// StaleCheckInterval is how often topics that crossed their stale
+	// threshold are announced as topic.stale events
+	StaleCheckInterval time.Duration
+}
+
+// Returns the effective policy for a broker, in which disabled steps are zero
+func (c RetentionConfig) PolicyFor(brokerID string) RetentionPolicy {
+	policy := c.Default
+	if override, ok := c.Brokers[brokerID]; ok {
+		policy.StaleAfterDays = overrideDays(policy.StaleAfterDays, override.StaleAfterDays)
+		policy.PurgeAfterDays = overrideDays(policy.PurgeAfterDays, override.PurgeAfterDays)
+	}
+	return policy
+}
+
+// Applies one per-broker retention override to the default days
+func overrideDays(days, override int) int {
+	switch override {
+	case 0:
+		return days
+	case RetentionDisabled:
+		return 0
+	}
+	return override
 }
 
 func LoadServerConfig() (*ServerConfig, error) {
@@ -19,8 +76,128 @@ func LoadServerConfig() (*ServerConfig, error) {
 		databaseURL = fmt.Sprintf("file:%s?cache=shared&mode=rwc", databaseURL)
 	}
 
+	retention, err := loadRetentionConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load retention config: %w", err)
+	}
+
+	auth, err := loadAuthConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load auth config: %w", err)
+	}
+
+	cors, err := loadCORSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load cors config: %w", err)
+	}
+
+	limits, err := loadLimitsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load limits config: %w", err)
+	}
+
+	stream, err := loadStreamConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load stream config: %w", err)
+	}
+
+	tail, err := loadTailConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load tail config: %w", err)
+	}
+
+	governance, err := loadGovernanceConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load governance config: %w", err)
+	}
+
+	webhooks, err := loadWebhookConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load webhook config: %w", err)
+	}
+
+	scan, err := loadScanConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	return &ServerConfig{
 		ServerAddr:  serverAddr,
 		DatabaseURL: databaseURL,
+		Retention:   retention,
+		Auth:        auth,
+		CORS:        cors,
+		Limits:      limits,
+		Stream:      stream,
+		Tail:        tail,
+		Governance:  governance,
+		Webhooks:    webhooks,
+		Scan:        scan,
+		Log:         loadLogConfig(),
 	}, nil
 }
+
+// Reads the global retention policy from environment variables and optional
+// per-broker overrides from the JSON file in RETENTION_CONFIG
+func loadRetentionConfig() (RetentionConfig, error) {
+	var cfg RetentionConfig
+	var err error
+
+	if cfg.Default.StaleAfterDays, err = strconv.Atoi(getEnv("RETENTION_STALE_DAYS", "7")); err != nil {
+		return cfg, fmt.Errorf("invalid RETENTION_STALE_DAYS: %w", err)
+	}
+	if cfg.Default.PurgeAfterDays, err = strconv.Atoi(getEnv("RETENTION_PURGE_DAYS", "0")); err != nil {
+		return cfg, fmt.Errorf("invalid RETENTION_PURGE_DAYS: %w", err)
+	}
+	if cfg.PurgeInterval, err = time.ParseDuration(getEnv("RETENTION_PURGE_INTERVAL", "1h")); err != nil {
+		return cfg, fmt.Errorf("invalid RETENTION_PURGE_INTERVAL: %w", err)
+	}
+	if cfg.StaleCheckInterval, err = time.ParseDuration(getEnv("RETENTION_STALE_CHECK_INTERVAL", "5m")); err != nil {
+		return cfg, fmt.Errorf("invalid RETENTION_STALE_CHECK_INTERVAL: %w", err)
+	}
+
+	if path := getEnv("RETENTION_CONFIG", ""); path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("read retention file: %w", err)
+		}
+
+		var overrides struct {
+			Brokers map[string]RetentionPolicy `json:"brokers"`
+		}
+		if err := json.Unmarshal(file, &overrides); err != nil {
+			return cfg, fmt.Errorf("parse retention file: %w", err)
+		}
+		cfg.Brokers = overrides.Brokers
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (c RetentionConfig) validate() error {
+	policies := map[string]RetentionPolicy{"default": c.Default}
+	for id, override := range c.Brokers {
+		if override.StaleAfterDays < RetentionDisabled || override.PurgeAfterDays < RetentionDisabled {
+			return fmt.Errorf("broker %s retention: days must not be negative, except -1 to disable", id)
+		}
+		policies["broker "+id] = c.PolicyFor(id)
+	}
+
+	for name, p := range policies {
+		if p.StaleAfterDays < 0 || p.PurgeAfterDays < 0 {
+			return fmt.Errorf("%s retention: days must not be negative", name)
+		}
+		if p.PurgeAfterDays > 0 && p.StaleAfterDays > p.PurgeAfterDays {
+			return fmt.Errorf("%s retention: stale_after_days exceeds purge_after_days", name)
+		}
+	}
+
+	if c.PurgeInterval <= 0 || c.StaleCheckInterval <= 0 {
+		return fmt.Errorf("retention purge and stale check intervals must be positive")
+	}
+	return nil
+}
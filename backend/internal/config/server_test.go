@@ -0,0 +1,312 @@
+// Tests the server configuration loading
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfigRetention(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "retention-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := `{"brokers": {"noisy": {"stale_after_days": 1, "purge_after_days": 3}, "quiet": {"purge_after_days": 90}, "archive": {"stale_after_days": -1, "purge_after_days": -1}}}`
+	tmpfile.Write([]byte(content))
+	tmpfile.Close()
+
+	os.Setenv("RETENTION_CONFIG", tmpfile.Name())
+	os.Setenv("RETENTION_STALE_DAYS", "14")
+	os.Setenv("RETENTION_PURGE_DAYS", "30")
+	os.Setenv("RETENTION_PURGE_INTERVAL", "15m")
+	defer func() {
+		os.Unsetenv("RETENTION_CONFIG")
+		os.Unsetenv("RETENTION_STALE_DAYS")
+		os.Unsetenv("RETENTION_PURGE_DAYS")
+		os.Unsetenv("RETENTION_PURGE_INTERVAL")
+	}()
+
+	cfg, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+
+	if cfg.Retention.PurgeInterval != 15*time.Minute {
+		t.Errorf("expected purge interval 15m, got %v", cfg.Retention.PurgeInterval)
+	}
+
+	tests := []struct {
+		broker string
+		want   RetentionPolicy
+	}{
+		{"other", RetentionPolicy{StaleAfterDays: 14, PurgeAfterDays: 30}},
+		{"noisy", RetentionPolicy{StaleAfterDays: 1, PurgeAfterDays: 3}},
+		{"quiet", RetentionPolicy{StaleAfterDays: 14, PurgeAfterDays: 90}},
+		// -1 turns a step off despite the global default
+		{"archive", RetentionPolicy{}},
+	}
+	for _, tt := range tests {
+		if got := cfg.Retention.PolicyFor(tt.broker); got != tt.want {
+			t.Errorf("PolicyFor(%s) = %+v, want %+v", tt.broker, got, tt.want)
+		}
+	}
+}
+
+func TestLoadServerConfigRetentionInvalid(t *testing.T) {
+	os.Setenv("RETENTION_STALE_DAYS", "30")
+	os.Setenv("RETENTION_PURGE_DAYS", "7")
+	defer func() {
+		os.Unsetenv("RETENTION_STALE_DAYS")
+		os.Unsetenv("RETENTION_PURGE_DAYS")
+	}()
+
+	if _, err := LoadServerConfig(); err == nil {
+		t.Error("expected error when stale days exceed purge days, got nil")
+	}
+
+	path := filepath.Join(t.TempDir(), "retention.json")
+	os.WriteFile(path, []byte(`{"brokers": {"noisy": {"purge_after_days": -2}}}`), 0o600)
+	t.Setenv("RETENTION_CONFIG", path)
+	os.Setenv("RETENTION_PURGE_DAYS", "0")
+	if _, err := LoadServerConfig(); err == nil {
+		t.Error("expected error for days below -1, got nil")
+	}
+}
+
+func TestLoadServerConfigAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  bool
+		wantHash string
+	}{
+		{"api keys", `{"api_keys": [{"name": "ui", "sha256": "` + strings.Repeat("a", 64) + `", "scopes": ["read"]}]}`, false, strings.Repeat("a", 64)},
+		{"uppercase hash", `{"api_keys": [{"name": "ui", "sha256": "` + strings.Repeat("A1", 32) + `", "scopes": ["read"]}]}`, false, strings.Repeat("a1", 32)},
+		{"jwt", `{"jwt": {"jwks_file": "/etc/jwks.json", "issuer": "https://issuer.example"}}`, false, ""},
+		{"short hash", `{"api_keys": [{"name": "ui", "sha256": "abc", "scopes": ["read"]}]}`, true, ""},
+		{"non-hex hash", `{"api_keys": [{"name": "ui", "sha256": "` + strings.Repeat("g", 64) + `", "scopes": ["read"]}]}`, true, ""},
+		{"jwt without jwks", `{"jwt": {"issuer": "https://issuer.example"}}`, true, ""},
+		{"empty", `{}`, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "auth.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("AUTH_CONFIG", path)
+
+			cfg, err := LoadServerConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadServerConfig() error = %v", err)
+			}
+			if !cfg.Auth.Enabled {
+				t.Error("expected auth to be enabled")
+			}
+			if tt.wantHash != "" && cfg.Auth.APIKeys[0].SHA256 != tt.wantHash {
+				t.Errorf("sha256 = %s, want %s", cfg.Auth.APIKeys[0].SHA256, tt.wantHash)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigCORS(t *testing.T) {
+	// Annotation and webhook routes need PUT and DELETE
+	cfg, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+	if got := strings.Join(cfg.CORS.AllowedMethods, ","); got != "GET,POST,PUT,DELETE" {
+		t.Errorf("default methods = %s", got)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://catalog.example.com, https://*.example.com")
+	t.Setenv("CORS_ALLOWED_METHODS", "get,post,delete")
+	t.Setenv("CORS_MAX_AGE", "1h")
+
+	cfg, err = LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://*.example.com" {
+		t.Errorf("unexpected origins %v", cfg.CORS.AllowedOrigins)
+	}
+	if len(cfg.CORS.AllowedMethods) != 3 || cfg.CORS.AllowedMethods[2] != "DELETE" {
+		t.Errorf("unexpected methods %v", cfg.CORS.AllowedMethods)
+	}
+	if cfg.CORS.MaxAge != time.Hour {
+		t.Errorf("expected max age 1h, got %v", cfg.CORS.MaxAge)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	if _, err := LoadServerConfig(); err == nil {
+		t.Error("expected error for credentials with wildcard origin")
+	}
+}
+
+func TestLoadServerConfigLimits(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "2MiB")
+	t.Setenv("MAX_BODY_BYTES_ROUTES", "POST /api/samples=512K, GET /api/topics=1024")
+	t.Setenv("MAX_SAMPLE_BYTES", "64k")
+	t.Setenv("TRUNCATE_SAMPLES", "false")
+	t.Setenv("RATE_LIMIT_RPS", "5")
+
+	cfg, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+
+	limits := cfg.Limits
+	if got := limits.BodyLimitFor("POST /api/samples"); got != 512<<10 {
+		t.Errorf("expected samples limit 512K, got %d", got)
+	}
+	if got := limits.BodyLimitFor("GET /api/topics"); got != 1024 {
+		t.Errorf("expected topics limit 1024, got %d", got)
+	}
+	if got := limits.BodyLimitFor("GET /api/search"); got != 2<<20 {
+		t.Errorf("expected default limit 2M, got %d", got)
+	}
+	if limits.MaxSampleBytes != 64<<10 || limits.TruncateSamples {
+		t.Errorf("unexpected sample limits %+v", limits)
+	}
+	if limits.RateLimit.RequestsPerSecond != 5 || limits.RateLimit.Burst != 20 {
+		t.Errorf("unexpected rate limit %+v", limits.RateLimit)
+	}
+
+	t.Setenv("MAX_BODY_BYTES_ROUTES", "POST /api/samples")
+	if _, err := LoadServerConfig(); err == nil {
+		t.Error("expected error for route limit without size")
+	}
+}
+
+func TestLoadServerConfigTail(t *testing.T) {
+	cfg, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+	if len(cfg.Tail.Brokers) != 0 || cfg.Tail.IdleTimeout != time.Minute || cfg.Tail.MaxSessions != 10 {
+		t.Errorf("unexpected tail defaults %+v", cfg.Tail)
+	}
+
+	path := filepath.Join(t.TempDir(), "brokers.json")
+	os.WriteFile(path, []byte(`[{"id": "broker1", "url": "tcp://localhost:1883", "username": "catalog"}]`), 0o600)
+	t.Setenv("BROKERS_CONFIG", path)
+	t.Setenv("TAIL_RATE_LIMIT", "5")
+	t.Setenv("TAIL_MAX_DURATION", "2m")
+
+	cfg, err = LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+	broker, ok := cfg.Tail.Broker("broker1")
+	if !ok || broker.Username != "catalog" {
+		t.Errorf("expected broker1 from BROKERS_CONFIG, got %+v", broker)
+	}
+	if cfg.Tail.MessagesPerSecond != 5 || cfg.Tail.MaxDuration != 2*time.Minute {
+		t.Errorf("unexpected tail limits %+v", cfg.Tail)
+	}
+
+	t.Setenv("TAIL_IDLE_TIMEOUT", "0s")
+	if _, err := LoadServerConfig(); err == nil {
+		t.Error("expected error for zero idle timeout")
+	}
+}
+
+func TestLoadServerConfigGovernance(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"rules", `{"rules": [{"name": "depth", "max_depth": 5}, {"name": "lowercase", "allowed_chars": "a-z0-9_-", "severity": "warning"}]}`, false},
+		{"missing name", `{"rules": [{"max_depth": 5}]}`, true},
+		{"duplicate name", `{"rules": [{"name": "a", "max_depth": 5}, {"name": "a", "min_depth": 1}]}`, true},
+		{"bad pattern", `{"rules": [{"name": "a", "pattern": "("}]}`, true},
+		{"bad severity", `{"rules": [{"name": "a", "max_depth": 5, "severity": "fatal"}]}`, true},
+		{"inverted depth", `{"rules": [{"name": "a", "min_depth": 4, "max_depth": 2}]}`, true},
+		{"no checks", `{"rules": [{"name": "a"}]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "governance.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("GOVERNANCE_CONFIG", path)
+
+			cfg, err := LoadServerConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadServerConfig() error = %v", err)
+			}
+			if len(cfg.Governance.Rules) != 2 || cfg.Governance.Rules[0].Severity != SeverityError {
+				t.Errorf("unexpected rules %+v", cfg.Governance.Rules)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigWebhooks(t *testing.T) {
+	cfg, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+	want := WebhookConfig{MaxAttempts: 8, RetryBackoff: 30 * time.Second, RetryBackoffMax: time.Hour, Timeout: 10 * time.Second, DeliveryLogDays: 30, Concurrency: 8}
+	if cfg.Webhooks != want {
+		t.Errorf("unexpected webhook defaults %+v", cfg.Webhooks)
+	}
+	if cfg.Retention.StaleCheckInterval != 5*time.Minute {
+		t.Errorf("expected stale check interval 5m, got %v", cfg.Retention.StaleCheckInterval)
+	}
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_RETRY_BACKOFF", "10s")
+	t.Setenv("WEBHOOK_RETRY_BACKOFF_MAX", "5m")
+	cfg, err = LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig() error = %v", err)
+	}
+	if cfg.Webhooks.MaxAttempts != 3 || cfg.Webhooks.RetryBackoff != 10*time.Second || cfg.Webhooks.RetryBackoffMax != 5*time.Minute {
+		t.Errorf("unexpected webhook config %+v", cfg.Webhooks)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"no attempts", "WEBHOOK_MAX_ATTEMPTS", "0"},
+		{"backoff above maximum", "WEBHOOK_RETRY_BACKOFF", "10m"},
+		{"zero timeout", "WEBHOOK_TIMEOUT", "0s"},
+		{"no delivery log", "WEBHOOK_DELIVERY_LOG_DAYS", "0"},
+		{"zero stale check interval", "RETENTION_STALE_CHECK_INTERVAL", "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := LoadServerConfig(); err == nil {
+				t.Errorf("expected error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Splits the configured brokers between collector replicas
+type ShardConfig struct {
+	Enabled bool
+	// InstanceID names this replica in the lease table; defaults to the host
+	// name, which is unique per pod or container
+	InstanceID string
+	// LeaseTTL is how long a replica keeps its brokers without renewing;
+	// brokers of a replica that died move after at most this long
+	LeaseTTL      time.Duration
+	RenewInterval time.Duration
+	// VirtualNodes is the number of points per replica on the hash ring
+	VirtualNodes int
+}
+
+func loadShardConfig() (ShardConfig, error) {
+	var cfg ShardConfig
+	var err error
+
+	if cfg.Enabled, err = strconv.ParseBool(getEnv("COLLECTOR_SHARDING", "false")); err != nil {
+		return cfg, fmt.Errorf("invalid COLLECTOR_SHARDING: %w", err)
+	}
+	if cfg.LeaseTTL, err = time.ParseDuration(getEnv("COLLECTOR_LEASE_TTL", "30s")); err != nil {
+		return cfg, fmt.Errorf("invalid COLLECTOR_LEASE_TTL: %w", err)
+	}
+	if cfg.RenewInterval, err = time.ParseDuration(getEnv("COLLECTOR_LEASE_RENEW_INTERVAL", "10s")); err != nil {
+		return cfg, fmt.Errorf("invalid COLLECTOR_LEASE_RENEW_INTERVAL: %w", err)
+	}
+	if cfg.VirtualNodes, err = strconv.Atoi(getEnv("COLLECTOR_VIRTUAL_NODES", "64")); err != nil {
+		return cfg, fmt.Errorf("invalid COLLECTOR_VIRTUAL_NODES: %w", err)
+	}
+
+	cfg.InstanceID = getEnv("COLLECTOR_INSTANCE_ID", "")
+	if cfg.InstanceID == "" {
+		if cfg.InstanceID, err = os.Hostname(); err != nil {
+			return cfg, fmt.Errorf("determine collector instance id: %w", err)
+		}
+	}
+
+	if !cfg.Enabled {
+		return cfg, nil
+	}
+	// The server accepts leases of 5s to 1h
+	if cfg.LeaseTTL < 5*time.Second || cfg.LeaseTTL > time.Hour || cfg.LeaseTTL%time.Second != 0 {
+		return cfg, fmt.Errorf("collector lease TTL must be whole seconds between 5s and 1h")
+	}
+	// Leaving room for one failed renewal before the lease runs out
+	if cfg.RenewInterval <= 0 || cfg.RenewInterval*2 > cfg.LeaseTTL {
+		return cfg, fmt.Errorf("collector lease renew interval must be positive and at most half the lease TTL")
+	}
+	if cfg.VirtualNodes < 1 {
+		return cfg, fmt.Errorf("collector virtual nodes must be at least 1")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Live topic event stream served over Server-Sent Events
+type StreamConfig struct {
+	// BufferSize is the number of recent events kept for Last-Event-ID resumes
+	BufferSize int
+	// Heartbeat is the interval of keep-alive comments on idle streams
+	Heartbeat time.Duration
+}
+
+func loadStreamConfig() (StreamConfig, error) {
+	var cfg StreamConfig
+	var err error
+
+	if cfg.BufferSize, err = strconv.Atoi(getEnv("STREAM_BUFFER_SIZE", "1024")); err != nil {
+		return cfg, fmt.Errorf("invalid STREAM_BUFFER_SIZE: %w", err)
+	}
+	if cfg.Heartbeat, err = time.ParseDuration(getEnv("STREAM_HEARTBEAT", "15s")); err != nil {
+		return cfg, fmt.Errorf("invalid STREAM_HEARTBEAT: %w", err)
+	}
+
+	if cfg.BufferSize < 1 {
+		return cfg, fmt.Errorf("stream buffer size must be at least 1")
+	}
+	if cfg.Heartbeat <= 0 {
+		return cfg, fmt.Errorf("stream heartbeat must be positive")
+	}
+	return cfg, nil
+}
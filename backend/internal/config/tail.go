@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Live message tail opened from the API server against configured brokers
+type TailConfig struct {
+	// Brokers come from the collector's BROKERS_CONFIG file, none disables tailing
+	Brokers []BrokerConfig
+	// MessagesPerSecond caps the messages forwarded to each client, excess
+	// messages are dropped and counted
+	MessagesPerSecond float64
+	Burst             int
+	// IdleTimeout ends a session that received no message for this long
+	IdleTimeout time.Duration
+	// MaxDuration ends every session after this long
+	MaxDuration time.Duration
+	// MaxSessions caps concurrent sessions, each holds its own broker connection
+	MaxSessions int
+}
+
+// Returns the configured broker with the given ID
+func (c TailConfig) Broker(id string) (BrokerConfig, bool) {
+	for _, b := range c.Brokers {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return BrokerConfig{}, false
+}
+
+func loadTailConfig() (TailConfig, error) {
+	var cfg TailConfig
+	var err error
+
+	if path := getEnv("BROKERS_CONFIG", ""); path != "" {
+		if cfg.Brokers, err = loadBrokersConfig(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	if cfg.MessagesPerSecond, err = strconv.ParseFloat(getEnv("TAIL_RATE_LIMIT", "20"), 64); err != nil {
+		return cfg, fmt.Errorf("invalid TAIL_RATE_LIMIT: %w", err)
+	}
+	if cfg.Burst, err = strconv.Atoi(getEnv("TAIL_BURST", "50")); err != nil {
+		return cfg, fmt.Errorf("invalid TAIL_BURST: %w", err)
+	}
+	if cfg.IdleTimeout, err = time.ParseDuration(getEnv("TAIL_IDLE_TIMEOUT", "1m")); err != nil {
+		return cfg, fmt.Errorf("invalid TAIL_IDLE_TIMEOUT: %w", err)
+	}
+	if cfg.MaxDuration, err = time.ParseDuration(getEnv("TAIL_MAX_DURATION", "10m")); err != nil {
+		return cfg, fmt.Errorf("invalid TAIL_MAX_DURATION: %w", err)
+	}
+	if cfg.MaxSessions, err = strconv.Atoi(getEnv("TAIL_MAX_SESSIONS", "10")); err != nil {
+		return cfg, fmt.Errorf("invalid TAIL_MAX_SESSIONS: %w", err)
+	}
+
+	if cfg.MessagesPerSecond <= 0 || cfg.Burst < 1 {
+		return cfg, fmt.Errorf("tail rate limit must be positive with a burst of at least 1")
+	}
+	if cfg.IdleTimeout <= 0 || cfg.MaxDuration <= 0 {
+		return cfg, fmt.Errorf("tail idle timeout and max duration must be positive")
+	}
+	if cfg.MaxSessions < 1 {
+		return cfg, fmt.Errorf("tail max sessions must be at least 1")
+	}
+	return cfg, nil
+}
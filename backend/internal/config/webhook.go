@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Delivery of topic events to webhook subscriptions
+type WebhookConfig struct {
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts int
+	// Retries wait RetryBackoff, doubling after every failed attempt up to
+	// RetryBackoffMax
+	RetryBackoff    time.Duration
+	RetryBackoffMax time.Duration
+	// Timeout bounds a single delivery request
+	Timeout time.Duration
+	// DeliveryLogDays is how long finished deliveries are kept in the log
+	DeliveryLogDays int
+	// Concurrency is how many webhooks are delivered to at once
+	Concurrency int
+}
+
+func loadWebhookConfig() (WebhookConfig, error) {
+	var cfg WebhookConfig
+	var err error
+
+	if cfg.MaxAttempts, err = strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %w", err)
+	}
+	if cfg.RetryBackoff, err = time.ParseDuration(getEnv("WEBHOOK_RETRY_BACKOFF", "30s")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_RETRY_BACKOFF: %w", err)
+	}
+	if cfg.RetryBackoffMax, err = time.ParseDuration(getEnv("WEBHOOK_RETRY_BACKOFF_MAX", "1h")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_RETRY_BACKOFF_MAX: %w", err)
+	}
+	if cfg.Timeout, err = time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+	}
+	if cfg.DeliveryLogDays, err = strconv.Atoi(getEnv("WEBHOOK_DELIVERY_LOG_DAYS", "30")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_DELIVERY_LOG_DAYS: %w", err)
+	}
+	if cfg.Concurrency, err = strconv.Atoi(getEnv("WEBHOOK_CONCURRENCY", "8")); err != nil {
+		return cfg, fmt.Errorf("invalid WEBHOOK_CONCURRENCY: %w", err)
+	}
+
+	if cfg.MaxAttempts < 1 {
+		return cfg, fmt.Errorf("webhook max attempts must be at least 1")
+	}
+	if cfg.RetryBackoff <= 0 || cfg.RetryBackoffMax < cfg.RetryBackoff {
+		return cfg, fmt.Errorf("webhook retry backoff must be positive and not exceed its maximum")
+	}
+	if cfg.Timeout <= 0 {
+		return cfg, fmt.Errorf("webhook timeout must be positive")
+	}
+	if cfg.DeliveryLogDays < 1 {
+		return cfg, fmt.Errorf("webhook delivery log days must be at least 1")
+	}
+	if cfg.Concurrency < 1 {
+		return cfg, fmt.Errorf("webhook concurrency must be at least 1")
+	}
+	return cfg, nil
+}
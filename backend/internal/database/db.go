@@ -1,14 +1,97 @@
 package database
 
 import (
+	"container/list"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
+	"sync"
 
 	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// SQLiteDriver is the sqlite3 driver extended with a REGEXP function,
+// so topic filters can be matched inside the database like on Postgres
+const SQLiteDriver = "sqlite3_catalog"
+
+func init() {
+	sql.Register(SQLiteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", regexpMatch, true)
+		},
+	})
+}
+
+// Compiled patterns kept across REGEXP calls; patterns come from search
+// requests, so the least recently used ones are dropped beyond this
+const regexpCacheSize = 256
+
+var regexpCache = newRegexpLRU(regexpCacheSize)
+
+// Implements "value REGEXP pattern", caching compiled patterns across calls
+func regexpMatch(pattern, value string) (bool, error) {
+	if re := regexpCache.get(pattern); re != nil {
+		return re.MatchString(value), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	regexpCache.add(pattern, re)
+
+	return re.MatchString(value), nil
+}
+
+// Compiled regular expressions by pattern, holding at most max entries
+type regexpLRU struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type regexpEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRegexpLRU(max int) *regexpLRU {
+	return &regexpLRU{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Returns the cached expression for the pattern, nil when it is not cached
+func (c *regexpLRU) get(pattern string) *regexp.Regexp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[pattern]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*regexpEntry).re
+}
+
+// Caches the expression, dropping the least recently used one when full
+func (c *regexpLRU) add(pattern string, re *regexp.Regexp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[pattern] = c.order.PushFront(&regexpEntry{pattern: pattern, re: re})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*regexpEntry).pattern)
+	}
+}
+
 func New(databaseURL string) (*sql.DB, error) {
 	var driverName string
 
@@ -16,7 +99,7 @@ func New(databaseURL string) (*sql.DB, error) {
 		strings.HasPrefix(databaseURL, "postgresql://") {
 		driverName = "postgres"
 	} else {
-		driverName = "sqlite3"
+		driverName = SQLiteDriver
 	}
 
 	db, err := sql.Open(driverName, databaseURL)
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestRegexpLRU(t *testing.T) {
+	cache := newRegexpLRU(2)
+	for _, pattern := range []string{"^a", "^b"} {
+		cache.add(pattern, regexp.MustCompile(pattern))
+	}
+
+	// Using ^a keeps it, so adding ^c drops ^b
+	if cache.get("^a") == nil {
+		t.Fatal("get(^a) = nil, want the cached expression")
+	}
+	cache.add("^c", regexp.MustCompile("^c"))
+
+	for pattern, cached := range map[string]bool{"^a": true, "^b": false, "^c": true} {
+		if got := cache.get(pattern) != nil; got != cached {
+			t.Errorf("get(%s) cached = %v, want %v", pattern, got, cached)
+		}
+	}
+}
+
+func TestRegexpMatch_BoundedCache(t *testing.T) {
+	for i := range regexpCacheSize + 10 {
+		if _, err := regexpMatch(fmt.Sprintf("^topic/%d$", i), "topic/1"); err != nil {
+			t.Fatalf("regexpMatch() error = %v", err)
+		}
+	}
+	if n := regexpCache.order.Len(); n != regexpCacheSize {
+		t.Errorf("cached %d patterns, want %d", n, regexpCacheSize)
+	}
+
+	if _, err := regexpMatch("(", "topic"); err == nil {
+		t.Error("regexpMatch() accepted an invalid pattern")
+	}
+}
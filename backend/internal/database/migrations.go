@@ -5,20 +5,110 @@ import (
 	"fmt"
 )
 
+// A schema change applied once and recorded in schema_migrations.
+// Steps written before versioning existed are idempotent so databases
+// created by earlier releases can be adopted without changes
+type migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx, isSQLite bool) error
+}
+
+var migrations = []migration{
+	{1, "create topics table", createTopicsTable},
+	{2, "create full-text search index", migrateSearchIndex},
+	{3, "create api_keys table", createAPIKeysTable},
+	{4, "add truncated flag to topics", addTruncatedColumn},
+	{5, "create annotations tables", createAnnotationsTables},
+	{6, "add payload scan flags to topics", addFlagColumns},
+	{7, "create webhook tables", createWebhookTables},
+	{8, "create collector lease tables", createLeaseTables},
+	{9, "create sample claims table", createSampleClaimsTable},
+	{10, "add claim time to webhook deliveries", addDeliveryClaimColumn},
+}
+
+// Returns the schema version the current binary expects
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Returns the highest applied schema version, 0 on an empty database
+func CurrentVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
 func RunMigrations(db *sql.DB) error {
-	// Check if we are using SQLite or Postgres
-	var query string
+	isSQLite := IsSQLite(db)
+
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m, isSQLite); err != nil {
+			return fmt.Errorf("run migrations: %w", err)
+		}
+	}
 
-	// Detect database type by trying to get version
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration, isSQLite bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if err := m.apply(tx, isSQLite); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+	}
+
+	insert := "INSERT INTO schema_migrations (version) VALUES (?)"
+	if !isSQLite {
+		insert = "INSERT INTO schema_migrations (version) VALUES ($1)"
+	}
+	if _, err := tx.Exec(insert, m.version); err != nil {
+		return fmt.Errorf("migration %d: record version: %w", m.version, err)
+	}
+
+	return tx.Commit()
+}
+
+// Detects SQLite by asking for its version, anything else is treated as Postgres
+func IsSQLite(db *sql.DB) bool {
 	var version string
-	err := db.QueryRow("SELECT sqlite_version()").Scan(&version)
-	isSQLite := err == nil
+	return db.QueryRow("SELECT sqlite_version()").Scan(&version) == nil
+}
+
+func createTopicsTable(tx *sql.Tx, isSQLite bool) error {
+	var query string
 
 	if isSQLite {
 		query = `
 		CREATE TABLE IF NOT EXISTS topics (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			broker_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
 			payload_type TEXT NOT NULL,
 			sample_payload BLOB NOT NULL,
 			last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -48,10 +138,162 @@ func RunMigrations(db *sql.DB) error {
 		`
 	}
 
-	_, err = db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("run migrations: %w", err)
+	_, err := tx.Exec(query)
+	return err
+}
+
+func createAPIKeysTable(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			key_hash TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_api_keys_name ON api_keys(name);
+	`)
+	return err
+}
+
+// Marks samples whose payload was cut to the maximum stored size
+func addTruncatedColumn(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec("ALTER TABLE topics ADD COLUMN truncated BOOLEAN NOT NULL DEFAULT FALSE")
+	return err
+}
+
+// Human metadata for a topic or topic filter, kept apart from the topics
+// table so collector upserts never touch it. topic_regex is the filter
+// compiled by the repository, matched with REGEXP or ~ like searches
+func createAnnotationsTables(tx *sql.Tx, isSQLite bool) error {
+	id := "SERIAL PRIMARY KEY"
+	if isSQLite {
+		id = "INTEGER PRIMARY KEY AUTOINCREMENT"
 	}
 
-	return nil
+	_, err := tx.Exec(`
+		CREATE TABLE annotations (
+			id ` + id + `,
+			broker_id TEXT NOT NULL DEFAULT '',
+			topic_filter TEXT NOT NULL,
+			topic_regex TEXT NOT NULL,
+			owner TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			classification TEXT NOT NULL DEFAULT '',
+			links TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			UNIQUE(broker_id, topic_filter)
+		);
+
+		CREATE INDEX idx_annotations_owner ON annotations(owner);
+
+		CREATE TABLE annotation_tags (
+			annotation_id INTEGER NOT NULL REFERENCES annotations(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (annotation_id, tag)
+		);
+
+		CREATE INDEX idx_annotation_tags_tag ON annotation_tags(tag);
+	`)
+	return err
+}
+
+// Detectors that found likely PII or secrets in the sample, stored as a
+// space-separated list, and whether the collector redacted them
+func addFlagColumns(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec(`
+		ALTER TABLE topics ADD COLUMN flags TEXT NOT NULL DEFAULT '';
+		ALTER TABLE topics ADD COLUMN redacted BOOLEAN NOT NULL DEFAULT FALSE;
+	`)
+	return err
+}
+
+// Webhook subscriptions and their delivery log. Deliveries keep the signed
+// body so pending ones are retried unchanged, also after a restart
+func createWebhookTables(tx *sql.Tx, isSQLite bool) error {
+	id, payload := "SERIAL PRIMARY KEY", "BYTEA"
+	if isSQLite {
+		id, payload = "INTEGER PRIMARY KEY AUTOINCREMENT", "BLOB"
+	}
+
+	_, err := tx.Exec(`
+		CREATE TABLE webhooks (
+			id ` + id + `,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL DEFAULT '',
+			broker_id TEXT NOT NULL DEFAULT '',
+			topic_filter TEXT NOT NULL DEFAULT '',
+			topic_regex TEXT NOT NULL DEFAULT '',
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE webhook_deliveries (
+			id ` + id + `,
+			webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id BIGINT NOT NULL,
+			event_type TEXT NOT NULL,
+			broker_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			payload ` + payload + ` NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			next_attempt_at TIMESTAMP,
+			delivered_at TIMESTAMP
+		);
+
+		CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+		CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	`)
+	return err
+}
+
+func createLeaseTables(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec(`
+		CREATE TABLE collector_leases (
+			instance_id TEXT PRIMARY KEY,
+			renewed_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE broker_leases (
+			broker_id TEXT PRIMARY KEY,
+			instance_id TEXT NOT NULL,
+			acquired_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX idx_broker_leases_instance ON broker_leases(instance_id);
+	`)
+	return err
+}
+
+func createSampleClaimsTable(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec(`
+		CREATE TABLE sample_claims (
+			broker_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			instance_id TEXT NOT NULL,
+			claimed_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (broker_id, topic)
+		);
+
+		CREATE INDEX idx_sample_claims_expires ON sample_claims(expires_at);
+	`)
+	return err
+}
+
+// Deliveries being sent carry claimed_until, so other server instances
+// polling for due deliveries skip them until the claim runs out
+func addDeliveryClaimColumn(tx *sql.Tx, isSQLite bool) error {
+	_, err := tx.Exec("ALTER TABLE webhook_deliveries ADD COLUMN claimed_until TIMESTAMP")
+	return err
 }
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestRunMigrations(t *testing.T) {
+	db, err := sql.Open(SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	// Running twice must be a no-op the second time
+	for i := 0; i < 2; i++ {
+		if err := RunMigrations(db); err != nil {
+			t.Fatalf("RunMigrations() run %d error = %v", i+1, err)
+		}
+	}
+
+	current, err := CurrentVersion(db)
+	if err != nil {
+		t.Fatalf("CurrentVersion() error = %v", err)
+	}
+
+	if current != LatestVersion() {
+		t.Errorf("CurrentVersion() = %d, want %d", current, LatestVersion())
+	}
+
+	var applied int
+	db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if applied != len(migrations) {
+		t.Errorf("recorded %d migrations, want %d", applied, len(migrations))
+	}
+}
+
+func TestRunMigrations_AdoptsExistingSchema(t *testing.T) {
+	db, err := sql.Open(SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	// Schema as created by releases before migrations were versioned
+	_, err = db.Exec(`
+		CREATE TABLE topics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			broker_id TEXT NOT NULL,
+			topic TEXT NOT NULL,
+			payload_type TEXT NOT NULL,
+			sample_payload BLOB NOT NULL,
+			last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(broker_id, topic));
+		INSERT INTO topics (broker_id, topic, payload_type, sample_payload)
+		VALUES ('broker1', 'line/meter', 'json', '{"serial": "SN-1"}');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations() error = %v", err)
+	}
+
+	var indexed int
+	db.QueryRow("SELECT COUNT(*) FROM topics_fts WHERE topics_fts MATCH 'serial'").Scan(&indexed)
+	if indexed != 1 {
+		t.Errorf("expected existing topic to be indexed, got %d matches", indexed)
+	}
+}
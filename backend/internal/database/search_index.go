@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"mqtt-catalog/internal/payload"
+	"mqtt-catalog/pkg/models"
+	"strings"
+)
+
+// Creates the full-text index over sample payloads and indexes the rows
+// that were stored before it existed.
+// SQLite uses FTS5 when the driver is built with -tags sqlite_fts5 and falls
+// back to FTS4 otherwise; Postgres uses a generated tsvector column
+func migrateSearchIndex(tx *sql.Tx, isSQLite bool) error {
+	if isSQLite {
+		return migrateSQLiteSearchIndex(tx)
+	}
+	return migratePostgresSearchIndex(tx)
+}
+
+func migrateSQLiteSearchIndex(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS topics_fts USING fts5(broker_id, topic, content)`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		_, err = tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS topics_fts USING fts4(broker_id, topic, content)`)
+	}
+	if err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+
+	return backfillSearchIndex(tx,
+		`SELECT id, broker_id, topic, payload_type, sample_payload FROM topics
+		WHERE id NOT IN (SELECT rowid FROM topics_fts)`,
+		func(tx *sql.Tx, id int64, brokerID, topic, text string) error {
+			_, err := tx.Exec(
+				`INSERT INTO topics_fts (rowid, broker_id, topic, content) VALUES (?, ?, ?, ?)`,
+				id, brokerID, topic, text,
+			)
+			return err
+		},
+	)
+}
+
+func migratePostgresSearchIndex(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE topics ADD COLUMN IF NOT EXISTS sample_text TEXT;
+		ALTER TABLE topics ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('simple', topic || ' ' || COALESCE(sample_text, ''))) STORED;
+		CREATE INDEX IF NOT EXISTS idx_topics_search_vector ON topics USING GIN(search_vector);
+	`)
+	if err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+
+	return backfillSearchIndex(tx,
+		`SELECT id, broker_id, topic, payload_type, sample_payload FROM topics
+		WHERE sample_text IS NULL`,
+		func(tx *sql.Tx, id int64, _, _, text string) error {
+			_, err := tx.Exec(`UPDATE topics SET sample_text = $1 WHERE id = $2`, text, id)
+			return err
+		},
+	)
+}
+
+// Extracts searchable text for every row returned by selectQuery and stores it
+// through index
+func backfillSearchIndex(
+	tx *sql.Tx,
+	selectQuery string,
+	index func(tx *sql.Tx, id int64, brokerID, topic, text string) error,
+) error {
+	type pending struct {
+		id              int64
+		brokerID, topic string
+		text            string
+	}
+
+	rows, err := tx.Query(selectQuery)
+	if err != nil {
+		return fmt.Errorf("query unindexed topics: %w", err)
+	}
+
+	var items []pending
+	for rows.Next() {
+		var (
+			p           pending
+			payloadType models.PayloadType
+			data        []byte
+		)
+		if err := rows.Scan(&p.id, &p.brokerID, &p.topic, &payloadType, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan unindexed topic: %w", err)
+		}
+		p.text = payload.ExtractText(data, payloadType)
+		items = append(items, p)
+	}
+	rows.Close()
+
+	for _, p := range items {
+		if err := index(tx, p.id, p.brokerID, p.topic, p.text); err != nil {
+			return fmt.Errorf("index topic %d: %w", p.id, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+// Fans out topic change events to live subscribers and keeps a bounded
+// history so reconnecting clients can resume from their last event ID
+package events
+
+import (
+	"mqtt-catalog/pkg/models"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBufferSize = 1024
+	// Events queued per subscriber before it is considered too slow and dropped
+	subscriberQueue = 256
+)
+
+type Hub struct {
+	mu sync.Mutex
+	// IDs of this hub start at firstID, so IDs from an earlier run or
+	// another hub fall outside [firstID, nextID)
+	firstID uint64
+	nextID  uint64
+	// Ring buffer of the most recent events, oldest at start
+	history []models.TopicEvent
+	start   int
+	subs    map[*Subscription]struct{}
+	closed  bool
+	now     func() time.Time
+}
+
+// Event IDs start at the boot time in microseconds, so they keep growing
+// across restarts and an ID from before a restart is never taken for one
+// of this run
+func NewHub(bufferSize int) *Hub {
+	return newHub(bufferSize, uint64(time.Now().UnixMicro()))
+}
+
+func newHub(bufferSize int, firstID uint64) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		firstID: firstID,
+		nextID:  firstID,
+		history: make([]models.TopicEvent, 0, bufferSize),
+		subs:    make(map[*Subscription]struct{}),
+		now:     time.Now,
+	}
+}
+
+// Receives events published after it was created. C is closed when the
+// subscriber falls too far behind, the subscription is closed or the hub shuts down
+type Subscription struct {
+	C   <-chan models.TopicEvent
+	ch  chan models.TopicEvent
+	hub *Hub
+}
+
+// Assigns the next ID and time to the event, records it and delivers it to
+// every subscriber without blocking. The topic's sample payload is left out,
+// so the history's memory use does not grow with payload sizes
+func (h *Hub) Publish(e models.TopicEvent) models.TopicEvent {
+	e.Topic.SamplePayload = []byte{}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return e
+	}
+
+	e.ID = h.nextID
+	h.nextID++
+	if e.Time.IsZero() {
+		e.Time = h.now().UTC()
+	}
+
+	if len(h.history) < cap(h.history) {
+		h.history = append(h.history, e)
+	} else {
+		h.history[h.start] = e
+		h.start = (h.start + 1) % len(h.history)
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			// A slow client must not hold up ingestion; it resumes with Last-Event-ID
+			h.drop(sub)
+		}
+	}
+	return e
+}
+
+// Subscribes to new events and returns the buffered events after lastID.
+// complete is false when events after lastID were already evicted from the
+// history, or lastID was not issued by this hub (it is from before a
+// restart), so the client missed some
+func (h *Hub) Subscribe(lastID uint64) (sub *Subscription, backlog []models.TopicEvent, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan models.TopicEvent, subscriberQueue)
+	sub = &Subscription{C: ch, ch: ch, hub: h}
+	if h.closed {
+		close(ch)
+		return sub, nil, false
+	}
+	h.subs[sub] = struct{}{}
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+
+	if lastID < h.firstID || lastID >= h.nextID {
+		// Its events are unknown here, and this run's may all be missed
+		for i := range h.history {
+			backlog = append(backlog, h.history[(h.start+i)%len(h.history)])
+		}
+		return sub, backlog, false
+	}
+
+	complete = h.history[h.start].ID <= lastID+1
+
+	for i := range h.history {
+		e := h.history[(h.start+i)%len(h.history)]
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+	return sub, backlog, complete
+}
+
+// Stops delivery to the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Closes every subscription and ignores later events
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.drop(sub)
+	}
+}
+
+// Reports whether Close was called
+func (h *Hub) Closed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
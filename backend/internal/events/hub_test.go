@@ -0,0 +1,127 @@
+package events
+
+import (
+	"mqtt-catalog/pkg/models"
+	"testing"
+	"time"
+)
+
+func publishN(h *Hub, n int) {
+	for i := 0; i < n; i++ {
+		h.Publish(models.TopicEvent{Type: models.EventTopicSampleRefreshed})
+	}
+}
+
+func TestHub_PublishDelivers(t *testing.T) {
+	h := newHub(8, 1)
+	sub, backlog, complete := h.Subscribe(0)
+	defer sub.Close()
+
+	if len(backlog) != 0 || !complete {
+		t.Fatalf("fresh subscription got backlog=%d complete=%v", len(backlog), complete)
+	}
+
+	published := h.Publish(models.TopicEvent{Type: models.EventTopicCreated, Topic: models.Topic{SamplePayload: []byte("large")}})
+	if published.ID != 1 || published.Time.IsZero() {
+		t.Errorf("Publish() = %+v, want ID 1 with a time", published)
+	}
+
+	got := <-sub.C
+	if got.ID != 1 || got.Type != models.EventTopicCreated {
+		t.Errorf("received %+v", got)
+	}
+	if len(got.Topic.SamplePayload) != 0 || len(h.history[0].Topic.SamplePayload) != 0 {
+		t.Error("expected the sample payload to be left out of events")
+	}
+}
+
+func TestHub_SubscribeResume(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantIDs      []uint64
+		wantComplete bool
+	}{
+		{"up to date", 110, nil, true},
+		{"within buffer", 107, []uint64{108, 109, 110}, true},
+		{"oldest buffered is next", 105, []uint64{106, 107, 108, 109, 110}, true},
+		{"evicted", 102, []uint64{106, 107, 108, 109, 110}, false},
+		{"from before restart", 42, []uint64{106, 107, 108, 109, 110}, false},
+		{"last of previous run", 100, []uint64{106, 107, 108, 109, 110}, false},
+		{"not issued yet", 111, []uint64{106, 107, 108, 109, 110}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHub(5, 101)
+			publishN(h, 10)
+
+			sub, backlog, complete := h.Subscribe(tt.lastID)
+			defer sub.Close()
+
+			var ids []uint64
+			for _, e := range backlog {
+				ids = append(ids, e.ID)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("backlog IDs = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("backlog IDs = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestHub_DropsSlowSubscriber(t *testing.T) {
+	h := NewHub(8)
+	sub, _, _ := h.Subscribe(0)
+
+	publishN(h, subscriberQueue+1)
+
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberQueue {
+		t.Errorf("received %d events before drop, want %d", n, subscriberQueue)
+	}
+	// Closing an already dropped subscription is a no-op
+	sub.Close()
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub(8)
+	sub, _, _ := h.Subscribe(0)
+
+	h.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("expected subscription channel to be closed")
+	}
+
+	h.Publish(models.TopicEvent{})
+	late, _, complete := h.Subscribe(0)
+	if _, ok := <-late.C; ok || complete {
+		t.Error("expected subscriptions after Close to be closed and incomplete")
+	}
+}
+
+func TestNewHub_IDsGrowAcrossRestarts(t *testing.T) {
+	before := NewHub(8).Publish(models.TopicEvent{})
+	time.Sleep(time.Millisecond)
+	restarted := NewHub(8)
+
+	sub, _, complete := restarted.Subscribe(before.ID)
+	defer sub.Close()
+	if complete {
+		t.Error("expected an ID from before the restart to be incomplete")
+	}
+	if after := restarted.Publish(models.TopicEvent{}); after.ID <= before.ID {
+		t.Errorf("ID after restart = %d, want above %d", after.ID, before.ID)
+	}
+}
@@ -0,0 +1,290 @@
+// Writes catalog topics as CSV, NDJSON or Parquet, one row at a time
+package export
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mqtt-catalog/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+// Parquet buffers a whole row group in memory before writing it out, so row
+// groups end at whichever limit is reached first. The byte limit is what
+// bounds memory when rows carry large payloads
+const (
+	parquetRowGroupRows  = 4096
+	parquetRowGroupBytes = 16 << 20
+)
+
+var columns = []string{
+	"id", "broker_id", "topic", "payload_type", "payload_size",
+	"last_seen", "created_at", "truncated", "flags", "redacted", "sample_payload",
+}
+
+// Returns the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+func (f Format) Valid() bool {
+	return f == FormatCSV || f == FormatNDJSON || f == FormatParquet
+}
+
+// Encodes topics one at a time. Close must be called to complete the output
+type Writer interface {
+	Write(t models.Topic) error
+	Close() error
+}
+
+// Creates a writer for format. Without payloads the sample_payload column is
+// left out, otherwise payloads are base64-encoded
+func NewWriter(format Format, w io.Writer, withPayload bool) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, withPayload)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w), withPayload: withPayload}, nil
+	case FormatParquet:
+		if withPayload {
+			return newParquetWriter(w, withPayloadRow, parquetRowGroupBytes), nil
+		}
+		return newParquetWriter(w, newParquetRow, parquetRowGroupBytes), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	withPayload bool
+}
+
+func newCSVWriter(w io.Writer, withPayload bool) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), withPayload: withPayload}
+	header := columns
+	if !withPayload {
+		header = columns[:len(columns)-1]
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, fmt.Errorf("write csv header: %w", err)
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(t models.Topic) error {
+	record := []string{
+		strconv.FormatInt(t.ID, 10),
+		t.BrokerID,
+		t.Topic,
+		string(t.PayloadType),
+		strconv.Itoa(len(t.SamplePayload)),
+		t.LastSeen.UTC().Format(time.RFC3339Nano),
+		t.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatBool(t.Truncated),
+		strings.Join(t.Flags, ","),
+		strconv.FormatBool(t.Redacted),
+	}
+	if cw.withPayload {
+		record = append(record, base64.StdEncoding.EncodeToString(t.SamplePayload))
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// One NDJSON line with the same fields as the CSV columns, also the input
+// format of catalog imports
+type Record struct {
+	ID            int64              `json:"id"`
+	BrokerID      string             `json:"broker_id"`
+	Topic         string             `json:"topic"`
+	PayloadType   models.PayloadType `json:"payload_type"`
+	PayloadSize   int                `json:"payload_size"`
+	LastSeen      time.Time          `json:"last_seen"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Truncated     bool               `json:"truncated"`
+	Flags         []string           `json:"flags,omitempty"`
+	Redacted      bool               `json:"redacted"`
+	SamplePayload []byte             `json:"sample_payload,omitempty"`
+}
+
+type ndjsonWriter struct {
+	enc         *json.Encoder
+	withPayload bool
+}
+
+func (nw *ndjsonWriter) Write(t models.Topic) error {
+	row := Record{
+		ID:          t.ID,
+		BrokerID:    t.BrokerID,
+		Topic:       t.Topic,
+		PayloadType: t.PayloadType,
+		PayloadSize: len(t.SamplePayload),
+		LastSeen:    t.LastSeen.UTC(),
+		CreatedAt:   t.CreatedAt.UTC(),
+		Truncated:   t.Truncated,
+		Flags:       t.Flags,
+		Redacted:    t.Redacted,
+	}
+	if nw.withPayload {
+		// encoding/json writes []byte as base64; empty payloads still get the key
+		row.SamplePayload = t.SamplePayload
+		if row.SamplePayload == nil {
+			row.SamplePayload = []byte{}
+		}
+	}
+	return nw.enc.Encode(row)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+type parquetRow struct {
+	ID          int64     `parquet:"id,delta"`
+	BrokerID    string    `parquet:"broker_id,dict"`
+	Topic       string    `parquet:"topic"`
+	PayloadType string    `parquet:"payload_type,dict"`
+	PayloadSize int64     `parquet:"payload_size"`
+	LastSeen    time.Time `parquet:"last_seen,timestamp(millisecond)"`
+	CreatedAt   time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Truncated   bool      `parquet:"truncated"`
+	Flags       []string  `parquet:"flags,list"`
+	Redacted    bool      `parquet:"redacted"`
+}
+
+type parquetRowWithPayload struct {
+	ID            int64     `parquet:"id,delta"`
+	BrokerID      string    `parquet:"broker_id,dict"`
+	Topic         string    `parquet:"topic"`
+	PayloadType   string    `parquet:"payload_type,dict"`
+	PayloadSize   int64     `parquet:"payload_size"`
+	LastSeen      time.Time `parquet:"last_seen,timestamp(millisecond)"`
+	CreatedAt     time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Truncated     bool      `parquet:"truncated"`
+	Flags         []string  `parquet:"flags,list"`
+	Redacted      bool      `parquet:"redacted"`
+	SamplePayload string    `parquet:"sample_payload"`
+}
+
+func newParquetRow(t models.Topic) parquetRow {
+	return parquetRow{
+		ID:          t.ID,
+		BrokerID:    t.BrokerID,
+		Topic:       t.Topic,
+		PayloadType: string(t.PayloadType),
+		PayloadSize: int64(len(t.SamplePayload)),
+		LastSeen:    t.LastSeen.UTC(),
+		CreatedAt:   t.CreatedAt.UTC(),
+		Truncated:   t.Truncated,
+		Flags:       t.Flags,
+		Redacted:    t.Redacted,
+	}
+}
+
+func withPayloadRow(t models.Topic) parquetRowWithPayload {
+	r := newParquetRow(t)
+	return parquetRowWithPayload{
+		ID:            r.ID,
+		BrokerID:      r.BrokerID,
+		Topic:         r.Topic,
+		PayloadType:   r.PayloadType,
+		PayloadSize:   r.PayloadSize,
+		LastSeen:      r.LastSeen,
+		CreatedAt:     r.CreatedAt,
+		Truncated:     r.Truncated,
+		Flags:         r.Flags,
+		Redacted:      r.Redacted,
+		SamplePayload: base64.StdEncoding.EncodeToString(t.SamplePayload),
+	}
+}
+
+// Parquet has a fixed schema per file, so rows with and without the payload
+// column are separate types
+type parquetWriter[T interface{ size() int }] struct {
+	w        *parquet.GenericWriter[T]
+	convert  func(models.Topic) T
+	row      [1]T
+	maxBytes int
+	buffered int
+	rows     int
+}
+
+func newParquetWriter[T interface{ size() int }](w io.Writer, convert func(models.Topic) T, maxBytes int) *parquetWriter[T] {
+	return &parquetWriter[T]{
+		w:        parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(parquetRowGroupRows)),
+		convert:  convert,
+		maxBytes: maxBytes,
+	}
+}
+
+func (pw *parquetWriter[T]) Write(t models.Topic) error {
+	pw.row[0] = pw.convert(t)
+	if _, err := pw.w.Write(pw.row[:]); err != nil {
+		return err
+	}
+
+	// The writer starts a new group by itself after parquetRowGroupRows rows
+	pw.rows++
+	pw.buffered += pw.row[0].size()
+	if pw.rows >= parquetRowGroupRows {
+		pw.rows, pw.buffered = 0, 0
+	}
+	if pw.buffered < pw.maxBytes {
+		return nil
+	}
+	pw.rows, pw.buffered = 0, 0
+	if err := pw.w.Flush(); err != nil {
+		return fmt.Errorf("flush parquet row group: %w", err)
+	}
+	return nil
+}
+
+func (pw *parquetWriter[T]) Close() error {
+	return pw.w.Close()
+}
+
+// Approximate bytes a row takes in the row group buffer: the fixed-width
+// columns plus the variable-length ones
+const parquetFixedRowBytes = 8 * 5
+
+func (r parquetRow) size() int {
+	return parquetFixedRowBytes + len(r.BrokerID) + len(r.Topic) + len(r.PayloadType) + flagsSize(r.Flags)
+}
+
+func (r parquetRowWithPayload) size() int {
+	return parquetFixedRowBytes + len(r.BrokerID) + len(r.Topic) + len(r.PayloadType) + flagsSize(r.Flags) + len(r.SamplePayload)
+}
+
+func flagsSize(flags []string) int {
+	n := 0
+	for _, f := range flags {
+		n += len(f)
+	}
+	return n
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mqtt-catalog/pkg/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var testTopics = []models.Topic{
+	{ID: 1, BrokerID: "broker1", Topic: "plant1/temp", PayloadType: models.PayloadJSON, SamplePayload: []byte(`{"t": 21}`),
+		LastSeen: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC), CreatedAt: time.Date(2026, 4, 1, 8, 0, 0, 0, time.UTC)},
+	{ID: 2, BrokerID: "broker2", Topic: "raw,\"quoted\"", PayloadType: models.PayloadBinary, SamplePayload: []byte{0x00, 0xff},
+		LastSeen: time.Date(2026, 5, 2, 12, 0, 0, 0, time.UTC), CreatedAt: time.Date(2026, 4, 2, 8, 0, 0, 0, time.UTC), Truncated: true,
+		Flags: []string{"email", "jwt"}, Redacted: true},
+}
+
+func writeAll(t *testing.T, format Format, withPayload bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, withPayload)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for _, topic := range testTopics {
+		if err := w.Write(topic); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		withPayload bool
+		wantHeader  string
+		wantRow     []string
+	}{
+		{"with payload", true, strings.Join(columns, ","),
+			[]string{"2", "broker2", `raw,"quoted"`, "binary", "2", "2026-05-02T12:00:00Z", "2026-04-02T08:00:00Z", "true", "email,jwt", "true", "AP8="}},
+		{"without payload", false, strings.Join(columns[:len(columns)-1], ","),
+			[]string{"2", "broker2", `raw,"quoted"`, "binary", "2", "2026-05-02T12:00:00Z", "2026-04-02T08:00:00Z", "true", "email,jwt", "true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := csv.NewReader(bytes.NewReader(writeAll(t, FormatCSV, tt.withPayload))).ReadAll()
+			if err != nil {
+				t.Fatalf("invalid CSV: %v", err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("got %d records, want header and 2 rows", len(records))
+			}
+			if got := strings.Join(records[0], ","); got != tt.wantHeader {
+				t.Errorf("header = %s, want %s", got, tt.wantHeader)
+			}
+			if strings.Join(records[2], "|") != strings.Join(tt.wantRow, "|") {
+				t.Errorf("row = %q, want %q", records[2], tt.wantRow)
+			}
+		})
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	for _, withPayload := range []bool{true, false} {
+		scanner := bufio.NewScanner(bytes.NewReader(writeAll(t, FormatNDJSON, withPayload)))
+		var rows []map[string]any
+		for scanner.Scan() {
+			var row map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+			rows = append(rows, row)
+		}
+
+		if len(rows) != 2 || rows[0]["topic"] != "plant1/temp" || rows[1]["payload_size"] != 2.0 {
+			t.Fatalf("unexpected rows %v", rows)
+		}
+		if flags, _ := rows[1]["flags"].([]any); len(flags) != 2 || flags[1] != "jwt" || rows[1]["redacted"] != true {
+			t.Errorf("flags = %v, redacted = %v", rows[1]["flags"], rows[1]["redacted"])
+		}
+		payload, ok := rows[1]["sample_payload"]
+		if withPayload && payload != "AP8=" {
+			t.Errorf("sample_payload = %v, want AP8=", payload)
+		}
+		if !withPayload && ok {
+			t.Errorf("expected sample_payload to be left out, got %v", payload)
+		}
+	}
+}
+
+func TestParquet(t *testing.T) {
+	data := writeAll(t, FormatParquet, true)
+	rows, err := parquet.Read[parquetRowWithPayload](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid Parquet file: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if r := rows[1]; r.Topic != testTopics[1].Topic || r.SamplePayload != "AP8=" || !r.Truncated || !r.LastSeen.Equal(testTopics[1].LastSeen) ||
+		strings.Join(r.Flags, ",") != "email,jwt" || !r.Redacted {
+		t.Errorf("row = %+v", r)
+	}
+
+	data = writeAll(t, FormatParquet, false)
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid Parquet file: %v", err)
+	}
+	if _, ok := file.Schema().Lookup("sample_payload"); ok {
+		t.Error("expected sample_payload column to be left out")
+	}
+	if file.NumRows() != 2 {
+		t.Errorf("got %d rows, want 2", file.NumRows())
+	}
+}
+
+func TestParquetRowGroupBytes(t *testing.T) {
+	var buf bytes.Buffer
+	w := newParquetWriter(&buf, withPayloadRow, 1024)
+	topic := models.Topic{BrokerID: "b", Topic: "big", SamplePayload: bytes.Repeat([]byte{1}, 600)}
+	for i := 0; i < 4; i++ {
+		if err := w.Write(topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid Parquet file: %v", err)
+	}
+	// Each row is ~840 bytes base64-encoded, so every second row ends a group
+	if got := len(file.RowGroups()); got != 2 {
+		t.Errorf("got %d row groups, want 2", got)
+	}
+	if file.NumRows() != 4 {
+		t.Errorf("got %d rows, want 4", file.NumRows())
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("xlsx", &bytes.Buffer{}, true); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
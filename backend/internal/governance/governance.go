@@ -0,0 +1,140 @@
+// Checks catalogued topic names against the configured naming rules
+package governance
+
+import (
+	"fmt"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type rule struct {
+	config.GovernanceRule
+	pattern    *regexp.Regexp
+	disallowed *regexp.Regexp
+}
+
+type Linter struct {
+	rules []rule
+}
+
+// Compiles the rules of a governance config validated by config loading
+func NewLinter(cfg config.GovernanceConfig) *Linter {
+	l := &Linter{}
+	for _, r := range cfg.Rules {
+		compiled := rule{GovernanceRule: r}
+		if compiled.Severity == "" {
+			compiled.Severity = config.SeverityError
+		}
+		if r.Pattern != "" {
+			// The whole topic must match, not just a substring of it
+			compiled.pattern = regexp.MustCompile("^(?:" + r.Pattern + ")$")
+		}
+		if r.AllowedChars != "" {
+			compiled.disallowed = regexp.MustCompile("[^" + r.AllowedChars + "]")
+		}
+		l.rules = append(l.rules, compiled)
+	}
+	return l
+}
+
+// Returns the number of configured rules
+func (l *Linter) Rules() int {
+	return len(l.rules)
+}
+
+// Returns every violation of the topic on the given broker, one per failed
+// check, in rule order
+func (l *Linter) Check(brokerID, topic string) []models.GovernanceViolation {
+	var violations []models.GovernanceViolation
+	levels := strings.Split(topic, "/")
+
+	for _, r := range l.rules {
+		if len(r.Brokers) > 0 && !slices.Contains(r.Brokers, brokerID) {
+			continue
+		}
+
+		report := func(format string, args ...any) {
+			violations = append(violations, models.GovernanceViolation{
+				BrokerID: brokerID,
+				Topic:    topic,
+				Rule:     r.Name,
+				Severity: r.Severity,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		if r.pattern != nil && !r.pattern.MatchString(topic) {
+			report("does not match pattern %s", r.Pattern)
+		}
+		if r.MinDepth > 0 && len(levels) < r.MinDepth {
+			report("has %d levels, at least %d required", len(levels), r.MinDepth)
+		}
+		if r.MaxDepth > 0 && len(levels) > r.MaxDepth {
+			report("has %d levels, at most %d allowed", len(levels), r.MaxDepth)
+		}
+		if r.disallowed != nil {
+			for _, level := range levels {
+				if c := r.disallowed.FindString(level); c != "" {
+					report("contains %q, allowed characters are [%s]", c, r.AllowedChars)
+					break
+				}
+			}
+		}
+		for _, prefix := range r.ReservedPrefixes {
+			if strings.HasPrefix(topic, prefix) {
+				report("uses reserved prefix %q", prefix)
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+// Checks every topic matching opts, in topic order, and collects all
+// violations. Paging and sort fields of opts are ignored
+func (l *Linter) Lint(repo *repository.TopicRepository, opts repository.ListOptions) (*models.GovernanceReport, error) {
+	report := &models.GovernanceReport{
+		Rules:      len(l.rules),
+		Violations: []models.GovernanceViolation{},
+	}
+
+	err := repo.EachName(opts, func(brokerID, topic string) error {
+		l.record(report, brokerID, topic)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lint topics: %w", err)
+	}
+	return report, nil
+}
+
+// Checks topic names that are not catalogued yet, e.g. planned topics in CI
+func (l *Linter) LintNames(brokerID string, topics []string) *models.GovernanceReport {
+	report := &models.GovernanceReport{
+		Rules:      len(l.rules),
+		Violations: []models.GovernanceViolation{},
+	}
+	for _, topic := range topics {
+		l.record(report, brokerID, topic)
+	}
+	return report
+}
+
+// Checks one topic and adds its violations to the report totals
+func (l *Linter) record(report *models.GovernanceReport, brokerID, topic string) {
+	report.TopicsChecked++
+	for _, v := range l.Check(brokerID, topic) {
+		report.Violations = append(report.Violations, v)
+		report.Total++
+		if v.Severity == config.SeverityWarning {
+			report.Warnings++
+		} else {
+			report.Errors++
+		}
+	}
+}
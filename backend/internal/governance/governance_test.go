@@ -0,0 +1,106 @@
+package governance
+
+import (
+	"database/sql"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"testing"
+	"time"
+)
+
+var rules = config.GovernanceConfig{Rules: []config.GovernanceRule{
+	{Name: "structure", Pattern: `^[^/]+/[^/]+/[^/]+/[^/]+$`, Brokers: []string{"plant"}},
+	{Name: "depth", MinDepth: 2, MaxDepth: 5},
+	{Name: "lowercase", AllowedChars: "a-z0-9_-", Severity: config.SeverityWarning},
+	{Name: "reserved", ReservedPrefixes: []string{"$", "internal/"}},
+	{Name: "site", Pattern: `site[0-9]+/[a-z/]+`, Brokers: []string{"edge"}},
+}}
+
+func TestLinter_Check(t *testing.T) {
+	linter := NewLinter(rules)
+
+	tests := []struct {
+		broker string
+		topic  string
+		want   []string
+	}{
+		{"plant", "site1/area2/pump-3/pressure", nil},
+		{"plant", "site1/area2/pressure", []string{"structure: does not match pattern ^[^/]+/[^/]+/[^/]+/[^/]+$"}},
+		// Broker-scoped rules only apply to their brokers
+		{"lab", "site1/area2/pressure", nil},
+		{"lab", "temperature", []string{"depth: has 1 levels, at least 2 required"}},
+		{"lab", "a/b/c/d/e/f", []string{"depth: has 6 levels, at most 5 allowed"}},
+		{"lab", "Site1/Area 2", []string{`lowercase: contains "S", allowed characters are [a-z0-9_-]`}},
+		{"lab", "internal/debug", []string{`reserved: uses reserved prefix "internal/"`}},
+		// Unanchored patterns must still match the whole topic
+		{"edge", "site1/area/pressure", nil},
+		{"edge", "old/site1/area", []string{"site: does not match pattern site[0-9]+/[a-z/]+"}},
+		{"edge", "site1/area/Pressure", []string{
+			`lowercase: contains "P", allowed characters are [a-z0-9_-]`,
+			"site: does not match pattern site[0-9]+/[a-z/]+",
+		}},
+		{"lab", "$sys/x/Y", []string{
+			`lowercase: contains "$", allowed characters are [a-z0-9_-]`,
+			`reserved: uses reserved prefix "$"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			var got []string
+			for _, v := range linter.Check(tt.broker, tt.topic) {
+				got = append(got, v.Rule+": "+v.Message)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Check() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Check()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(database.SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return db
+}
+
+func TestLinter_Lint(t *testing.T) {
+	repo := repository.NewTopicRepository(setupTestDB(t))
+	for _, topic := range []string{"site1/area2/pump-3/pressure", "Site1/area2/pump-3/pressure", "internal/x", "ok/topic"} {
+		err := repo.Upsert(models.Sample{BrokerID: "plant", Topic: topic, PayloadType: models.PayloadText, Payload: []byte("1"), Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	report, err := NewLinter(rules).Lint(repo, repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("Lint() error = %v", err)
+	}
+	if report.Rules != len(rules.Rules) || report.TopicsChecked != 4 || report.Errors != 3 || report.Warnings != 1 || report.Total != 4 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	// Violations are ordered by topic
+	if report.Violations[0].Topic != "Site1/area2/pump-3/pressure" || report.Violations[0].Severity != config.SeverityWarning {
+		t.Errorf("first violation = %+v", report.Violations[0])
+	}
+
+	names := NewLinter(rules).LintNames("plant", []string{"site1/area2/pump-3/pressure"})
+	if names.TopicsChecked != 1 || names.Total != 0 {
+		t.Errorf("LintNames() = %+v", names)
+	}
+}
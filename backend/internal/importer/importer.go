@@ -0,0 +1,250 @@
+// Merges NDJSON catalog exports into the catalog through the regular upsert
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mqtt-catalog/internal/export"
+	"mqtt-catalog/internal/payload"
+	"mqtt-catalog/pkg/models"
+)
+
+// Decides which side wins when an imported topic already exists
+type Strategy string
+
+const (
+	// StrategyNewest replaces the stored topic when the import was seen later
+	StrategyNewest Strategy = "newest"
+	// StrategyKeep only adds topics that do not exist yet
+	StrategyKeep Strategy = "keep"
+	// StrategyOverwrite always replaces the stored topic
+	StrategyOverwrite Strategy = "overwrite"
+)
+
+// Conflicts and errors listed individually in a report
+const maxReportDetails = 100
+
+const (
+	ResolutionImported = "imported"
+	ResolutionExisting = "existing"
+)
+
+func (s Strategy) Valid() bool {
+	return s == StrategyNewest || s == StrategyKeep || s == StrategyOverwrite
+}
+
+type Options struct {
+	Strategy Strategy
+	// BrokerPrefix is prepended to every imported broker_id, e.g. "staging-"
+	BrokerPrefix string
+	// DryRun reports what would change without writing
+	DryRun bool
+	// Payloads over MaxSampleBytes are cut when TruncateSamples is set and
+	// rejected otherwise, 0 disables the cap
+	MaxSampleBytes  int
+	TruncateSamples bool
+}
+
+// The repository operations an import needs. SaveAll stores every sample or,
+// on error, none of them
+type Store interface {
+	GetByBrokerAndTopic(brokerID, topic string) (*models.Topic, error)
+	SaveAll(samples []models.Sample) error
+}
+
+// Reads one export record per line from r and merges it into store. Invalid
+// lines are reported and skipped. The whole input is read and checked before
+// anything is written, and the changes are applied together, so a read or
+// store error leaves the catalog untouched and returns no report
+func Import(r io.Reader, store Store, opts Options) (*models.ImportReport, error) {
+	if !opts.Strategy.Valid() {
+		return nil, fmt.Errorf("unknown import strategy %q", opts.Strategy)
+	}
+
+	report := &models.ImportReport{
+		DryRun:          opts.DryRun,
+		ConflictDetails: []models.ImportConflict{},
+		Errors:          []models.ImportError{},
+	}
+
+	imp := &importRun{store: store, opts: opts, report: report, pending: make(map[[2]string]models.Topic)}
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("read line %d: %w", line, readErr)
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			if err := imp.line(data, line); err != nil {
+				return nil, err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if !opts.DryRun && len(imp.writes) > 0 {
+		if err := store.SaveAll(imp.writes); err != nil {
+			return nil, fmt.Errorf("apply import: %w", err)
+		}
+	}
+	return report, nil
+}
+
+type importRun struct {
+	store  Store
+	opts   Options
+	report *models.ImportReport
+	// Topics the import will write, so later lines for the same topic are
+	// judged against them rather than against the store
+	pending map[[2]string]models.Topic
+	writes  []models.Sample
+}
+
+// Returns the stored topic, or the version the import will store
+func (imp *importRun) lookup(brokerID, topic string) (*models.Topic, error) {
+	if t, ok := imp.pending[[2]string{brokerID, topic}]; ok {
+		return &t, nil
+	}
+	return imp.store.GetByBrokerAndTopic(brokerID, topic)
+}
+
+func (imp *importRun) line(data []byte, line int) error {
+	opts, report := imp.opts, imp.report
+
+	sample, err := parseRecord(data, opts)
+	if err != nil {
+		imp.fail(line, err)
+		return nil
+	}
+
+	existing, err := imp.lookup(sample.BrokerID, sample.Topic)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+
+	// Exports made with payload=omit carry no sample: the stored sample is
+	// kept and only last_seen is merged, and new topics cannot be created
+	if sample.Payload == nil {
+		if existing == nil {
+			imp.fail(line, errors.New("sample_payload is required for topics not in the catalog"))
+			return nil
+		}
+		sample.PayloadType, sample.Payload, sample.Truncated = existing.PayloadType, existing.SamplePayload, existing.Truncated
+		sample.Flags, sample.Redacted = existing.Flags, existing.Redacted
+	}
+
+	write := existing == nil
+	if existing != nil {
+		switch opts.Strategy {
+		case StrategyOverwrite:
+			write = true
+		case StrategyNewest:
+			write = sample.Timestamp.After(existing.LastSeen)
+		}
+
+		if existing.PayloadType != sample.PayloadType || !bytes.Equal(existing.SamplePayload, sample.Payload) {
+			report.Conflicts++
+			if len(report.ConflictDetails) < maxReportDetails {
+				resolution := ResolutionExisting
+				if write {
+					resolution = ResolutionImported
+				}
+				report.ConflictDetails = append(report.ConflictDetails, models.ImportConflict{
+					Line:                line,
+					BrokerID:            sample.BrokerID,
+					Topic:               sample.Topic,
+					ExistingPayloadType: existing.PayloadType,
+					ImportedPayloadType: sample.PayloadType,
+					ExistingLastSeen:    existing.LastSeen,
+					ImportedLastSeen:    sample.Timestamp,
+					Resolution:          resolution,
+				})
+			}
+		}
+	}
+
+	switch {
+	case !write:
+		report.Skipped++
+		return nil
+	case existing == nil:
+		report.Inserted++
+	default:
+		report.Updated++
+	}
+
+	imp.pending[[2]string{sample.BrokerID, sample.Topic}] = models.Topic{
+		BrokerID:      sample.BrokerID,
+		Topic:         sample.Topic,
+		PayloadType:   sample.PayloadType,
+		SamplePayload: sample.Payload,
+		LastSeen:      sample.Timestamp,
+		Truncated:     sample.Truncated,
+		Flags:         sample.Flags,
+		Redacted:      sample.Redacted,
+	}
+	if !opts.DryRun {
+		imp.writes = append(imp.writes, sample)
+	}
+	return nil
+}
+
+// Reports an invalid record; the import continues with the next line
+func (imp *importRun) fail(line int, err error) {
+	imp.report.Failed++
+	if len(imp.report.Errors) < maxReportDetails {
+		imp.report.Errors = append(imp.report.Errors, models.ImportError{Line: line, Message: err.Error()})
+	}
+}
+
+// Validates an export record and converts it to the sample the upsert
+// stores. A record without sample_payload yields a nil payload
+func parseRecord(data []byte, opts Options) (models.Sample, error) {
+	var rec export.Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return models.Sample{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if rec.BrokerID == "" || rec.Topic == "" {
+		return models.Sample{}, errors.New("broker_id and topic are required")
+	}
+	if rec.LastSeen.IsZero() {
+		return models.Sample{}, errors.New("last_seen is required")
+	}
+
+	switch rec.PayloadType {
+	case models.PayloadJSON, models.PayloadXML, models.PayloadText, models.PayloadBinary:
+	case "":
+		rec.PayloadType = payload.DetectType(rec.SamplePayload)
+	default:
+		return models.Sample{}, fmt.Errorf("invalid payload_type %q", rec.PayloadType)
+	}
+
+	sample := models.Sample{
+		BrokerID:    opts.BrokerPrefix + rec.BrokerID,
+		Topic:       rec.Topic,
+		PayloadType: rec.PayloadType,
+		Payload:     rec.SamplePayload,
+		Timestamp:   rec.LastSeen.UTC(),
+		Truncated:   rec.Truncated,
+		Flags:       rec.Flags,
+		Redacted:    rec.Redacted,
+		CreatedAt:   rec.CreatedAt,
+	}
+	if limit := opts.MaxSampleBytes; limit > 0 && len(sample.Payload) > limit {
+		if !opts.TruncateSamples {
+			return models.Sample{}, fmt.Errorf("sample payload exceeds %d bytes", limit)
+		}
+		sample.Payload = payload.Truncate(sample.Payload, sample.PayloadType, limit)
+		sample.Truncated = true
+	}
+	return sample, nil
+}
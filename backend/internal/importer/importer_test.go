@@ -0,0 +1,223 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mqtt-catalog/pkg/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// In-memory store keyed by broker and topic
+type memStore struct {
+	topics map[string]models.Topic
+	saves  int
+	err    error
+}
+
+func newMemStore(topics ...models.Topic) *memStore {
+	s := &memStore{topics: map[string]models.Topic{}}
+	for _, t := range topics {
+		s.topics[t.BrokerID+"|"+t.Topic] = t
+	}
+	return s
+}
+
+func (s *memStore) GetByBrokerAndTopic(brokerID, topic string) (*models.Topic, error) {
+	if t, ok := s.topics[brokerID+"|"+topic]; ok {
+		return &t, nil
+	}
+	return nil, nil
+}
+
+func (s *memStore) SaveAll(samples []models.Sample) error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, sample := range samples {
+		s.saves++
+		s.topics[sample.BrokerID+"|"+sample.Topic] = models.Topic{
+			BrokerID:      sample.BrokerID,
+			Topic:         sample.Topic,
+			PayloadType:   sample.PayloadType,
+			SamplePayload: sample.Payload,
+			LastSeen:      sample.Timestamp,
+			CreatedAt:     sample.CreatedAt,
+			Truncated:     sample.Truncated,
+		}
+	}
+	return nil
+}
+
+var base = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func record(broker, topic, payloadType, payload string, lastSeen time.Time) string {
+	return fmt.Sprintf(`{"broker_id":%q,"topic":%q,"payload_type":%q,"sample_payload":%q,"last_seen":%q,"created_at":%q}`,
+		broker, topic, payloadType, payload, lastSeen.Format(time.RFC3339), base.AddDate(0, -1, 0).Format(time.RFC3339))
+}
+
+func existingTopics() []models.Topic {
+	return []models.Topic{
+		// Same sample as imported, no conflict
+		{BrokerID: "prod", Topic: "a", PayloadType: models.PayloadText, SamplePayload: []byte("on"), LastSeen: base},
+		// Older than the import
+		{BrokerID: "prod", Topic: "b", PayloadType: models.PayloadText, SamplePayload: []byte("old"), LastSeen: base.Add(-time.Hour)},
+		// Newer than the import
+		{BrokerID: "prod", Topic: "c", PayloadType: models.PayloadJSON, SamplePayload: []byte("{}"), LastSeen: base.Add(time.Hour)},
+	}
+}
+
+func importInput() string {
+	return strings.Join([]string{
+		record("prod", "a", "text", "b24=", base),     // "on"
+		record("prod", "b", "text", "bmV3", base),     // "new"
+		record("prod", "c", "text", "dGV4dA==", base), // "text"
+		record("prod", "d", "", "PHg+PC94Pg==", base), // "<x></x>", type detected
+		"",
+		`{"broker_id": "prod"}`,
+		`not json`,
+		record("prod", "e", "yaml", "", base),
+	}, "\n")
+}
+
+func TestImport_Strategies(t *testing.T) {
+	tests := []struct {
+		strategy    Strategy
+		wantUpdated int
+		wantSkipped int
+		wantB       string
+		wantC       string
+	}{
+		{StrategyNewest, 1, 2, "new", "{}"},
+		{StrategyKeep, 0, 3, "old", "{}"},
+		{StrategyOverwrite, 3, 0, "new", "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			store := newMemStore(existingTopics()...)
+			report, err := Import(strings.NewReader(importInput()), store, Options{Strategy: tt.strategy})
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+
+			if report.Inserted != 1 || report.Updated != tt.wantUpdated || report.Skipped != tt.wantSkipped {
+				t.Errorf("inserted/updated/skipped = %d/%d/%d, want 1/%d/%d",
+					report.Inserted, report.Updated, report.Skipped, tt.wantUpdated, tt.wantSkipped)
+			}
+			if report.Conflicts != 2 || report.Failed != 3 || len(report.Errors) != 3 {
+				t.Errorf("conflicts %d, failed %d, errors %+v", report.Conflicts, report.Failed, report.Errors)
+			}
+			if report.Errors[0].Line != 6 {
+				t.Errorf("first error on line %d, want 6", report.Errors[0].Line)
+			}
+
+			if got := string(store.topics["prod|b"].SamplePayload); got != tt.wantB {
+				t.Errorf("topic b = %q, want %q", got, tt.wantB)
+			}
+			if got := string(store.topics["prod|c"].SamplePayload); got != tt.wantC {
+				t.Errorf("topic c = %q, want %q", got, tt.wantC)
+			}
+
+			d := store.topics["prod|d"]
+			if d.PayloadType != models.PayloadXML || !d.CreatedAt.Equal(base.AddDate(0, -1, 0)) {
+				t.Errorf("inserted topic = %+v, want detected xml with the exported created_at", d)
+			}
+		})
+	}
+}
+
+func TestImport_DryRun(t *testing.T) {
+	store := newMemStore(existingTopics()...)
+	// The same new topic twice: an insert followed by an update
+	input := importInput() + "\n" + record("prod", "d", "text", "eA==", base.Add(time.Minute))
+
+	report, err := Import(strings.NewReader(input), store, Options{Strategy: StrategyNewest, DryRun: true})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if store.saves != 0 {
+		t.Errorf("dry run saved %d topics", store.saves)
+	}
+	if !report.DryRun || report.Inserted != 1 || report.Updated != 2 || report.Skipped != 2 || report.Conflicts != 3 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	var resolutions []string
+	for _, c := range report.ConflictDetails {
+		resolutions = append(resolutions, c.Topic+"="+c.Resolution)
+	}
+	if got := strings.Join(resolutions, ","); got != "b=imported,c=existing,d=imported" {
+		t.Errorf("conflicts = %s", got)
+	}
+}
+
+func TestImport_BrokerPrefix(t *testing.T) {
+	store := newMemStore(existingTopics()...)
+	report, err := Import(strings.NewReader(importInput()), store, Options{Strategy: StrategyKeep, BrokerPrefix: "staging-"})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if report.Inserted != 4 || report.Conflicts != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if _, ok := store.topics["staging-prod|a"]; !ok {
+		t.Error("expected topic under the prefixed broker ID")
+	}
+}
+
+func TestImport_PayloadLimit(t *testing.T) {
+	input := record("prod", "big", "text", "MDEyMzQ1Njc4OQ==", base) // 10 bytes
+
+	store := newMemStore()
+	report, _ := Import(strings.NewReader(input), store, Options{Strategy: StrategyNewest, MaxSampleBytes: 4})
+	if report.Failed != 1 || store.saves != 0 {
+		t.Errorf("expected oversized payload to be rejected, got %+v", report)
+	}
+
+	report, _ = Import(strings.NewReader(input), store, Options{Strategy: StrategyNewest, MaxSampleBytes: 4, TruncateSamples: true})
+	if big := store.topics["prod|big"]; report.Inserted != 1 || string(big.SamplePayload) != "0123" || !big.Truncated {
+		t.Errorf("expected truncated payload, got %+v", big)
+	}
+}
+
+// Fails after the given input, like a body cut off by the size limit
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestImport_ReadErrorWritesNothing(t *testing.T) {
+	store := newMemStore(existingTopics()...)
+	input := &failingReader{r: strings.NewReader(importInput() + "\n"), err: errors.New("body too large")}
+
+	report, err := Import(input, store, Options{Strategy: StrategyOverwrite})
+	if err == nil || report != nil {
+		t.Errorf("Import() = %+v, %v, want the read error without a report", report, err)
+	}
+	if store.saves != 0 {
+		t.Errorf("import saved %d topics before failing to read its input", store.saves)
+	}
+}
+
+func TestImport_StoreError(t *testing.T) {
+	store := newMemStore()
+	store.err = errors.New("disk full")
+
+	if report, err := Import(strings.NewReader(importInput()), store, Options{Strategy: StrategyOverwrite}); err == nil || report != nil {
+		t.Errorf("Import() = %+v, %v, want the store error without a report", report, err)
+	}
+	if _, err := Import(strings.NewReader(""), store, Options{Strategy: "merge"}); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
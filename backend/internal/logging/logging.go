@@ -0,0 +1,63 @@
+// Structured logging setup and request-scoped loggers built on log/slog
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey struct{}
+
+type requestIDKey struct{}
+
+// Creates a logger writing text or JSON records at the given minimum level
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// Returns a copy of ctx carrying a logger tagged with the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	logger := FromContext(ctx).With("request_id", requestID)
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// Returns the request ID set by WithRequestID, empty outside a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Returns the request-scoped logger, or the default logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Generates a random 16-byte hex request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
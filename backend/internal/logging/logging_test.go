@@ -0,0 +1,60 @@
+// Tests logger construction and request-scoped loggers
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := New(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	logger.Info("hidden")
+	logger.Warn("shown", "broker_id", "broker1")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q", buf.String())
+	}
+
+	if record["msg"] != "shown" || record["broker_id"] != "broker1" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("expected error for invalid format, got nil")
+	}
+
+	if _, err := New(&bytes.Buffer{}, "text", "loud"); err == nil {
+		t.Error("expected error for invalid level, got nil")
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "json", "info")
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	FromContext(ctx).Info("handled")
+
+	var record map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &record)
+
+	if record["request_id"] != "req-1" {
+		t.Errorf("expected request_id req-1, got %v", record["request_id"])
+	}
+}
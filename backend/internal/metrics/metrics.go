@@ -0,0 +1,133 @@
+// Prometheus metrics exposed by the collector and the API server
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collector metrics, labelled by broker_id
+var (
+	BrokerConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mqtt_collector_broker_connected",
+		Help: "Whether the collector is currently connected to the broker (1) or not (0).",
+	}, []string{"broker_id"})
+
+	BrokerReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_broker_reconnects_total",
+		Help: "Number of reconnect attempts after a lost broker connection.",
+	}, []string{"broker_id"})
+
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_messages_received_total",
+		Help: "Number of MQTT messages received from the broker.",
+	}, []string{"broker_id"})
+
+	TopicsSampled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_topics_sampled_total",
+		Help: "Number of unique topics sampled from the broker.",
+	}, []string{"broker_id"})
+
+	TopicsPreloaded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mqtt_collector_topics_preloaded",
+		Help: "Recently sampled topics loaded from the catalog at start and skipped.",
+	}, []string{"broker_id"})
+
+	TopicPatterns = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mqtt_collector_topic_patterns",
+		Help: "Topic levels collapsed into {id} because of their cardinality.",
+	}, []string{"broker_id"})
+
+	TrackedTopicsEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_tracked_topics_evicted_total",
+		Help: "Sampled topics forgotten because the tracked topic limit was reached.",
+	}, []string{"broker_id"})
+
+	SampleSendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mqtt_collector_sample_send_duration_seconds",
+		Help:    "Latency of sending a sample to the API server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"broker_id"})
+
+	SampleSendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_sample_send_errors_total",
+		Help: "Number of samples that could not be sent to the API server.",
+	}, []string{"broker_id"})
+
+	SamplesFlagged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_samples_flagged_total",
+		Help: "Number of samples in which a detector found likely PII or secrets.",
+	}, []string{"broker_id", "detector"})
+
+	SampleClaims = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_collector_sample_claims_total",
+		Help: "Topic claims of shared subscriptions by result (claimed, taken, error).",
+	}, []string{"broker_id", "result"})
+
+	BrokersLeased = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mqtt_collector_brokers_leased",
+		Help: "Brokers this collector instance holds a lease on when sharding is enabled.",
+	})
+
+	LeaseRenewErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_collector_lease_renew_errors_total",
+		Help: "Failed renewals of this collector instance's broker leases.",
+	})
+)
+
+// API server metrics
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mqtt_catalog_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route pattern, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_catalog_http_requests_rejected_total",
+		Help: "Requests rejected before reaching a handler, by route and reason (rate_limited, body_too_large).",
+	}, []string{"route", "reason"})
+
+	SamplesTruncated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_catalog_samples_truncated_total",
+		Help: "Samples whose payload was truncated to the maximum stored size.",
+	})
+
+	TailSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mqtt_catalog_tail_sessions",
+		Help: "Live message tail sessions currently open.",
+	})
+
+	TailMessagesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_catalog_tail_messages_dropped_total",
+		Help: "Tailed messages not forwarded because a session exceeded its rate cap.",
+	})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mqtt_catalog_webhook_delivery_attempts_total",
+		Help: "Webhook delivery attempts, by result (succeeded, retrying, failed).",
+	}, []string{"result"})
+
+	RepositoryQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mqtt_catalog_repository_query_duration_seconds",
+		Help:    "Latency of repository operations against the database.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+// Starts timing a repository operation; call the returned func when it is done
+func TimeQuery(operation string) func() {
+	start := time.Now()
+	return func() {
+		RepositoryQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Serves all registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,104 @@
+// Derives the field structure of sampled payloads to detect schema drift
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mqtt-catalog/pkg/models"
+	"slices"
+	"strings"
+)
+
+// Returns the sorted field paths of a JSON or XML payload: nested JSON keys
+// joined with dots and array elements marked with [] (reading.temp,
+// items[].id), XML elements joined with slashes and attributes after @
+// (device/temp@unit). ok is false for other payload types and payloads that
+// do not parse
+func FieldPaths(data []byte, payloadType models.PayloadType) (paths []string, ok bool) {
+	fields := map[string]bool{}
+
+	switch payloadType {
+	case models.PayloadJSON:
+		var v any
+		if json.Unmarshal(data, &v) != nil {
+			return nil, false
+		}
+		collectJSONPaths(v, "", fields)
+	case models.PayloadXML:
+		if !collectXMLPaths(data, fields) {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	paths = make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths, true
+}
+
+func collectJSONPaths(v any, prefix string, fields map[string]bool) {
+	switch val := v.(type) {
+	case map[string]any:
+		for key, child := range val {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			fields[path] = true
+			collectJSONPaths(child, path, fields)
+		}
+	case []any:
+		for _, child := range val {
+			collectJSONPaths(child, prefix+"[]", fields)
+		}
+	}
+}
+
+func collectXMLPaths(data []byte, fields map[string]bool) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return len(fields) > 0
+		}
+		if err != nil {
+			return false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			path := strings.Join(stack, "/")
+			fields[path] = true
+			for _, attr := range t.Attr {
+				fields[path+"@"+attr.Name.Local] = true
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// Returns the paths only in after and the paths only in before, both sorted
+func DiffFields(before, after []string) (added, removed []string) {
+	for _, path := range after {
+		if _, found := slices.BinarySearch(before, path); !found {
+			added = append(added, path)
+		}
+	}
+	for _, path := range before {
+		if _, found := slices.BinarySearch(after, path); !found {
+			removed = append(removed, path)
+		}
+	}
+	return added, removed
+}
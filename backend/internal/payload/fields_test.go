@@ -0,0 +1,81 @@
+// Tests field path extraction and schema drift detection
+package payload
+
+import (
+	"mqtt-catalog/pkg/models"
+	"slices"
+	"testing"
+)
+
+func TestFieldPaths(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		payloadType models.PayloadType
+		want        []string
+		wantOK      bool
+	}{
+		{
+			name:        "nested JSON",
+			payload:     `{"serial": "SN-1", "reading": {"temp": 21.5, "unit": "C"}}`,
+			payloadType: models.PayloadJSON,
+			want:        []string{"reading", "reading.temp", "reading.unit", "serial"},
+			wantOK:      true,
+		},
+		{
+			name:        "JSON arrays",
+			payload:     `{"items": [{"id": 1}, {"id": 2, "name": "b"}]}`,
+			payloadType: models.PayloadJSON,
+			want:        []string{"items", "items[].id", "items[].name"},
+			wantOK:      true,
+		},
+		{
+			name:        "top-level array",
+			payload:     `[{"id": 1}]`,
+			payloadType: models.PayloadJSON,
+			want:        []string{"[].id"},
+			wantOK:      true,
+		},
+		{
+			name:        "XML elements and attributes",
+			payload:     `<device serial="SN-9"><temp unit="C">21</temp></device>`,
+			payloadType: models.PayloadXML,
+			want:        []string{"device", "device/temp", "device/temp@unit", "device@serial"},
+			wantOK:      true,
+		},
+		{
+			name:        "invalid JSON",
+			payload:     `{"cut": "off`,
+			payloadType: models.PayloadJSON,
+		},
+		{
+			name:        "text has no fields",
+			payload:     `running`,
+			payloadType: models.PayloadText,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FieldPaths([]byte(tt.payload), tt.payloadType)
+			if ok != tt.wantOK || !slices.Equal(got, tt.want) {
+				t.Errorf("FieldPaths() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	added, removed := DiffFields(
+		[]string{"reading", "reading.temp", "serial"},
+		[]string{"reading", "reading.humidity", "reading.temp"},
+	)
+	if !slices.Equal(added, []string{"reading.humidity"}) || !slices.Equal(removed, []string{"serial"}) {
+		t.Errorf("DiffFields() = %v, %v", added, removed)
+	}
+
+	added, removed = DiffFields([]string{"a"}, []string{"a"})
+	if added != nil || removed != nil {
+		t.Errorf("DiffFields() of equal fields = %v, %v", added, removed)
+	}
+}
@@ -0,0 +1,282 @@
+// Flags likely PII and secrets in sampled payloads and optionally redacts them
+package payload
+
+import (
+	"math"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/pkg/models"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// A span of a payload flagged by a detector
+type Finding struct {
+	Detector string
+	Start    int
+	End      int
+}
+
+type detector struct {
+	name string
+	// Only the first capture group taking part in a match is flagged, the
+	// whole match when there is none
+	re    *regexp.Regexp
+	valid func(span []byte) bool
+}
+
+var builtinDetectors = map[string]detector{
+	"email": {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	// International numbers or numbers with an area code in parentheses, so
+	// dates and plain readings are left alone
+	"phone": {
+		re:    regexp.MustCompile(`(?:\+[1-9]\d{0,2}|\(\d{2,4}\))[ .-]?\d{1,4}(?:[ .-]?\d{2,4}){1,4}`),
+		valid: digitCount(8, 15),
+	},
+	// Decimal coordinate pairs and values of lat/lon fields
+	"gps": {
+		re:    regexp.MustCompile(`(?i)-?\b\d{1,2}\.\d{4,}\s*,\s*-?\d{1,3}\.\d{4,}\b|\b(?:lat|latitude|lon|lng|long|longitude)["']?\s*[:=]\s*["']?(-?\d{1,3}\.\d{3,})`),
+		valid: validCoordinates,
+	},
+	"credit_card": {
+		re:    regexp.MustCompile(`\b[3-6]\d{3}(?:[ -]?\d{4}){2}[ -]?\d{3,4}\b`),
+		valid: luhn,
+	},
+	"private_key":    {re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[A-Za-z0-9+/=\s\\]*(?:-----END [A-Z ]*PRIVATE KEY-----)?`)},
+	"aws_access_key": {re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	"jwt":            {re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	// Values assigned to credential-like keys in JSON, query strings and
+	// key=value text, or enclosed in credential-like XML elements
+	"credential": {re: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|client[_-]?secret|api[_-]?key|access[_-]?token|auth[_-]?token)["']?\s*[:=]\s*["']?([^\s"',;&}<]{4,})|<(?:password|secret|api_?key|token)>([^<]{4,})</`)},
+}
+
+// Candidates for the high_entropy detector: base64 and URL-safe tokens
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_-]+`)
+
+type Scanner struct {
+	detectors        []detector
+	entropy          bool
+	entropyThreshold float64
+	entropyMinLength int
+	redact           bool
+}
+
+// Builds the detectors of a scan config validated by config loading
+func NewScanner(cfg config.ScanConfig) *Scanner {
+	s := &Scanner{
+		entropyThreshold: cfg.EntropyThreshold,
+		entropyMinLength: cfg.EntropyMinLength,
+		redact:           cfg.Redact,
+	}
+	for _, name := range cfg.Detectors {
+		if name == "high_entropy" {
+			s.entropy = true
+			continue
+		}
+		d := builtinDetectors[name]
+		d.name = name
+		s.detectors = append(s.detectors, d)
+	}
+	for _, p := range cfg.Patterns {
+		s.detectors = append(s.detectors, detector{name: p.Name, re: regexp.MustCompile(p.Pattern)})
+	}
+	return s
+}
+
+// Returns the non-overlapping spans flagged in a payload, ordered by
+// position. Pattern detectors take precedence over high_entropy; binary
+// payloads are not scanned
+func (s *Scanner) Scan(data []byte, payloadType models.PayloadType) []Finding {
+	if payloadType == models.PayloadBinary || len(data) == 0 {
+		return nil
+	}
+
+	var candidates []Finding
+	for _, d := range s.detectors {
+		for _, m := range d.re.FindAllSubmatchIndex(data, -1) {
+			start, end := m[0], m[1]
+			for g := 2; g < len(m); g += 2 {
+				if m[g] >= 0 {
+					start, end = m[g], m[g+1]
+					break
+				}
+			}
+			if end > start && (d.valid == nil || d.valid(data[start:end])) {
+				candidates = append(candidates, Finding{Detector: d.name, Start: start, End: end})
+			}
+		}
+	}
+
+	// Earlier spans win, at the same position the longer one
+	slices.SortStableFunc(candidates, func(a, b Finding) int {
+		if a.Start != b.Start {
+			return a.Start - b.Start
+		}
+		return b.End - a.End
+	})
+	var findings []Finding
+	for _, f := range candidates {
+		if len(findings) == 0 || f.Start >= findings[len(findings)-1].End {
+			findings = append(findings, f)
+		}
+	}
+
+	if s.entropy {
+		for _, m := range tokenPattern.FindAllIndex(data, -1) {
+			token := data[m[0]:m[1]]
+			if len(token) < s.entropyMinLength || overlaps(findings, m[0], m[1]) || shannonEntropy(token) < s.entropyThreshold {
+				continue
+			}
+			findings = append(findings, Finding{Detector: "high_entropy", Start: m[0], End: m[1]})
+		}
+		slices.SortFunc(findings, func(a, b Finding) int { return a.Start - b.Start })
+	}
+
+	return findings
+}
+
+// Scans the sample payload, records the detectors that fired in its flags
+// and redacts the flagged spans when the scanner is configured to
+func (s *Scanner) Apply(sample *models.Sample) []Finding {
+	findings := s.Scan(sample.Payload, sample.PayloadType)
+	sample.Flags = Flags(findings)
+	if s.redact && len(findings) > 0 {
+		sample.Payload = Redact(sample.Payload, sample.PayloadType, findings)
+		sample.Redacted = true
+	}
+	return findings
+}
+
+// Returns the sorted names of the detectors that produced findings
+func Flags(findings []Finding) []string {
+	var flags []string
+	for _, f := range findings {
+		if !slices.Contains(flags, f.Detector) {
+			flags = append(flags, f.Detector)
+		}
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+// Replaces every finding with [REDACTED:<detector>]. Spans outside string
+// values of a JSON payload are replaced with a quoted marker so the payload
+// stays valid JSON
+func Redact(data []byte, payloadType models.PayloadType, findings []Finding) []byte {
+	var inString []bool
+	if payloadType == models.PayloadJSON {
+		inString = jsonStringMask(data)
+	}
+
+	out := make([]byte, 0, len(data))
+	last := 0
+	for _, f := range findings {
+		out = append(out, data[last:f.Start]...)
+		marker := "[REDACTED:" + f.Detector + "]"
+		if inString != nil && !inString[f.Start] {
+			marker = strconv.Quote(marker)
+		}
+		out = append(out, marker...)
+		last = f.End
+	}
+	return append(out, data[last:]...)
+}
+
+// Reports for every byte of a JSON document whether it lies inside a string
+func jsonStringMask(data []byte) []bool {
+	mask := make([]bool, len(data))
+	inString, escaped := false, false
+	for i, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+			continue
+		}
+		mask[i] = inString
+	}
+	return mask
+}
+
+func overlaps(findings []Finding, start, end int) bool {
+	for _, f := range findings {
+		if start < f.End && f.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the Shannon entropy of data in bits per byte
+func shannonEntropy(data []byte) float64 {
+	var counts [256]int
+	for _, c := range data {
+		counts[c]++
+	}
+	var entropy float64
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+func digitCount(min, max int) func([]byte) bool {
+	return func(span []byte) bool {
+		n := 0
+		for _, c := range span {
+			if c >= '0' && c <= '9' {
+				n++
+			}
+		}
+		return n >= min && n <= max
+	}
+}
+
+var numberPattern = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+
+// Accepts a coordinate pair or single value within latitude/longitude range
+func validCoordinates(span []byte) bool {
+	numbers := numberPattern.FindAll(span, 2)
+	for i, n := range numbers {
+		v, err := strconv.ParseFloat(string(n), 64)
+		limit := 180.0
+		if len(numbers) == 2 && i == 0 {
+			limit = 90
+		}
+		if err != nil || math.Abs(v) > limit {
+			return false
+		}
+	}
+	return len(numbers) > 0
+}
+
+// Checks a card number candidate against the Luhn checksum
+func luhn(span []byte) bool {
+	var digits []int
+	for _, c := range span {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 15 || len(digits) > 16 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,85 @@
+// Extracts searchable text from sampled payloads for full-text indexing
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mqtt-catalog/pkg/models"
+	"sort"
+	"strings"
+)
+
+// Returns the words worth indexing for a payload: field names and scalar values
+// for JSON, element/attribute names and character data for XML, the raw text for
+// text payloads and nothing for binary data
+func ExtractText(data []byte, payloadType models.PayloadType) string {
+	switch payloadType {
+	case models.PayloadJSON:
+		var v interface{}
+		if json.Unmarshal(data, &v) != nil {
+			return ""
+		}
+		var words []string
+		collectJSON(v, &words)
+		return strings.Join(words, " ")
+	case models.PayloadXML:
+		return extractXML(data)
+	case models.PayloadText:
+		return string(data)
+	default:
+		return ""
+	}
+}
+
+func collectJSON(v interface{}, words *[]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		// Sorted keys keep the extracted text stable between samples
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			*words = append(*words, k)
+			collectJSON(val[k], words)
+		}
+	case []interface{}:
+		for _, item := range val {
+			collectJSON(item, words)
+		}
+	case string:
+		*words = append(*words, val)
+	case nil:
+	default:
+		*words = append(*words, fmt.Sprint(val))
+	}
+}
+
+func extractXML(data []byte) string {
+	var words []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch tok := token.(type) {
+		case xml.StartElement:
+			words = append(words, tok.Name.Local)
+			for _, attr := range tok.Attr {
+				words = append(words, attr.Name.Local, attr.Value)
+			}
+		case xml.CharData:
+			if text := strings.TrimSpace(string(tok)); text != "" {
+				words = append(words, text)
+			}
+		}
+	}
+
+	return strings.Join(words, " ")
+}
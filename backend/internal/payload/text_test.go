@@ -0,0 +1,55 @@
+// Tests searchable text extraction from sampled payloads
+package payload
+
+import (
+	"mqtt-catalog/pkg/models"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     []byte
+		payloadType models.PayloadType
+		expected    string
+	}{
+		{
+			name:        "JSON keys and values",
+			payload:     []byte(`{"serial": "SN-1234", "reading": {"temp": 22.5, "ok": true}}`),
+			payloadType: models.PayloadJSON,
+			expected:    "reading ok true temp 22.5 serial SN-1234",
+		},
+		{
+			name:        "JSON array",
+			payload:     []byte(`[{"id": 1}, {"id": 2}]`),
+			payloadType: models.PayloadJSON,
+			expected:    "id 1 id 2",
+		},
+		{
+			name:        "XML elements attributes and text",
+			payload:     []byte(`<device serial="SN-9"><temp unit="C">21</temp></device>`),
+			payloadType: models.PayloadXML,
+			expected:    "device serial SN-9 temp unit C 21",
+		},
+		{
+			name:        "plain text",
+			payload:     []byte(`pump started`),
+			payloadType: models.PayloadText,
+			expected:    "pump started",
+		},
+		{
+			name:        "binary is not indexed",
+			payload:     []byte{0xFF, 0xD8},
+			payloadType: models.PayloadBinary,
+			expected:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := ExtractText(tt.payload, tt.payloadType); result != tt.expected {
+				t.Errorf("ExtractText() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package payload
+
+import (
+	"mqtt-catalog/pkg/models"
+	"unicode/utf8"
+)
+
+// Cuts a payload to at most limit bytes. Payloads other than binary are cut
+// before a multi-byte character rather than through it, so truncated text
+// stays valid UTF-8 for display and indexing
+func Truncate(data []byte, payloadType models.PayloadType, limit int) []byte {
+	if len(data) <= limit {
+		return data
+	}
+	if payloadType == models.PayloadBinary {
+		return data[:limit]
+	}
+
+	cut := limit
+	for cut > 0 && limit-cut < utf8.UTFMax-1 && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	if !utf8.RuneStart(data[cut]) {
+		// Not UTF-8 after all, nothing to keep intact
+		cut = limit
+	}
+	return data[:cut]
+}
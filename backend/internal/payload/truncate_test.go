@@ -0,0 +1,32 @@
+package payload
+
+import (
+	"mqtt-catalog/pkg/models"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		payloadType models.PayloadType
+		limit       int
+		want        string
+	}{
+		{"short enough", "abc", models.PayloadText, 3, "abc"},
+		{"ascii", "abcdef", models.PayloadText, 4, "abcd"},
+		{"before two-byte character", "abcä", models.PayloadText, 4, "abc"},
+		{"before four-byte character", "a😀b", models.PayloadJSON, 3, "a"},
+		{"after full character", "aäb", models.PayloadXML, 3, "aä"},
+		{"binary cut anywhere", "abcä", models.PayloadBinary, 4, "abc\xc3"},
+		{"invalid utf-8", "a\x80\x80\x80\x80\x80", models.PayloadText, 5, "a\x80\x80\x80\x80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Truncate([]byte(tt.data), tt.payloadType, tt.limit)); got != tt.want {
+				t.Errorf("Truncate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
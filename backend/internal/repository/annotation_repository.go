@@ -0,0 +1,375 @@
+// Stores human metadata for topics and topic filters
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrAnnotationExists = errors.New("annotation already exists")
+
+const annotationColumns = "id, broker_id, topic_filter, owner, description, classification, links, created_at, updated_at"
+
+type AnnotationRepository struct {
+	db *sql.DB
+}
+
+func NewAnnotationRepository(db *sql.DB) *AnnotationRepository {
+	return &AnnotationRepository{db: db}
+}
+
+// Filters for annotation listings. Zero values leave a filter unset
+type AnnotationFilter struct {
+	BrokerID string
+	Tags     []string
+	Owners   []string
+	Limit    int
+	Offset   int
+}
+
+// Stores a new annotation and fills in its ID and timestamps. Returns
+// ErrAnnotationExists when the broker already has one for the filter
+func (r *AnnotationRepository) Create(a *models.Annotation) error {
+	defer metrics.TimeQuery("create_annotation")()
+
+	pattern, err := TopicFilterRegex(a.TopicFilter)
+	if err != nil {
+		return err
+	}
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("create annotation: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	query := rebind(`
+		INSERT INTO annotations (broker_id, topic_filter, topic_regex, owner, description, classification, links, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, sqlite)
+	err = tx.QueryRow(query,
+		a.BrokerID, a.TopicFilter, pattern, a.Owner, a.Description,
+		a.Classification, strings.Join(a.Links, "\n"), now, now,
+	).Scan(&a.ID)
+	if isUniqueViolation(err) {
+		return ErrAnnotationExists
+	}
+	if err != nil {
+		return fmt.Errorf("create annotation: %w", err)
+	}
+
+	a.Tags = normalizeTags(a.Tags)
+	if err := insertTags(tx, a.ID, a.Tags, sqlite); err != nil {
+		return fmt.Errorf("create annotation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("create annotation: %w", err)
+	}
+
+	a.CreatedAt, a.UpdatedAt = now, now
+	return nil
+}
+
+// Replaces the fields of an existing annotation, returning false when the ID
+// is unknown. The broker and filter may change as long as they stay unique
+func (r *AnnotationRepository) Update(a *models.Annotation) (bool, error) {
+	defer metrics.TimeQuery("update_annotation")()
+
+	pattern, err := TopicFilterRegex(a.TopicFilter)
+	if err != nil {
+		return false, err
+	}
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(rebind("SELECT created_at FROM annotations WHERE id = ?", sqlite), a.ID).Scan(&a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+
+	now := time.Now().UTC()
+	query := rebind(`
+		UPDATE annotations
+		SET broker_id = ?, topic_filter = ?, topic_regex = ?, owner = ?, description = ?,
+			classification = ?, links = ?, updated_at = ?
+		WHERE id = ?
+	`, sqlite)
+	_, err = tx.Exec(query,
+		a.BrokerID, a.TopicFilter, pattern, a.Owner, a.Description,
+		a.Classification, strings.Join(a.Links, "\n"), now, a.ID,
+	)
+	if isUniqueViolation(err) {
+		return false, ErrAnnotationExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+
+	if _, err := tx.Exec(rebind("DELETE FROM annotation_tags WHERE annotation_id = ?", sqlite), a.ID); err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+	a.Tags = normalizeTags(a.Tags)
+	if err := insertTags(tx, a.ID, a.Tags, sqlite); err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("update annotation: %w", err)
+	}
+
+	a.UpdatedAt = now
+	return true, nil
+}
+
+// Removes an annotation and its tags, returning false when the ID is unknown
+func (r *AnnotationRepository) Delete(id int64) (bool, error) {
+	defer metrics.TimeQuery("delete_annotation")()
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("delete annotation: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced on SQLite, so tags are removed explicitly
+	if _, err := tx.Exec(rebind("DELETE FROM annotation_tags WHERE annotation_id = ?", sqlite), id); err != nil {
+		return false, fmt.Errorf("delete annotation: %w", err)
+	}
+	result, err := tx.Exec(rebind("DELETE FROM annotations WHERE id = ?", sqlite), id)
+	if err != nil {
+		return false, fmt.Errorf("delete annotation: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete annotation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("delete annotation: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// Finds an annotation by ID, nil when unknown
+func (r *AnnotationRepository) Get(id int64) (*models.Annotation, error) {
+	defer metrics.TimeQuery("get_annotation")()
+
+	annotations, _, err := r.list(whereClause{conds: []string{"id = ?"}, args: []any{id}}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(annotations) == 0 {
+		return nil, nil
+	}
+	return &annotations[0], nil
+}
+
+// Retrieves a page of annotations ordered by broker and filter, with the
+// total number of matches
+func (r *AnnotationRepository) List(filter AnnotationFilter) ([]models.Annotation, int, error) {
+	defer metrics.TimeQuery("list_annotations")()
+
+	var where whereClause
+	if filter.BrokerID != "" {
+		where.add("broker_id = ?", filter.BrokerID)
+	}
+	where.addIn("owner", filter.Owners)
+	if len(filter.Tags) > 0 {
+		where.add("id IN (SELECT annotation_id FROM annotation_tags WHERE tag IN ("+
+			placeholders(len(filter.Tags))+"))", stringArgs(filter.Tags)...)
+	}
+
+	return r.list(where, filter.Limit, filter.Offset)
+}
+
+func (r *AnnotationRepository) list(where whereClause, limit, offset int) ([]models.Annotation, int, error) {
+	sqlite := isSQLite(r.db)
+
+	var total int
+	count := rebind("SELECT COUNT(*) FROM annotations"+where.String(), sqlite)
+	if err := r.db.QueryRow(count, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count annotations: %w", err)
+	}
+
+	query := rebind("SELECT "+annotationColumns+" FROM annotations"+where.String()+
+		" ORDER BY broker_id, topic_filter, id LIMIT ? OFFSET ?", sqlite)
+	rows, err := r.db.Query(query, append(where.args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query annotations: %w", err)
+	}
+	annotations, err := scanAnnotations(rows)
+	rows.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.loadTags(annotations, sqlite); err != nil {
+		return nil, 0, err
+	}
+	return annotations, total, nil
+}
+
+// Attaches every annotation whose broker and filter match to each topic.
+// Annotations are few compared to topics, so they are matched in memory
+func (r *AnnotationRepository) Annotate(topics []models.Topic) error {
+	if len(topics) == 0 {
+		return nil
+	}
+
+	all, err := r.all()
+	if err != nil {
+		return err
+	}
+
+	for i := range topics {
+		for _, m := range all {
+			if (m.BrokerID == "" || m.BrokerID == topics[i].BrokerID) && m.regex.MatchString(topics[i].Topic) {
+				topics[i].Annotations = append(topics[i].Annotations, m.Annotation)
+			}
+		}
+	}
+	return nil
+}
+
+type compiledAnnotation struct {
+	models.Annotation
+	regex *regexp.Regexp
+}
+
+// Loads every annotation with its compiled topic filter
+func (r *AnnotationRepository) all() ([]compiledAnnotation, error) {
+	defer metrics.TimeQuery("all_annotations")()
+
+	sqlite := isSQLite(r.db)
+	rows, err := r.db.Query("SELECT " + annotationColumns + " FROM annotations ORDER BY broker_id, topic_filter, id")
+	if err != nil {
+		return nil, fmt.Errorf("query annotations: %w", err)
+	}
+	annotations, err := scanAnnotations(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadTags(annotations, sqlite); err != nil {
+		return nil, err
+	}
+
+	compiled := make([]compiledAnnotation, 0, len(annotations))
+	for _, a := range annotations {
+		pattern, err := TopicFilterRegex(a.TopicFilter)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %d: %w", a.ID, err)
+		}
+		compiled = append(compiled, compiledAnnotation{Annotation: a, regex: regexp.MustCompile(pattern)})
+	}
+	return compiled, nil
+}
+
+// Fills in the tags of the given annotations with one query
+func (r *AnnotationRepository) loadTags(annotations []models.Annotation, sqlite bool) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(annotations))
+	ids := make([]any, len(annotations))
+	for i, a := range annotations {
+		index[a.ID] = i
+		ids[i] = a.ID
+	}
+
+	query := rebind("SELECT annotation_id, tag FROM annotation_tags WHERE annotation_id IN ("+
+		placeholders(len(ids))+") ORDER BY tag", sqlite)
+	rows, err := r.db.Query(query, ids...)
+	if err != nil {
+		return fmt.Errorf("query annotation tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return fmt.Errorf("scan annotation tag: %w", err)
+		}
+		a := &annotations[index[id]]
+		a.Tags = append(a.Tags, tag)
+	}
+	return rows.Err()
+}
+
+func insertTags(tx *sql.Tx, id int64, tags []string, sqlite bool) error {
+	query := rebind("INSERT INTO annotation_tags (annotation_id, tag) VALUES (?, ?)", sqlite)
+	for _, tag := range tags {
+		if _, err := tx.Exec(query, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trims, sorts and de-duplicates tags; the result is never nil
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// Scans rows selected with annotationColumns; tags are loaded separately
+func scanAnnotations(rows *sql.Rows) ([]models.Annotation, error) {
+	annotations := []models.Annotation{}
+	for rows.Next() {
+		var a models.Annotation
+		var links string
+		err := rows.Scan(
+			&a.ID,
+			&a.BrokerID,
+			&a.TopicFilter,
+			&a.Owner,
+			&a.Description,
+			&a.Classification,
+			&links,
+			&a.CreatedAt,
+			&a.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan annotation: %w", err)
+		}
+		a.Tags = []string{}
+		a.Links = []string{}
+		if links != "" {
+			a.Links = strings.Split(links, "\n")
+		}
+		annotations = append(annotations, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate annotations: %w", err)
+	}
+	return annotations, nil
+}
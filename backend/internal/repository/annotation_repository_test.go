@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"errors"
+	"mqtt-catalog/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAnnotationRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewAnnotationRepository(db)
+
+	a := models.Annotation{
+		BrokerID:       "broker1",
+		TopicFilter:    "plant1/+/temperature",
+		Owner:          "process-team",
+		Description:    "Line temperatures in °C",
+		Tags:           []string{"sensor", " process ", "sensor"},
+		Classification: models.ClassificationInternal,
+		Links:          []string{"https://wiki.example.com/plant1"},
+	}
+	if err := repo.Create(&a); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if a.ID == 0 || !slices.Equal(a.Tags, []string{"process", "sensor"}) {
+		t.Errorf("unexpected created annotation %+v", a)
+	}
+
+	duplicate := models.Annotation{BrokerID: "broker1", TopicFilter: "plant1/+/temperature"}
+	if err := repo.Create(&duplicate); !errors.Is(err, ErrAnnotationExists) {
+		t.Errorf("Create() duplicate error = %v, want ErrAnnotationExists", err)
+	}
+	// The same filter may be annotated for all brokers separately
+	global := models.Annotation{TopicFilter: "plant1/+/temperature", Tags: []string{"global"}}
+	if err := repo.Create(&global); err != nil {
+		t.Fatalf("Create() global error = %v", err)
+	}
+
+	got, err := repo.Get(a.ID)
+	if err != nil || got == nil {
+		t.Fatalf("Get() = %v, %v", got, err)
+	}
+	if got.Owner != a.Owner || !slices.Equal(got.Tags, a.Tags) || !slices.Equal(got.Links, a.Links) {
+		t.Errorf("Get() = %+v, want %+v", got, a)
+	}
+
+	a.Owner = "quality-team"
+	a.Tags = []string{"quality"}
+	a.Links = nil
+	found, err := repo.Update(&a)
+	if err != nil || !found {
+		t.Fatalf("Update() = %v, %v", found, err)
+	}
+	got, _ = repo.Get(a.ID)
+	if got.Owner != "quality-team" || !slices.Equal(got.Tags, []string{"quality"}) || len(got.Links) != 0 {
+		t.Errorf("after Update() got %+v", got)
+	}
+
+	global.BrokerID = "broker1"
+	if _, err := repo.Update(&global); !errors.Is(err, ErrAnnotationExists) {
+		t.Errorf("Update() onto an existing filter error = %v, want ErrAnnotationExists", err)
+	}
+	if found, err := repo.Update(&models.Annotation{ID: 999, TopicFilter: "x"}); found || err != nil {
+		t.Errorf("Update() unknown = %v, %v", found, err)
+	}
+
+	byTag, total, err := repo.List(AnnotationFilter{Tags: []string{"quality", "other"}, Limit: 10})
+	if err != nil || total != 1 || byTag[0].ID != a.ID {
+		t.Errorf("List(tag) = %+v, %d, %v", byTag, total, err)
+	}
+	byOwner, total, _ := repo.List(AnnotationFilter{Owners: []string{"nobody"}, Limit: 10})
+	if total != 0 || len(byOwner) != 0 {
+		t.Errorf("List(owner) = %+v, %d", byOwner, total)
+	}
+
+	if deleted, err := repo.Delete(a.ID); err != nil || !deleted {
+		t.Errorf("Delete() = %v, %v", deleted, err)
+	}
+	if deleted, _ := repo.Delete(a.ID); deleted {
+		t.Error("Delete() of a deleted annotation reported success")
+	}
+	if got, _ := repo.Get(a.ID); got != nil {
+		t.Errorf("Get() after Delete() = %+v", got)
+	}
+}
+
+func TestAnnotationRepository_Topics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	topics := NewTopicRepository(db)
+	annotations := NewAnnotationRepository(db)
+
+	for _, s := range []models.Sample{
+		{BrokerID: "broker1", Topic: "plant1/line1/temperature", PayloadType: models.PayloadText, Payload: []byte("21"), Timestamp: time.Now()},
+		{BrokerID: "broker1", Topic: "plant1/line1/status", PayloadType: models.PayloadText, Payload: []byte("ok"), Timestamp: time.Now()},
+		{BrokerID: "broker2", Topic: "plant1/line1/temperature", PayloadType: models.PayloadText, Payload: []byte("19"), Timestamp: time.Now()},
+	} {
+		if err := topics.Upsert(s); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	for _, a := range []models.Annotation{
+		{BrokerID: "broker1", TopicFilter: "plant1/+/temperature", Owner: "process-team", Tags: []string{"sensor"}},
+		{TopicFilter: "plant1/#", Owner: "plant-ops", Tags: []string{"plant"}},
+		{BrokerID: "broker1", TopicFilter: "plant1/line1/status", Owner: "line-team"},
+	} {
+		if err := annotations.Create(&a); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"by tag", ListOptions{Tags: []string{"sensor"}}, []string{"broker1 plant1/line1/temperature"}},
+		{"by tag for all brokers", ListOptions{Tags: []string{"plant"}}, []string{
+			"broker1 plant1/line1/status", "broker1 plant1/line1/temperature", "broker2 plant1/line1/temperature",
+		}},
+		{"by owner", ListOptions{Owners: []string{"line-team", "process-team"}}, []string{
+			"broker1 plant1/line1/status", "broker1 plant1/line1/temperature",
+		}},
+		{"by tag and owner", ListOptions{Tags: []string{"plant"}, Owners: []string{"line-team"}}, []string{"broker1 plant1/line1/status"}},
+		{"unknown tag", ListOptions{Tags: []string{"none"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Sort, tt.opts.Limit = SortBroker, 10
+			page, err := topics.List(tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var got []string
+			for _, topic := range page.Topics {
+				got = append(got, topic.BrokerID+" "+topic.Topic)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) || page.Total != len(tt.want) {
+				t.Errorf("List() = %v (total %d), want %v", got, page.Total, tt.want)
+			}
+		})
+	}
+
+	// Annotations live in their own table, so new samples leave them alone
+	if err := topics.Upsert(models.Sample{
+		BrokerID: "broker1", Topic: "plant1/line1/temperature", PayloadType: models.PayloadJSON,
+		Payload: []byte(`{"t": 22}`), Timestamp: time.Now(),
+	}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	topic, _ := topics.GetByBrokerAndTopic("broker1", "plant1/line1/temperature")
+	list := []models.Topic{*topic}
+	if err := annotations.Annotate(list); err != nil {
+		t.Fatalf("Annotate() error = %v", err)
+	}
+
+	var owners []string
+	for _, a := range list[0].Annotations {
+		owners = append(owners, a.Owner)
+	}
+	if !slices.Equal(owners, []string{"plant-ops", "process-team"}) {
+		t.Errorf("Annotate() owners = %v", owners)
+	}
+}
@@ -0,0 +1,72 @@
+// Stores hashed API keys for database-backed authentication
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"strings"
+	"time"
+)
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Stores a key under its hash; the plain key is never persisted
+func (r *APIKeyRepository) Create(hash, name string, scopes []string) error {
+	defer metrics.TimeQuery("create_api_key")()
+
+	query := rebind(
+		"INSERT INTO api_keys (key_hash, name, scopes, created_at) VALUES (?, ?, ?, ?)",
+		isSQLite(r.db),
+	)
+	_, err := r.db.Exec(query, hash, name, strings.Join(scopes, " "), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	return nil
+}
+
+// Finds an active key by hash, nil when unknown or revoked
+func (r *APIKeyRepository) GetByHash(hash string) (*models.APIKey, error) {
+	defer metrics.TimeQuery("get_api_key")()
+
+	query := rebind(
+		"SELECT name, scopes, created_at FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL",
+		isSQLite(r.db),
+	)
+
+	var key models.APIKey
+	var scopes string
+	err := r.db.QueryRow(query, hash).Scan(&key.Name, &scopes, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query api key: %w", err)
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
+
+// Revokes every active key with the given name and returns how many were revoked
+func (r *APIKeyRepository) Revoke(name string) (int64, error) {
+	defer metrics.TimeQuery("revoke_api_key")()
+
+	query := rebind(
+		"UPDATE api_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL",
+		isSQLite(r.db),
+	)
+	result, err := r.db.Exec(query, time.Now().UTC(), name)
+	if err != nil {
+		return 0, fmt.Errorf("revoke api key: %w", err)
+	}
+	return result.RowsAffected()
+}
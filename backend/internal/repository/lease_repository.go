@@ -0,0 +1,254 @@
+// Coordinates collector instances: membership leases of sharded instances,
+// exclusive leases on the brokers they collect and claims on the topics
+// sampled by instances sharing one broker
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"time"
+)
+
+type LeaseRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func NewLeaseRepository(db *sql.DB) *LeaseRepository {
+	return &LeaseRepository{db: db, now: time.Now}
+}
+
+// Renews the instance's membership and its leases on the wanted brokers for
+// ttl. A broker is granted only when no other live instance holds it; leases
+// the instance holds on brokers it no longer wants are released, and expired
+// leases of every instance are dropped
+func (r *LeaseRepository) Renew(instanceID string, brokers []string, ttl time.Duration) (models.LeaseResponse, error) {
+	defer metrics.TimeQuery("renew_lease")()
+
+	sqlite := isSQLite(r.db)
+	now := r.now().UTC()
+	expires := now.Add(ttl)
+	resp := models.LeaseResponse{InstanceID: instanceID, ExpiresAt: expires}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return resp, fmt.Errorf("renew lease: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{"DELETE FROM collector_leases WHERE expires_at < ?", "DELETE FROM broker_leases WHERE expires_at < ?"} {
+		if _, err := tx.Exec(rebind(query, sqlite), now); err != nil {
+			return resp, fmt.Errorf("expire leases: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(rebind(`
+		INSERT INTO collector_leases (instance_id, renewed_at, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (instance_id) DO UPDATE SET renewed_at = excluded.renewed_at, expires_at = excluded.expires_at
+	`, sqlite), instanceID, now, expires)
+	if err != nil {
+		return resp, fmt.Errorf("renew collector lease: %w", err)
+	}
+
+	release := "DELETE FROM broker_leases WHERE instance_id = ?"
+	args := []any{instanceID}
+	if len(brokers) > 0 {
+		release += " AND broker_id NOT IN (" + placeholders(len(brokers)) + ")"
+		args = append(args, stringArgs(brokers)...)
+	}
+	if _, err := tx.Exec(rebind(release, sqlite), args...); err != nil {
+		return resp, fmt.Errorf("release broker leases: %w", err)
+	}
+
+	// Expired leases are gone, so a conflict means the broker is held by a
+	// live instance, which only keeps it when that is the requester
+	acquire := rebind(`
+		INSERT INTO broker_leases (broker_id, instance_id, acquired_at, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (broker_id) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE broker_leases.instance_id = excluded.instance_id
+	`, sqlite)
+	for _, broker := range brokers {
+		if _, err := tx.Exec(acquire, broker, instanceID, now, expires); err != nil {
+			return resp, fmt.Errorf("acquire broker lease: %w", err)
+		}
+	}
+
+	if resp.Brokers, err = queryStrings(tx,
+		rebind("SELECT broker_id FROM broker_leases WHERE instance_id = ? ORDER BY broker_id", sqlite), instanceID); err != nil {
+		return resp, err
+	}
+	if resp.Members, err = queryStrings(tx, "SELECT instance_id FROM collector_leases ORDER BY instance_id"); err != nil {
+		return resp, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return resp, fmt.Errorf("renew lease: %w", err)
+	}
+	return resp, nil
+}
+
+// Drops the instance's membership and broker leases so other instances can
+// take its brokers over right away, returning false when it held none
+func (r *LeaseRepository) Release(instanceID string) (bool, error) {
+	defer metrics.TimeQuery("release_lease")()
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("release lease: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(rebind("DELETE FROM broker_leases WHERE instance_id = ?", sqlite), instanceID); err != nil {
+		return false, fmt.Errorf("release broker leases: %w", err)
+	}
+	result, err := tx.Exec(rebind("DELETE FROM collector_leases WHERE instance_id = ?", sqlite), instanceID)
+	if err != nil {
+		return false, fmt.Errorf("release collector lease: %w", err)
+	}
+	released, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("release collector lease: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("release lease: %w", err)
+	}
+	return released > 0, nil
+}
+
+// Lists the live collector instances with the brokers they hold, ordered by
+// instance ID
+func (r *LeaseRepository) List() ([]models.CollectorInstance, error) {
+	defer metrics.TimeQuery("list_leases")()
+
+	sqlite := isSQLite(r.db)
+	now := r.now().UTC()
+
+	rows, err := r.db.Query(rebind(
+		"SELECT instance_id, renewed_at, expires_at FROM collector_leases WHERE expires_at >= ? ORDER BY instance_id", sqlite), now)
+	if err != nil {
+		return nil, fmt.Errorf("query collector leases: %w", err)
+	}
+	defer rows.Close()
+
+	collectors := []models.CollectorInstance{}
+	index := make(map[string]int)
+	for rows.Next() {
+		c := models.CollectorInstance{Brokers: []string{}}
+		if err := rows.Scan(&c.InstanceID, &c.RenewedAt, &c.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan collector lease: %w", err)
+		}
+		index[c.InstanceID] = len(collectors)
+		collectors = append(collectors, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate collector leases: %w", err)
+	}
+
+	brokerRows, err := r.db.Query(rebind(
+		"SELECT broker_id, instance_id FROM broker_leases WHERE expires_at >= ? ORDER BY broker_id", sqlite), now)
+	if err != nil {
+		return nil, fmt.Errorf("query broker leases: %w", err)
+	}
+	defer brokerRows.Close()
+
+	for brokerRows.Next() {
+		var broker, instance string
+		if err := brokerRows.Scan(&broker, &instance); err != nil {
+			return nil, fmt.Errorf("scan broker lease: %w", err)
+		}
+		if i, ok := index[instance]; ok {
+			collectors[i].Brokers = append(collectors[i].Brokers, broker)
+		}
+	}
+	if err := brokerRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate broker leases: %w", err)
+	}
+	return collectors, nil
+}
+
+// Claims sampling the topic for the instance until ttl has passed. The claim
+// is granted when nobody holds one or the previous claim expired; a claim
+// the instance already holds is reported as granted without being extended.
+// Expired rows are taken over in place, ExpireClaims removes the rest
+func (r *LeaseRepository) Claim(brokerID, topic, instanceID string, ttl time.Duration) (models.ClaimResponse, error) {
+	defer metrics.TimeQuery("claim_sample")()
+
+	sqlite := isSQLite(r.db)
+	now := r.now().UTC()
+	var resp models.ClaimResponse
+
+	// The conflict update only applies to an expired claim, so no row comes
+	// back when a live claim exists
+	err := r.db.QueryRow(rebind(`
+		INSERT INTO sample_claims (broker_id, topic, instance_id, claimed_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (broker_id, topic) DO UPDATE SET
+			instance_id = excluded.instance_id,
+			claimed_at = excluded.claimed_at,
+			expires_at = excluded.expires_at
+		WHERE sample_claims.expires_at < excluded.claimed_at
+		RETURNING instance_id, expires_at
+	`, sqlite), brokerID, topic, instanceID, now, now.Add(ttl)).Scan(&resp.ClaimedBy, &resp.ExpiresAt)
+	if err == sql.ErrNoRows {
+		err = r.db.QueryRow(rebind("SELECT instance_id, expires_at FROM sample_claims WHERE broker_id = ? AND topic = ?", sqlite),
+			brokerID, topic).Scan(&resp.ClaimedBy, &resp.ExpiresAt)
+	}
+	if err != nil {
+		return resp, fmt.Errorf("claim sample: %w", err)
+	}
+
+	resp.Claimed = resp.ClaimedBy == instanceID
+	return resp, nil
+}
+
+// Drops the instance's claim on the topic so another instance can sample it,
+// returning false when the instance held none
+func (r *LeaseRepository) ReleaseClaim(brokerID, topic, instanceID string) (bool, error) {
+	defer metrics.TimeQuery("release_sample_claim")()
+
+	result, err := r.db.Exec(rebind("DELETE FROM sample_claims WHERE broker_id = ? AND topic = ? AND instance_id = ?", isSQLite(r.db)),
+		brokerID, topic, instanceID)
+	if err != nil {
+		return false, fmt.Errorf("release sample claim: %w", err)
+	}
+	released, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("release sample claim: %w", err)
+	}
+	return released > 0, nil
+}
+
+// Deletes claims that expired before now and returns how many were removed
+func (r *LeaseRepository) ExpireClaims() (int64, error) {
+	defer metrics.TimeQuery("expire_sample_claims")()
+
+	result, err := r.db.Exec(rebind("DELETE FROM sample_claims WHERE expires_at < ?", isSQLite(r.db)), r.now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("expire sample claims: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func queryStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query leases: %w", err)
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan lease: %w", err)
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
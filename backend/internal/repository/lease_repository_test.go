@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLeaseRepository_Renew(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	repo := NewLeaseRepository(db)
+	repo.now = func() time.Time { return now }
+	ttl := 30 * time.Second
+
+	a, err := repo.Renew("collector-a", []string{"b1", "b2", "b3"}, ttl)
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if !slices.Equal(a.Brokers, []string{"b1", "b2", "b3"}) || !slices.Equal(a.Members, []string{"collector-a"}) {
+		t.Errorf("first Renew() = %+v", a)
+	}
+
+	// b2 is still held by collector-a
+	b, err := repo.Renew("collector-b", []string{"b2", "b4"}, ttl)
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if !slices.Equal(b.Brokers, []string{"b4"}) || !slices.Equal(b.Members, []string{"collector-a", "collector-b"}) {
+		t.Errorf("contended Renew() = %+v", b)
+	}
+
+	// Once collector-a stops wanting b2 it is released and can be taken over
+	now = now.Add(10 * time.Second)
+	if a, _ = repo.Renew("collector-a", []string{"b1", "b3"}, ttl); !slices.Equal(a.Brokers, []string{"b1", "b3"}) {
+		t.Errorf("Renew() after rebalance = %+v", a)
+	}
+	if b, _ = repo.Renew("collector-b", []string{"b2", "b4"}, ttl); !slices.Equal(b.Brokers, []string{"b2", "b4"}) {
+		t.Errorf("Renew() after release = %+v", b)
+	}
+
+	// collector-a stops renewing, so its membership and leases expire
+	now = now.Add(time.Minute)
+	b, err = repo.Renew("collector-b", []string{"b1", "b2", "b3", "b4"}, ttl)
+	if err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if !slices.Equal(b.Brokers, []string{"b1", "b2", "b3", "b4"}) || !slices.Equal(b.Members, []string{"collector-b"}) {
+		t.Errorf("Renew() after expiry = %+v", b)
+	}
+	if !b.ExpiresAt.Equal(now.UTC().Add(ttl)) {
+		t.Errorf("ExpiresAt = %v, want %v", b.ExpiresAt, now.UTC().Add(ttl))
+	}
+
+	collectors, err := repo.List()
+	if err != nil || len(collectors) != 1 || collectors[0].InstanceID != "collector-b" || len(collectors[0].Brokers) != 4 {
+		t.Errorf("List() = %+v, %v", collectors, err)
+	}
+}
+
+func TestLeaseRepository_Release(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewLeaseRepository(db)
+	if _, err := repo.Renew("collector-a", []string{"b1"}, time.Minute); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+
+	released, err := repo.Release("collector-a")
+	if err != nil || !released {
+		t.Fatalf("Release() = %v, %v", released, err)
+	}
+	if released, _ := repo.Release("collector-a"); released {
+		t.Error("Release() twice reported a release")
+	}
+
+	b, err := repo.Renew("collector-b", []string{"b1"}, time.Minute)
+	if err != nil || !slices.Equal(b.Brokers, []string{"b1"}) {
+		t.Errorf("Renew() after release = %+v, %v", b, err)
+	}
+	if collectors, _ := repo.List(); len(collectors) != 1 {
+		t.Errorf("List() = %+v", collectors)
+	}
+}
+
+func TestLeaseRepository_Claim(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	repo := NewLeaseRepository(db)
+	repo.now = func() time.Time { return now }
+	ttl := time.Minute
+
+	tests := []struct {
+		name        string
+		after       time.Duration
+		brokerID    string
+		instanceID  string
+		wantClaimed bool
+		wantHolder  string
+	}{
+		{"first claim", 0, "broker1", "collector-a", true, "collector-a"},
+		{"held by another instance", 10 * time.Second, "broker1", "collector-b", false, "collector-a"},
+		{"claimed again by the holder", 0, "broker1", "collector-a", true, "collector-a"},
+		{"same topic on another broker", 0, "broker2", "collector-b", true, "collector-b"},
+		{"taken over after expiry", time.Minute, "broker1", "collector-b", true, "collector-b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.after)
+			got, err := repo.Claim(tt.brokerID, "plant1/temp", tt.instanceID, ttl)
+			if err != nil {
+				t.Fatalf("Claim() error = %v", err)
+			}
+			if got.Claimed != tt.wantClaimed || got.ClaimedBy != tt.wantHolder {
+				t.Errorf("Claim() = %+v, want claimed=%v by %s", got, tt.wantClaimed, tt.wantHolder)
+			}
+		})
+	}
+
+	// Only the holder releases a claim, after which others can take it
+	if released, err := repo.ReleaseClaim("broker1", "plant1/temp", "collector-a"); err != nil || released {
+		t.Errorf("ReleaseClaim() by another instance = %v, %v, want false", released, err)
+	}
+	if released, err := repo.ReleaseClaim("broker1", "plant1/temp", "collector-b"); err != nil || !released {
+		t.Errorf("ReleaseClaim() by the holder = %v, %v, want true", released, err)
+	}
+	if got, err := repo.Claim("broker1", "plant1/temp", "collector-a", ttl); err != nil || !got.Claimed {
+		t.Errorf("Claim() after release = %+v, %v, want claimed", got, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := repo.Claim("broker2", "plant1/hum", "collector-b", time.Hour); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	removed, err := repo.ExpireClaims()
+	if err != nil {
+		t.Fatalf("ExpireClaims() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("ExpireClaims() removed %d claims, want the 2 expired ones", removed)
+	}
+}
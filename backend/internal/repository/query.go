@@ -0,0 +1,193 @@
+// Shared helpers for building dialect-aware SQL queries
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mqtt-catalog/pkg/models"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const topicColumns = "id, broker_id, topic, payload_type, sample_payload, last_seen, created_at, truncated, flags, redacted"
+
+// Wraps an error of a query matching topics. Postgres regular expressions
+// reject some patterns Go accepts, such as (?P<name>...); those errors
+// (SQLSTATE 2201B) are reported as ErrInvalidFilter
+func matchError(op string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "2201B" {
+		return fmt.Errorf("%w: %s", ErrInvalidFilter, pqErr.Message)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// Reports whether err is a unique constraint violation on either database
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Reports whether the connected database is SQLite, anything else is treated as Postgres
+func (r *TopicRepository) isSQLite() bool {
+	return isSQLite(r.db)
+}
+
+func isSQLite(db *sql.DB) bool {
+	var version string
+	return db.QueryRow("SELECT sqlite_version()").Scan(&version) == nil
+}
+
+// Rewrites ? placeholders into $1, $2, ... when the target is Postgres
+func rebind(query string, sqlite bool) string {
+	if sqlite {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Accumulates AND-ed conditions with their bind parameters
+type whereClause struct {
+	conds []string
+	args  []any
+}
+
+func (w *whereClause) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// Adds "column IN (...)" for a non-empty value list
+func (w *whereClause) addIn(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+
+	w.add(column+" IN ("+placeholders(len(values))+")", stringArgs(values)...)
+}
+
+// Converts values into bind parameters
+func stringArgs(values []string) []any {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// Returns n comma-separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// Adds a topic match condition for the given search mode
+func (w *whereClause) addTopicMatch(query string, mode MatchMode, sqlite bool) error {
+	regexOp := "~"
+	if sqlite {
+		regexOp = "REGEXP"
+	}
+
+	switch mode {
+	case MatchFilter, "":
+		pattern, err := TopicFilterRegex(query)
+		if err != nil {
+			return err
+		}
+		if prefix := filterLiteralPrefix(query); prefix != "" {
+			w.add(`topic LIKE ? ESCAPE '\'`, escapeLike(prefix)+"%")
+		}
+		w.add("topic "+regexOp+" ?", pattern)
+	case MatchSubstring:
+		if query == "" {
+			return fmt.Errorf("%w: empty substring", ErrInvalidFilter)
+		}
+		w.add(`LOWER(topic) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(query))+"%")
+	case MatchRegex:
+		if _, err := regexp.Compile(query); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		w.add("topic "+regexOp+" ?", query)
+	default:
+		return fmt.Errorf("%w: unknown match mode %q", ErrInvalidFilter, mode)
+	}
+
+	return nil
+}
+
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// Scans a single row selected with topicColumns
+func scanTopic(row interface{ Scan(...any) error }) (models.Topic, error) {
+	var t models.Topic
+	var flags string
+	err := row.Scan(
+		&t.ID,
+		&t.BrokerID,
+		&t.Topic,
+		&t.PayloadType,
+		&t.SamplePayload,
+		&t.LastSeen,
+		&t.CreatedAt,
+		&t.Truncated,
+		&flags,
+		&t.Redacted,
+	)
+	t.Flags = splitNames(flags)
+	return t, err
+}
+
+// Stores a set of names such as payload scan flags as a sorted, deduplicated
+// space-separated list
+func joinNames(names []string) string {
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+	return strings.Join(slices.Compact(sorted), " ")
+}
+
+func splitNames(names string) []string {
+	return strings.Fields(names)
+}
+
+// Scans rows selected with topicColumns into topic models
+func scanTopics(rows *sql.Rows) ([]models.Topic, error) {
+	// Empty pages encode as [] rather than null
+	topics := []models.Topic{}
+	for rows.Next() {
+		t, err := scanTopic(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan topic: %w", err)
+		}
+		topics = append(topics, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate topics: %w", err)
+	}
+	return topics, nil
+}
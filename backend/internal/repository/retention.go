@@ -0,0 +1,135 @@
+// Stale topic reporting and retention purge
+package repository
+
+import (
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Per-broker last_seen cutoffs. A zero time disables the cutoff, for the
+// default or for a single broker
+type AgeCutoff struct {
+	Default time.Time
+	Brokers map[string]time.Time
+}
+
+func (c AgeCutoff) IsZero() bool {
+	if !c.Default.IsZero() {
+		return false
+	}
+	for _, t := range c.Brokers {
+		if !t.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the cutoff that applies to a broker
+func (c AgeCutoff) For(brokerID string) time.Time {
+	if t, ok := c.Brokers[brokerID]; ok {
+		return t
+	}
+	return c.Default
+}
+
+// Builds the condition matching topics last seen before their broker's cutoff
+func (c AgeCutoff) olderCondition() (string, []any) {
+	brokerIDs := make([]string, 0, len(c.Brokers))
+	for id := range c.Brokers {
+		brokerIDs = append(brokerIDs, id)
+	}
+	sort.Strings(brokerIDs)
+
+	var parts []string
+	var args []any
+
+	for _, id := range brokerIDs {
+		if cutoff := c.Brokers[id]; !cutoff.IsZero() {
+			parts = append(parts, "(broker_id = ? AND last_seen < ?)")
+			args = append(args, id, cutoff.UTC())
+		}
+	}
+
+	if !c.Default.IsZero() {
+		if len(brokerIDs) == 0 {
+			parts = append(parts, "last_seen < ?")
+		} else {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(brokerIDs)), ", ")
+			parts = append(parts, "(broker_id NOT IN ("+placeholders+") AND last_seen < ?)")
+			for _, id := range brokerIDs {
+				args = append(args, id)
+			}
+		}
+		args = append(args, c.Default.UTC())
+	}
+
+	if len(parts) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(parts, " OR ") + ")", args
+}
+
+// Lists topics that stopped publishing before their broker's stale cutoff,
+// oldest first
+func (r *TopicRepository) GetStale(cutoff AgeCutoff, limit, offset int) ([]models.Topic, int, error) {
+	if cutoff.IsZero() {
+		return nil, 0, nil
+	}
+
+	page, err := r.List(ListOptions{
+		StaleBefore: cutoff,
+		Sort:        SortLastSeen,
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Topics, page.Total, nil
+}
+
+// Deletes topics last seen before their broker's purge cutoff and returns the
+// number of removed rows
+func (r *TopicRepository) DeleteOlderThan(cutoff AgeCutoff) (int64, error) {
+	defer metrics.TimeQuery("delete_older_than")()
+
+	if cutoff.IsZero() {
+		return 0, nil
+	}
+
+	sqlite := r.isSQLite()
+	cond, args := cutoff.olderCondition()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("purge topics: %w", err)
+	}
+	defer tx.Rollback()
+
+	if sqlite {
+		_, err := tx.Exec("DELETE FROM topics_fts WHERE rowid IN (SELECT id FROM topics WHERE "+cond+")", args...)
+		if err != nil {
+			return 0, fmt.Errorf("purge search entries: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(rebind("DELETE FROM topics WHERE "+cond, sqlite), args...)
+	if err != nil {
+		return 0, fmt.Errorf("purge topics: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge topics: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("purge topics: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,186 @@
+// Full-text search over sampled payload contents
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"strings"
+)
+
+// The database wraps matches in private-use characters, which are replaced
+// by <mark> tags only after the snippet text was HTML-escaped, so payload
+// markup never reaches a client as HTML
+const (
+	matchStart     = "\uE000"
+	matchEnd       = "\uE001"
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+var highlighter = strings.NewReplacer(matchStart, highlightStart, matchEnd, highlightEnd)
+
+// Escapes a snippet returned by the database and marks its matches
+func highlightSnippet(snippet string) string {
+	return highlighter.Replace(html.EscapeString(snippet))
+}
+
+// Replaces the FTS row of a freshly upserted SQLite topic
+func indexSQLiteSample(tx *sql.Tx, id int64, brokerID, topic, text string) error {
+	if _, err := tx.Exec("DELETE FROM topics_fts WHERE rowid = ?", id); err != nil {
+		return fmt.Errorf("delete search entry: %w", err)
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO topics_fts (rowid, broker_id, topic, content) VALUES (?, ?, ?, ?)",
+		id, brokerID, topic, text,
+	)
+	if err != nil {
+		return fmt.Errorf("insert search entry: %w", err)
+	}
+
+	return nil
+}
+
+// Ranks topics whose name or sample payload contains all words of the query,
+// returning highlighted snippets of the matching content
+func (r *TopicRepository) FullTextSearch(query string, limit, offset int) ([]models.SearchResult, int, error) {
+	defer metrics.TimeQuery("full_text_search")()
+
+	if r.isSQLite() {
+		return r.fullTextSearchSQLite(query, limit, offset)
+	}
+	return r.fullTextSearchPostgres(query, limit, offset)
+}
+
+func (r *TopicRepository) fullTextSearchSQLite(query string, limit, offset int) ([]models.SearchResult, int, error) {
+	match := ftsMatchExpression(query)
+	if match == "" {
+		return nil, 0, nil
+	}
+
+	var total int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM topics_fts WHERE topics_fts MATCH ?", match,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count search results: %w", err)
+	}
+
+	// FTS5 ranks with bm25 (lower is better); FTS4 has no built-in ranking
+	// so results fall back to recency
+	rankExpr := "0"
+	snippetExpr := "snippet(topics_fts, ?, ?, '…', 2, 16)"
+	orderBy := "t.last_seen DESC"
+	if r.sqliteFTS5() {
+		rankExpr = "-bm25(topics_fts)"
+		snippetExpr = "snippet(topics_fts, 2, ?, ?, '…', 16)"
+		orderBy = "bm25(topics_fts)"
+	}
+
+	rows, err := r.db.Query(`
+		SELECT t.id, t.broker_id, t.topic, t.payload_type, t.sample_payload, t.last_seen, t.created_at, t.truncated, t.flags, t.redacted,
+			`+rankExpr+`, `+snippetExpr+`
+		FROM topics_fts
+		JOIN topics t ON t.id = topics_fts.rowid
+		WHERE topics_fts MATCH ?
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, matchStart, matchEnd, match, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search payloads: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+func (r *TopicRepository) fullTextSearchPostgres(query string, limit, offset int) ([]models.SearchResult, int, error) {
+	var total int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM topics WHERE search_vector @@ websearch_to_tsquery('simple', $1)", query,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count search results: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT t.id, t.broker_id, t.topic, t.payload_type, t.sample_payload, t.last_seen, t.created_at, t.truncated, t.flags, t.redacted,
+			ts_rank(t.search_vector, q),
+			ts_headline('simple', COALESCE(t.sample_text, ''), q,
+				'StartSel=`+matchStart+`, StopSel=`+matchEnd+`, MaxWords=16, MinWords=4')
+		FROM topics t, websearch_to_tsquery('simple', $1) q
+		WHERE t.search_vector @@ q
+		ORDER BY ts_rank(t.search_vector, q) DESC
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search payloads: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := scanSearchResults(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// Reports whether the SQLite search index was created with FTS5
+func (r *TopicRepository) sqliteFTS5() bool {
+	var ddl string
+	err := r.db.QueryRow(
+		"SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'topics_fts'",
+	).Scan(&ddl)
+	return err == nil && strings.Contains(strings.ToLower(ddl), "fts5")
+}
+
+// Quotes every word of a user query so characters such as '-' in serial
+// numbers are matched literally instead of parsed as FTS operators
+func ftsMatchExpression(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func scanSearchResults(rows *sql.Rows) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var res models.SearchResult
+		t := &res.Topic
+		var flags string
+		err := rows.Scan(
+			&t.ID,
+			&t.BrokerID,
+			&t.Topic,
+			&t.PayloadType,
+			&t.SamplePayload,
+			&t.LastSeen,
+			&t.CreatedAt,
+			&t.Truncated,
+			&flags,
+			&t.Redacted,
+			&res.Score,
+			&res.Snippet,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan search result: %w", err)
+		}
+		t.Flags = splitNames(flags)
+		res.Snippet = highlightSnippet(res.Snippet)
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate search results: %w", err)
+	}
+	return results, nil
+}
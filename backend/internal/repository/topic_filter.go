@@ -0,0 +1,86 @@
+// Translates MQTT topic filters and search modes into SQL conditions
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid topic filter")
+
+type MatchMode string
+
+const (
+	MatchFilter    MatchMode = "filter"
+	MatchSubstring MatchMode = "substring"
+	MatchRegex     MatchMode = "regex"
+)
+
+// Converts an MQTT topic filter (e.g. plant1/+/temperature/#) into an anchored
+// regular expression understood by both Go/SQLite REGEXP and Postgres ~
+func TopicFilterRegex(filter string) (string, error) {
+	if err := ValidateTopicFilter(filter); err != nil {
+		return "", err
+	}
+
+	levels := strings.Split(filter, "/")
+	parts := make([]string, 0, len(levels))
+
+	for i, level := range levels {
+		switch level {
+		case "#":
+			if i == 0 {
+				// A leading wildcard never matches $SYS-style topics
+				return `^[^$].*$`, nil
+			}
+			// "a/#" matches "a" as well as everything below it
+			return "^" + strings.Join(parts, "/") + "(?:/.*)?$", nil
+		case "+":
+			if i == 0 {
+				parts = append(parts, `(?:[^$/][^/]*)?`)
+			} else {
+				parts = append(parts, `[^/]*`)
+			}
+		default:
+			parts = append(parts, regexp.QuoteMeta(level))
+		}
+	}
+
+	return "^" + strings.Join(parts, "/") + "$", nil
+}
+
+// Checks wildcard placement rules from the MQTT specification
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("%w: empty filter", ErrInvalidFilter)
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("%w: '#' must be the last level on its own", ErrInvalidFilter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("%w: '+' must occupy an entire level", ErrInvalidFilter)
+		}
+	}
+
+	return nil
+}
+
+// Returns the literal part of a filter before its first wildcard, used to
+// narrow matches with an indexable LIKE before the regex is evaluated
+func filterLiteralPrefix(filter string) string {
+	if i := strings.IndexAny(filter, "+#"); i >= 0 {
+		return filter[:i]
+	}
+	return filter
+}
+
+// Escapes LIKE metacharacters so user input is matched literally (ESCAPE '\')
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
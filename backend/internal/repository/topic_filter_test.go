@@ -0,0 +1,84 @@
+// Tests MQTT topic filter translation, validation and match errors
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTopicFilterRegex(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		topic   string
+		matches bool
+	}{
+		{name: "exact match", filter: "plant1/line/temp", topic: "plant1/line/temp", matches: true},
+		{name: "exact mismatch", filter: "plant1/line/temp", topic: "plant1/line/tempx", matches: false},
+		{name: "single level", filter: "plant1/+/temperature", topic: "plant1/line3/temperature", matches: true},
+		{name: "single level spans one level only", filter: "plant1/+/temperature", topic: "plant1/a/b/temperature", matches: false},
+		{name: "single level matches empty level", filter: "plant1/+/temperature", topic: "plant1//temperature", matches: true},
+		{name: "multi level", filter: "plant1/+/temperature/#", topic: "plant1/l1/temperature/s1/raw", matches: true},
+		{name: "multi level matches parent", filter: "plant1/+/temperature/#", topic: "plant1/l1/temperature", matches: true},
+		{name: "multi level needs separator", filter: "plant1/#", topic: "plant10/x", matches: false},
+		{name: "hash matches everything", filter: "#", topic: "a/b/c", matches: true},
+		{name: "hash skips system topics", filter: "#", topic: "$SYS/broker/uptime", matches: false},
+		{name: "plus skips system topics", filter: "+/broker/uptime", topic: "$SYS/broker/uptime", matches: false},
+		{name: "explicit system filter", filter: "$SYS/#", topic: "$SYS/broker/uptime", matches: true},
+		{name: "regex metacharacters are literal", filter: "a.b/+", topic: "axb/c", matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := TopicFilterRegex(tt.filter)
+			if err != nil {
+				t.Fatalf("TopicFilterRegex() error = %v", err)
+			}
+
+			if got := regexp.MustCompile(pattern).MatchString(tt.topic); got != tt.matches {
+				t.Errorf("filter %q on topic %q = %v, want %v (pattern %s)", tt.filter, tt.topic, got, tt.matches, pattern)
+			}
+		})
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	invalid := []string{"", "a/#/b", "a/b#", "a/+b", "a+/b"}
+
+	for _, filter := range invalid {
+		if err := ValidateTopicFilter(filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ValidateTopicFilter(%q) = %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+
+	if err := ValidateTopicFilter("a/+/b/#"); err != nil {
+		t.Errorf("ValidateTopicFilter() unexpected error = %v", err)
+	}
+}
+
+func TestMatchError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		invalid bool
+	}{
+		{"postgres invalid regex", &pq.Error{Code: "2201B", Message: "invalid regular expression: invalid escape \\ sequence"}, true},
+		{"other postgres error", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}, false},
+		{"driver error", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := matchError("search topics", tt.err)
+			if errors.Is(err, ErrInvalidFilter) != tt.invalid {
+				t.Errorf("matchError() = %v, invalid filter = %v", err, tt.invalid)
+			}
+			if !tt.invalid && !errors.Is(err, tt.err) {
+				t.Errorf("matchError() = %v, does not wrap %v", err, tt.err)
+			}
+		})
+	}
+}
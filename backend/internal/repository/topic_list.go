@@ -0,0 +1,507 @@
+// Filtered and sorted topic listing
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortField string
+
+const (
+	SortLastSeen  SortField = "last_seen"
+	SortTopic     SortField = "topic"
+	SortBroker    SortField = "broker_id"
+	SortCreatedAt SortField = "created_at"
+	SortSize      SortField = "size"
+)
+
+// Maps sortable fields to SQL expressions; sort input never reaches the query
+// unless it is one of these keys
+func sortExpression(field SortField, sqlite bool) (string, bool) {
+	switch field {
+	case SortLastSeen, "":
+		return "last_seen", true
+	case SortTopic:
+		return "topic", true
+	case SortBroker:
+		return "broker_id", true
+	case SortCreatedAt:
+		return "created_at", true
+	case SortSize:
+		return sizeExpression(sqlite), true
+	}
+	return "", false
+}
+
+func sizeExpression(sqlite bool) string {
+	if sqlite {
+		return "length(sample_payload)"
+	}
+	return "octet_length(sample_payload)"
+}
+
+// Filters and ordering for topic listings. Zero values leave a filter unset
+type ListOptions struct {
+	BrokerIDs      []string
+	PayloadTypes   []models.PayloadType
+	TopicPrefix    string
+	LastSeenAfter  time.Time
+	LastSeenBefore time.Time
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	MinSize        *int64
+	MaxSize        *int64
+	// Tags and Owners keep topics with a matching annotation carrying one of them
+	Tags   []string
+	Owners []string
+	// Flags keeps topics whose sample was flagged by one of these payload
+	// detectors, Flagged those flagged by any detector
+	Flags   []string
+	Flagged bool
+	// LiveAfter hides topics last seen before their broker's cutoff,
+	// StaleBefore keeps only those
+	LiveAfter   AgeCutoff
+	StaleBefore AgeCutoff
+
+	Sort SortField
+	Desc bool
+
+	// After continues a keyset-paginated listing and replaces Offset
+	After  *Cursor
+	Count  CountMode
+	Limit  int
+	Offset int
+}
+
+type CountMode string
+
+const (
+	CountExact    CountMode = "exact"
+	CountEstimate CountMode = "estimate"
+	CountNone     CountMode = "none"
+)
+
+// Position of the last row of a page in keyset pagination: the value of the
+// sort column and the id used as tie-breaker
+type Cursor struct {
+	Sort  SortField `json:"s"`
+	Desc  bool      `json:"d"`
+	Value string    `json:"v"`
+	ID    int64     `json:"i"`
+}
+
+// Encodes the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return &c, nil
+}
+
+// One page of a topic listing. Total is -1 when counting was skipped
+type TopicPage struct {
+	Topics         []models.Topic
+	Total          int
+	TotalEstimated bool
+	NextCursor     *Cursor
+}
+
+// Builds the WHERE clause for the filters in opts
+func (opts ListOptions) where(sqlite bool) whereClause {
+	var where whereClause
+
+	where.addIn("broker_id", opts.BrokerIDs)
+
+	if len(opts.PayloadTypes) > 0 {
+		types := make([]string, len(opts.PayloadTypes))
+		for i, t := range opts.PayloadTypes {
+			types[i] = string(t)
+		}
+		where.addIn("payload_type", types)
+	}
+
+	if opts.TopicPrefix != "" {
+		where.add(`topic LIKE ? ESCAPE '\'`, escapeLike(opts.TopicPrefix)+"%")
+		// LIKE is case-insensitive on SQLite, the prefix must match exactly
+		where.add("substr(topic, 1, ?) = ?", len(opts.TopicPrefix), opts.TopicPrefix)
+	}
+
+	if !opts.LastSeenAfter.IsZero() {
+		where.add("last_seen >= ?", opts.LastSeenAfter.UTC())
+	}
+	if !opts.LastSeenBefore.IsZero() {
+		where.add("last_seen < ?", opts.LastSeenBefore.UTC())
+	}
+	if !opts.CreatedAfter.IsZero() {
+		where.add("created_at >= ?", opts.CreatedAfter.UTC())
+	}
+	if !opts.CreatedBefore.IsZero() {
+		where.add("created_at < ?", opts.CreatedBefore.UTC())
+	}
+
+	if opts.MinSize != nil {
+		where.add(sizeExpression(sqlite)+" >= ?", *opts.MinSize)
+	}
+	if opts.MaxSize != nil {
+		where.add(sizeExpression(sqlite)+" <= ?", *opts.MaxSize)
+	}
+
+	if len(opts.Owners) > 0 {
+		where.add("EXISTS (SELECT 1 FROM annotations a WHERE "+annotationMatch(sqlite)+
+			" AND a.owner IN ("+placeholders(len(opts.Owners))+"))", stringArgs(opts.Owners)...)
+	}
+	if len(opts.Tags) > 0 {
+		where.add("EXISTS (SELECT 1 FROM annotations a JOIN annotation_tags t ON t.annotation_id = a.id WHERE "+
+			annotationMatch(sqlite)+" AND t.tag IN ("+placeholders(len(opts.Tags))+"))", stringArgs(opts.Tags)...)
+	}
+
+	if opts.Flagged {
+		where.add("flags <> ''")
+	}
+	if len(opts.Flags) > 0 {
+		conds := make([]string, len(opts.Flags))
+		args := make([]any, len(opts.Flags))
+		for i, flag := range opts.Flags {
+			conds[i] = `(' ' || flags || ' ') LIKE ? ESCAPE '\'`
+			args[i] = "% " + escapeLike(flag) + " %"
+		}
+		where.add("("+strings.Join(conds, " OR ")+")", args...)
+	}
+
+	if !opts.LiveAfter.IsZero() {
+		cond, args := opts.LiveAfter.olderCondition()
+		where.add("NOT "+cond, args...)
+	}
+	if !opts.StaleBefore.IsZero() {
+		cond, args := opts.StaleBefore.olderCondition()
+		where.add(cond, args...)
+	}
+
+	return where
+}
+
+// Condition for an annotation a applying to the current row of topics
+func annotationMatch(sqlite bool) string {
+	regexOp := "~"
+	if sqlite {
+		regexOp = "REGEXP"
+	}
+	return "(a.broker_id = '' OR a.broker_id = topics.broker_id) AND topics.topic " + regexOp + " a.topic_regex"
+}
+
+// Returns the sort field with the default applied
+func (opts ListOptions) sortField() SortField {
+	if opts.Sort == "" {
+		return SortLastSeen
+	}
+	return opts.Sort
+}
+
+// Adds the keyset condition that continues after the cursor position
+func (opts ListOptions) addCursor(where *whereClause, sqlite bool) error {
+	c := opts.After
+	if c.Sort != opts.sortField() || c.Desc != opts.Desc {
+		return fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
+	}
+
+	column, _ := sortExpression(c.Sort, sqlite)
+
+	var value any
+	switch c.Sort {
+	case SortLastSeen, SortCreatedAt:
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		value = t.UTC()
+	case SortSize:
+		n, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		value = n
+	default:
+		value = c.Value
+	}
+
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+	where.add(
+		"("+column+" "+op+" ? OR ("+column+" = ? AND id "+op+" ?))",
+		value, value, c.ID,
+	)
+	return nil
+}
+
+// Builds the cursor pointing at the given topic for the listing's sort order
+func (opts ListOptions) cursorFor(t models.Topic) *Cursor {
+	c := &Cursor{Sort: opts.sortField(), Desc: opts.Desc, ID: t.ID}
+
+	switch c.Sort {
+	case SortLastSeen:
+		c.Value = t.LastSeen.UTC().Format(time.RFC3339Nano)
+	case SortCreatedAt:
+		c.Value = t.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortSize:
+		c.Value = strconv.Itoa(len(t.SamplePayload))
+	case SortTopic:
+		c.Value = t.Topic
+	case SortBroker:
+		c.Value = t.BrokerID
+	}
+	return c
+}
+
+// Returns the ORDER BY clause, using id as tie-breaker so pages are stable
+func (opts ListOptions) orderBy(sqlite bool) (string, error) {
+	column, ok := sortExpression(opts.Sort, sqlite)
+	if !ok {
+		return "", fmt.Errorf("unknown sort field %q", opts.Sort)
+	}
+
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+	return " ORDER BY " + column + " " + direction + ", id " + direction, nil
+}
+
+// Retrieves a filtered, sorted page of topics. Pages continue either by offset
+// or, when opts.After is set, by keyset; counting the matches is optional
+func (r *TopicRepository) List(opts ListOptions) (*TopicPage, error) {
+	defer metrics.TimeQuery("list")()
+
+	sqlite := r.isSQLite()
+	where := opts.where(sqlite)
+
+	orderBy, err := opts.orderBy(sqlite)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TopicPage{Total: -1}
+
+	switch opts.Count {
+	case CountExact, "":
+		page.Total, err = r.countTopics(where, sqlite)
+	case CountEstimate:
+		page.Total, page.TotalEstimated, err = r.estimateTopics(where, sqlite)
+	case CountNone:
+	default:
+		err = fmt.Errorf("unknown count mode %q", opts.Count)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offset := opts.Offset
+	if opts.After != nil {
+		if err := opts.addCursor(&where, sqlite); err != nil {
+			return nil, err
+		}
+		offset = 0
+	}
+
+	// One extra row tells whether another page follows
+	query := rebind("SELECT "+topicColumns+" FROM topics"+where.String()+orderBy+" LIMIT ? OFFSET ?", sqlite)
+
+	rows, err := r.db.Query(query, append(where.args, opts.Limit+1, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("query topics: %w", err)
+	}
+	defer rows.Close()
+
+	topics, err := scanTopics(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(topics) > opts.Limit {
+		topics = topics[:opts.Limit]
+		if opts.Limit > 0 {
+			page.NextCursor = opts.cursorFor(topics[len(topics)-1])
+		}
+	}
+	page.Topics = topics
+
+	return page, nil
+}
+
+func (r *TopicRepository) countTopics(where whereClause, sqlite bool) (int, error) {
+	var total int
+	query := rebind("SELECT COUNT(*) FROM topics"+where.String(), sqlite)
+	if err := r.db.QueryRow(query, where.args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count topics: %w", err)
+	}
+	return total, nil
+}
+
+// Estimates the number of matches from Postgres planner statistics instead of
+// scanning. SQLite keeps no such statistics, so it counts exactly
+func (r *TopicRepository) estimateTopics(where whereClause, sqlite bool) (int, bool, error) {
+	if sqlite {
+		total, err := r.countTopics(where, sqlite)
+		return total, false, err
+	}
+
+	var plan []byte
+	query := rebind("EXPLAIN (FORMAT JSON) SELECT id FROM topics"+where.String(), sqlite)
+	if err := r.db.QueryRow(query, where.args...).Scan(&plan); err != nil {
+		return 0, false, fmt.Errorf("estimate topics: %w", err)
+	}
+
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		return 0, false, fmt.Errorf("parse query plan: %w", err)
+	}
+	// A plan without rows has nothing to estimate from
+	if len(explain) == 0 {
+		total, err := r.countTopics(where, sqlite)
+		return total, false, err
+	}
+
+	return int(explain[0].Plan.Rows), true, nil
+}
+
+// Rows fetched per query by Each, a variable so tests can use small batches
+var eachBatchSize = 500
+
+// Calls fn for every topic matching the filters and sort order of opts.
+// Topics are fetched in keyset-paged batches and each batch's rows are closed
+// before fn sees it, so a slow consumer never holds a read open against
+// writers and exports never keep the whole catalog in memory. Paging fields
+// are ignored; an error from fn stops the iteration
+func (r *TopicRepository) Each(opts ListOptions, fn func(models.Topic) error) error {
+	defer metrics.TimeQuery("each")()
+
+	sqlite := r.isSQLite()
+	orderBy, err := opts.orderBy(sqlite)
+	if err != nil {
+		return err
+	}
+
+	opts.After = nil
+	for {
+		where := opts.where(sqlite)
+		if opts.After != nil {
+			if err := opts.addCursor(&where, sqlite); err != nil {
+				return err
+			}
+		}
+
+		query := rebind("SELECT "+topicColumns+" FROM topics"+where.String()+orderBy+" LIMIT ?", sqlite)
+		topics, err := r.queryTopics(query, append(where.args, eachBatchSize)...)
+		if err != nil {
+			return err
+		}
+
+		for _, topic := range topics {
+			if err := fn(topic); err != nil {
+				return err
+			}
+		}
+		if len(topics) < eachBatchSize {
+			return nil
+		}
+		opts.After = opts.cursorFor(topics[len(topics)-1])
+	}
+}
+
+// Calls fn with the broker and name of every topic matching the filters of
+// opts, in topic order. Batches like Each but reads neither payloads nor
+// flags, for checks that only need the names
+func (r *TopicRepository) EachName(opts ListOptions, fn func(brokerID, topic string) error) error {
+	defer metrics.TimeQuery("each_name")()
+
+	sqlite := r.isSQLite()
+	opts.Sort, opts.Desc, opts.After = SortTopic, false, nil
+	orderBy, err := opts.orderBy(sqlite)
+	if err != nil {
+		return err
+	}
+
+	for {
+		where := opts.where(sqlite)
+		if opts.After != nil {
+			if err := opts.addCursor(&where, sqlite); err != nil {
+				return err
+			}
+		}
+
+		query := rebind("SELECT id, broker_id, topic FROM topics"+where.String()+orderBy+" LIMIT ?", sqlite)
+		topics, err := r.queryNames(query, append(where.args, eachBatchSize)...)
+		if err != nil {
+			return err
+		}
+
+		for _, topic := range topics {
+			if err := fn(topic.BrokerID, topic.Topic); err != nil {
+				return err
+			}
+		}
+		if len(topics) < eachBatchSize {
+			return nil
+		}
+		opts.After = opts.cursorFor(topics[len(topics)-1])
+	}
+}
+
+// Runs a query for id, broker_id and topic and scans all of its rows
+func (r *TopicRepository) queryNames(query string, args ...any) ([]models.Topic, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query topic names: %w", err)
+	}
+	defer rows.Close()
+
+	var topics []models.Topic
+	for rows.Next() {
+		var t models.Topic
+		if err := rows.Scan(&t.ID, &t.BrokerID, &t.Topic); err != nil {
+			return nil, fmt.Errorf("scan topic name: %w", err)
+		}
+		topics = append(topics, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query topic names: %w", err)
+	}
+	return topics, nil
+}
+
+// Runs a topic query and scans all of its rows, closing them before returning
+func (r *TopicRepository) queryTopics(query string, args ...any) ([]models.Topic, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query topics: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTopics(rows)
+}
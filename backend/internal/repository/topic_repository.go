@@ -4,150 +4,270 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"mqtt-catalog/internal/events"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/payload"
 	"mqtt-catalog/pkg/models"
 	"time"
 )
 
 type TopicRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	events *events.Hub
+	// driftWanted, when set, reports whether anyone listens for schema drift
+	driftWanted func() bool
 }
 
 func NewTopicRepository(db *sql.DB) *TopicRepository {
 	return &TopicRepository{db: db}
 }
 
-// Inserts new topic or updates existing one with latest payload sample and timestamp
+// Publishes a change event to hub for every saved sample
+func (r *TopicRepository) SetEvents(hub *events.Hub) {
+	r.events = hub
+}
+
+// Compares saved samples with the previous ones for schema drift only while
+// wanted reports true; without it drift is always computed
+func (r *TopicRepository) SetDriftCheck(wanted func() bool) {
+	r.driftWanted = wanted
+}
+
+// Returns the hub set with SetEvents, nil when events are not published
+func (r *TopicRepository) Events() *events.Hub {
+	return r.events
+}
+
+// Inserts new topic or updates existing one with latest payload sample and timestamp,
+// keeping the full-text index over the sample in step
 func (r *TopicRepository) Upsert(sample models.Sample) error {
-	query := `
-		INSERT INTO topics (broker_id, topic, payload_type, sample_payload, last_seen, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(broker_id, topic)
-		DO UPDATE SET
-			payload_type = excluded.payload_type,
-			sample_payload = excluded.sample_payload,
-			last_seen = excluded.last_seen
-	`
-	// For Postgres, use $1, $2 syntax instead of ?
-	var err error
-	var version string
-	checkErr := r.db.QueryRow("SELECT sqlite_version()").Scan(&version)
-	isSQLite := checkErr == nil
-
-	if !isSQLite {
-		// Postgres query
-		query = `
-			INSERT INTO topics (broker_id, topic, payload_type, sample_payload, last_seen, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-			ON CONFLICT(broker_id, topic)
-			DO UPDATE SET
-				payload_type = EXCLUDED.payload_type,
-				sample_payload = EXCLUDED.sample_payload,
-				last_seen = EXCLUDED.last_seen
-		`
-	}
-
-	now := time.Now()
-	_, err = r.db.Exec(query,
-		sample.BrokerID,
-		sample.Topic,
-		sample.PayloadType,
-		sample.Payload,
-		sample.Timestamp,
-		now,
-	)
+	_, _, err := r.Save(sample)
+	return err
+}
+
+// Upserts a sample like Upsert and returns the stored topic and whether it
+// was created. The insert or update reports the topic's id and creation time
+// itself; the previous sample is only read when change events are published
+func (r *TopicRepository) Save(sample models.Sample) (*models.Topic, bool, error) {
+	defer metrics.TimeQuery("upsert")()
 
+	saved, err := r.saveAll([]models.Sample{sample})
 	if err != nil {
-		return fmt.Errorf("upsert topic: %w", err)
+		return nil, false, err
 	}
+	return &saved[0].stored, saved[0].created, nil
+}
+
+// Upserts every sample in one transaction, so either all of them are stored
+// or none are. Change events are published once the transaction committed
+func (r *TopicRepository) SaveAll(samples []models.Sample) error {
+	defer metrics.TimeQuery("upsert_all")()
 
-	return nil
+	_, err := r.saveAll(samples)
+	return err
 }
 
-// Retrieves paginated list of all topics with total count
-func (r *TopicRepository) GetAll(limit, offset int) ([]models.Topic, int, error) {
-	// Get total count
-	var total int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM topics").Scan(&total)
+// A sample stored by saveAll with what its change event needs
+type savedSample struct {
+	stored   models.Topic
+	previous *models.Topic
+	created  bool
+}
+
+func (r *TopicRepository) saveAll(samples []models.Sample) ([]savedSample, error) {
+	sqlite := r.isSQLite()
+	drift := r.driftWanted == nil || r.driftWanted()
+
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, 0, fmt.Errorf("count topics: %w", err)
+		return nil, fmt.Errorf("upsert topic: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Get paginated results
-	query := `
-		SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
-		FROM topics
-		ORDER BY last_seen DESC
-		LIMIT ? OFFSET ?
-	`
-
-	// Check if Postgres
-	var version string
-	checkErr := r.db.QueryRow("SELECT sqlite_version()").Scan(&version)
-	if checkErr != nil {
-		// Postgres
-		query = `
-			SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
-			FROM topics
-			ORDER BY last_seen DESC
-			LIMIT $1 OFFSET $2
-		`
-	}
-
-	rows, err := r.db.Query(query, limit, offset)
+	saved := make([]savedSample, 0, len(samples))
+	for _, sample := range samples {
+		s, err := r.saveTx(tx, sample, drift, sqlite)
+		if err != nil {
+			return nil, fmt.Errorf("upsert topic: %w", err)
+		}
+		saved = append(saved, s)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("upsert topic: %w", err)
+	}
+
+	if r.events != nil {
+		for _, s := range saved {
+			r.events.Publish(topicEvent(s.stored, s.previous, s.created, drift))
+		}
+	}
+	return saved, nil
+}
+
+func (r *TopicRepository) saveTx(tx *sql.Tx, sample models.Sample, drift, sqlite bool) (savedSample, error) {
+	var s savedSample
+	var err error
+	if r.events != nil {
+		if s.previous, err = previousSample(tx, sample, drift, sqlite); err != nil {
+			return s, err
+		}
+	}
+
+	// Timestamps are stored in UTC so range filters compare consistently
+	s.stored = models.Topic{
+		BrokerID:      sample.BrokerID,
+		Topic:         sample.Topic,
+		PayloadType:   sample.PayloadType,
+		SamplePayload: sample.Payload,
+		LastSeen:      sample.Timestamp.UTC(),
+		CreatedAt:     time.Now().UTC(),
+		Truncated:     sample.Truncated,
+		Flags:         splitNames(joinNames(sample.Flags)),
+		Redacted:      sample.Redacted,
+	}
+	if !sample.CreatedAt.IsZero() {
+		s.stored.CreatedAt = sample.CreatedAt.UTC()
+	}
+	text := payload.ExtractText(sample.Payload, sample.PayloadType)
+
+	if sqlite {
+		s.created, err = upsertSQLite(tx, &s.stored, text)
+	} else {
+		s.created, err = upsertPostgres(tx, &s.stored, text)
+	}
+	return s, err
+}
+
+// Reads the fields of the topic's current sample that change events compare
+// against, nil when the topic is new. The payload is only needed, and read,
+// for schema drift
+func previousSample(tx *sql.Tx, sample models.Sample, withPayload, sqlite bool) (*models.Topic, error) {
+	var t models.Topic
+	var err error
+	query := "SELECT payload_type, truncated FROM topics WHERE broker_id = ? AND topic = ?"
+	if withPayload {
+		query = "SELECT payload_type, truncated, sample_payload FROM topics WHERE broker_id = ? AND topic = ?"
+		err = tx.QueryRow(rebind(query, sqlite), sample.BrokerID, sample.Topic).Scan(&t.PayloadType, &t.Truncated, &t.SamplePayload)
+	} else {
+		err = tx.QueryRow(rebind(query, sqlite), sample.BrokerID, sample.Topic).Scan(&t.PayloadType, &t.Truncated)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, 0, fmt.Errorf("query topics: %w", err)
+		return nil, fmt.Errorf("read previous sample: %w", err)
 	}
-	defer rows.Close()
+	return &t, nil
+}
 
-	var topics []models.Topic
-	for rows.Next() {
-		var t models.Topic
-		err := rows.Scan(
-			&t.ID,
-			&t.BrokerID,
-			&t.Topic,
-			&t.PayloadType,
-			&t.SamplePayload,
-			&t.LastSeen,
-			&t.CreatedAt,
-		)
-		if err != nil {
-			return nil, 0, fmt.Errorf("scan topic: %w", err)
+// Inserts the topic unless it exists and updates it otherwise, since SQLite
+// cannot tell the two apart after an upsert, then keeps the full-text index
+// in step. Sets the stored id and creation time and reports whether the
+// topic was created
+func upsertSQLite(tx *sql.Tx, t *models.Topic, text string) (bool, error) {
+	flags := joinNames(t.Flags)
+
+	created := true
+	err := tx.QueryRow(`
+		INSERT INTO topics (broker_id, topic, payload_type, sample_payload, last_seen, created_at, truncated, flags, redacted)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(broker_id, topic) DO NOTHING
+		RETURNING id, created_at
+	`, t.BrokerID, t.Topic, t.PayloadType, t.SamplePayload, t.LastSeen, t.CreatedAt, t.Truncated, flags, t.Redacted).Scan(&t.ID, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		created = false
+		err = tx.QueryRow(`
+			UPDATE topics SET payload_type = ?, sample_payload = ?, last_seen = ?, truncated = ?, flags = ?, redacted = ?
+			WHERE broker_id = ? AND topic = ?
+			RETURNING id, created_at
+		`, t.PayloadType, t.SamplePayload, t.LastSeen, t.Truncated, flags, t.Redacted, t.BrokerID, t.Topic).Scan(&t.ID, &t.CreatedAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return created, indexSQLiteSample(tx, t.ID, t.BrokerID, t.Topic, text)
+}
+
+// Upserts the topic, the tsvector column is generated from sample_text. A
+// row inserted by the statement has no xmax, an updated one does
+func upsertPostgres(tx *sql.Tx, t *models.Topic, text string) (bool, error) {
+	var created bool
+	err := tx.QueryRow(`
+		INSERT INTO topics (broker_id, topic, payload_type, sample_payload, last_seen, created_at, truncated, flags, redacted, sample_text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT(broker_id, topic)
+		DO UPDATE SET
+			payload_type = EXCLUDED.payload_type,
+			sample_payload = EXCLUDED.sample_payload,
+			last_seen = EXCLUDED.last_seen,
+			truncated = EXCLUDED.truncated,
+			flags = EXCLUDED.flags,
+			redacted = EXCLUDED.redacted,
+			sample_text = EXCLUDED.sample_text
+		RETURNING id, created_at, (xmax = 0)
+	`, t.BrokerID, t.Topic, t.PayloadType, t.SamplePayload, t.LastSeen, t.CreatedAt, t.Truncated, joinNames(t.Flags), t.Redacted, text,
+	).Scan(&t.ID, &t.CreatedAt, &created)
+	return created, err
+}
+
+// Classifies a saved sample as a new topic, a payload type change, a change
+// of its JSON or XML fields (when drift is checked) or a refresh
+func topicEvent(stored models.Topic, previous *models.Topic, created, drift bool) models.TopicEvent {
+	e := models.TopicEvent{Type: models.EventTopicSampleRefreshed, Topic: stored}
+	switch {
+	case created || previous == nil:
+		e.Type = models.EventTopicCreated
+	case previous.PayloadType != stored.PayloadType:
+		e.Type = models.EventTopicPayloadTypeChanged
+		e.PreviousPayloadType = previous.PayloadType
+	case drift:
+		e.AddedFields, e.RemovedFields = schemaDrift(*previous, stored)
+		if len(e.AddedFields) > 0 || len(e.RemovedFields) > 0 {
+			e.Type = models.EventTopicSchemaDrift
 		}
-		topics = append(topics, t)
 	}
-	return topics, total, nil
+	return e
+}
+
+// Compares the field paths of two samples of the same payload type. Truncated
+// samples are not compared since their cut-off fields would look removed
+func schemaDrift(previous, stored models.Topic) (added, removed []string) {
+	if previous.Truncated || stored.Truncated {
+		return nil, nil
+	}
+	before, ok := payload.FieldPaths(previous.SamplePayload, previous.PayloadType)
+	if !ok {
+		return nil, nil
+	}
+	after, ok := payload.FieldPaths(stored.SamplePayload, stored.PayloadType)
+	if !ok {
+		return nil, nil
+	}
+	return payload.DiffFields(before, after)
+}
+
+// Retrieves paginated list of all topics with total count
+func (r *TopicRepository) GetAll(limit, offset int) ([]models.Topic, int, error) {
+	page, err := r.List(ListOptions{Desc: true, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Topics, page.Total, nil
 }
 
 // Finds specific topic by broker ID and topic name combination
 func (r *TopicRepository) GetByBrokerAndTopic(brokerID, topic string) (*models.Topic, error) {
-	query := `
-		SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
+	defer metrics.TimeQuery("get_by_broker_and_topic")()
+
+	query := rebind(`
+		SELECT `+topicColumns+`
 		FROM topics
 		WHERE broker_id = ? AND topic = ?
-	`
-
-	var version string
-	checkErr := r.db.QueryRow("SELECT sqlite_version()").Scan(&version)
-	if checkErr != nil {
-		query = `
-			SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
-			FROM topics
-			WHERE broker_id = $1 AND topic = $2
-		`
-	}
-
-	var t models.Topic
-	err := r.db.QueryRow(query, brokerID, topic).Scan(
-		&t.ID,
-		&t.BrokerID,
-		&t.Topic,
-		&t.PayloadType,
-		&t.SamplePayload,
-		&t.LastSeen,
-		&t.CreatedAt,
-	)
+	`, r.isSQLite())
 
+	t, err := scanTopic(r.db.QueryRow(query, brokerID, topic))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -164,60 +284,85 @@ func (r *TopicRepository) GetByBroker(
 	brokerID string,
 	limit, offset int,
 ) ([]models.Topic, int, error) {
-	countQuery := "SELECT COUNT(*) FROM topics WHERE broker_id = ?"
+	page, err := r.List(ListOptions{
+		BrokerIDs: []string{brokerID},
+		Desc:      true,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page.Topics, page.Total, nil
+}
+
+// Returns up to limit names of the broker's topics seen at or after since
+// that sort after the given topic, sorted, without loading their samples
+func (r *TopicRepository) KnownTopics(brokerID string, since time.Time, after string, limit int) ([]string, error) {
+	defer metrics.TimeQuery("known_topics")()
+
+	rows, err := r.db.Query(rebind(
+		"SELECT topic FROM topics WHERE broker_id = ? AND last_seen >= ? AND topic > ? ORDER BY topic LIMIT ?", r.isSQLite()),
+		brokerID, since.UTC(), after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query known topics: %w", err)
+	}
+	defer rows.Close()
 
-	var version string
-	checkErr := r.db.QueryRow("SELECT sqlite_version()").Scan(&version)
-	if checkErr != nil {
-		countQuery = "SELECT COUNT(*) FROM topics WHERE broker_id = $1"
+	topics := []string{}
+	for rows.Next() {
+		var topic string
+		if err := rows.Scan(&topic); err != nil {
+			return nil, fmt.Errorf("scan known topic: %w", err)
+		}
+		topics = append(topics, topic)
 	}
+	return topics, rows.Err()
+}
+
+type SearchParams struct {
+	Query     string
+	Mode      MatchMode
+	BrokerIDs []string
+	Limit     int
+	Offset    int
+}
+
+// Finds topics matching an MQTT filter, substring or regex across all brokers
+// or the given subset, with the matching evaluated by the database
+func (r *TopicRepository) Search(params SearchParams) ([]models.Topic, int, error) {
+	defer metrics.TimeQuery("search")()
+
+	sqlite := r.isSQLite()
+
+	var where whereClause
+	if err := where.addTopicMatch(params.Query, params.Mode, sqlite); err != nil {
+		return nil, 0, err
+	}
+	where.addIn("broker_id", params.BrokerIDs)
 
 	var total int
-	err := r.db.QueryRow(countQuery, brokerID).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("count topics: %w", err)
+	countQuery := rebind("SELECT COUNT(*) FROM topics"+where.String(), sqlite)
+	if err := r.db.QueryRow(countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, matchError("count topics", err)
 	}
 
-	query := `
-		SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
-		FROM topics
-		WHERE broker_id = ?
+	query := rebind(`
+		SELECT `+topicColumns+`
+		FROM topics`+where.String()+`
 		ORDER BY last_seen DESC
 		LIMIT ? OFFSET ?
-	`
+	`, sqlite)
 
-	if checkErr != nil {
-		query = `
-			SELECT id, broker_id, topic, payload_type, sample_payload, last_seen, created_at
-			FROM topics
-			WHERE broker_id = $1
-			ORDER BY last_Seen DESC
-			LIMIT $2 OFFSET $3
-		`
-	}
-
-	rows, err := r.db.Query(query, brokerID, limit, offset)
+	rows, err := r.db.Query(query, append(where.args, params.Limit, params.Offset)...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("query topics: %w", err)
+		return nil, 0, matchError("search topics", err)
 	}
 	defer rows.Close()
 
-	var topics []models.Topic
-	for rows.Next() {
-		var t models.Topic
-		err := rows.Scan(
-			&t.ID,
-			&t.BrokerID,
-			&t.Topic,
-			&t.PayloadType,
-			&t.SamplePayload,
-			&t.LastSeen,
-			&t.CreatedAt,
-		)
-		if err != nil {
-			return nil, 0, fmt.Errorf("scan topic: %w", err)
-		}
-		topics = append(topics, t)
+	topics, err := scanTopics(rows)
+	if err != nil {
+		return nil, 0, err
 	}
 	return topics, total, nil
 }
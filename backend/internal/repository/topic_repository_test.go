@@ -2,16 +2,19 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/events"
 	"mqtt-catalog/pkg/models"
+	"slices"
+	"strings"
 	"testing"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
+	db, err := sql.Open(database.SQLiteDriver, ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
@@ -91,6 +94,55 @@ func TestTopicRepository_Upsert_Update(t *testing.T) {
 	}
 }
 
+func TestTopicRepository_Save(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	sample := models.Sample{
+		BrokerID:    "test-broker",
+		Topic:       "test/topic",
+		PayloadType: models.PayloadText,
+		Payload:     []byte("on"),
+		Timestamp:   time.Now(),
+	}
+
+	topic, created, err := repo.Save(sample)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if !created || topic.ID == 0 || string(topic.SamplePayload) != "on" {
+		t.Errorf("expected new topic, got created=%v topic=%+v", created, topic)
+	}
+
+	sample.Payload = []byte("off")
+	updated, created, err := repo.Save(sample)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if created || updated.ID != topic.ID || string(updated.SamplePayload) != "off" {
+		t.Errorf("expected updated topic, got created=%v topic=%+v", created, updated)
+	}
+
+	// An explicit CreatedAt is kept on insert, used by imports
+	imported := models.Sample{
+		BrokerID:    "test-broker",
+		Topic:       "imported/topic",
+		PayloadType: models.PayloadText,
+		Payload:     []byte("idle"),
+		Timestamp:   time.Now(),
+		CreatedAt:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	topic, _, err = repo.Save(imported)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if !topic.CreatedAt.Equal(imported.CreatedAt) {
+		t.Errorf("CreatedAt = %v, want %v", topic.CreatedAt, imported.CreatedAt)
+	}
+}
+
 func TestTopicRepository_GetAll(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -199,6 +251,54 @@ func TestTopicRepository_GetByBroker(t *testing.T) {
 	}
 }
 
+func TestTopicRepository_KnownTopics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+	now := time.Now()
+
+	samples := []struct {
+		brokerID string
+		topic    string
+		age      time.Duration
+	}{
+		{"broker1", "plant1/temp", time.Minute},
+		{"broker1", "plant1/flow", 30 * time.Minute},
+		{"broker1", "plant1/old", 2 * time.Hour},
+		{"broker2", "plant2/temp", time.Minute},
+	}
+	for _, s := range samples {
+		repo.Upsert(models.Sample{
+			BrokerID:    s.brokerID,
+			Topic:       s.topic,
+			PayloadType: models.PayloadJSON,
+			Payload:     []byte(`{}`),
+			Timestamp:   now.Add(-s.age),
+		})
+	}
+
+	topics, err := repo.KnownTopics("broker1", now.Add(-time.Hour), "", 10)
+	if err != nil {
+		t.Fatalf("KnownTopics() error = %v", err)
+	}
+	if want := []string{"plant1/flow", "plant1/temp"}; !slices.Equal(topics, want) {
+		t.Errorf("KnownTopics() = %v, want %v", topics, want)
+	}
+
+	// Pages continue after the last topic of the previous one
+	if topics, _ := repo.KnownTopics("broker1", time.Time{}, "", 2); !slices.Equal(topics, []string{"plant1/flow", "plant1/old"}) {
+		t.Errorf("KnownTopics() first page = %v", topics)
+	}
+	if topics, _ := repo.KnownTopics("broker1", time.Time{}, "plant1/old", 2); !slices.Equal(topics, []string{"plant1/temp"}) {
+		t.Errorf("KnownTopics() second page = %v", topics)
+	}
+
+	if topics, _ := repo.KnownTopics("broker3", time.Time{}, "", 10); topics == nil || len(topics) != 0 {
+		t.Errorf("KnownTopics() for unknown broker = %#v, want empty", topics)
+	}
+}
+
 func TestTopicRepository_GetByBrokerAndTopic_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -214,3 +314,609 @@ func TestTopicRepository_GetByBrokerAndTopic_NotFound(t *testing.T) {
 		t.Error("expected nil, got topic")
 	}
 }
+
+func TestTopicRepository_Search(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	topics := []struct{ broker, topic string }{
+		{"broker1", "plant1/line1/temperature"},
+		{"broker1", "plant1/line2/temperature/raw"},
+		{"broker1", "plant1/line1/humidity"},
+		{"broker2", "plant1/line3/temperature"},
+		{"broker2", "plant2/line1/temperature"},
+	}
+	for _, tp := range topics {
+		repo.Upsert(models.Sample{
+			BrokerID:    tp.broker,
+			Topic:       tp.topic,
+			PayloadType: models.PayloadJSON,
+			Payload:     []byte(`{}`),
+			Timestamp:   time.Now(),
+		})
+	}
+
+	tests := []struct {
+		name   string
+		params SearchParams
+		want   int
+	}{
+		{"filter across brokers", SearchParams{Query: "plant1/+/temperature/#", Mode: MatchFilter}, 3},
+		{"filter with broker subset", SearchParams{Query: "plant1/+/temperature/#", BrokerIDs: []string{"broker2"}}, 1},
+		{"single level filter", SearchParams{Query: "+/line1/+"}, 3},
+		{"substring", SearchParams{Query: "HUMID", Mode: MatchSubstring}, 1},
+		{"regex", SearchParams{Query: `^plant[12]/line1/`, Mode: MatchRegex}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Limit = 10
+			got, total, err := repo.Search(tt.params)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			if total != tt.want || len(got) != tt.want {
+				t.Errorf("Search() total = %d, len = %d, want %d", total, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicRepository_Search_Pagination(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	for i := 0; i < 5; i++ {
+		repo.Upsert(models.Sample{
+			BrokerID:    "test-broker",
+			Topic:       "devices/" + string(rune('a'+i)) + "/status",
+			PayloadType: models.PayloadText,
+			Payload:     []byte("ok"),
+			Timestamp:   time.Now(),
+		})
+	}
+
+	page, total, err := repo.Search(SearchParams{Query: "devices/+/status", Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if total != 5 {
+		t.Errorf("total = %d, want 5", total)
+	}
+
+	if len(page) != 1 {
+		t.Errorf("len(page) = %d, want 1", len(page))
+	}
+}
+
+func TestTopicRepository_Search_InvalidFilter(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	_, _, err := repo.Search(SearchParams{Query: "a/#/b", Limit: 10})
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Search() error = %v, want ErrInvalidFilter", err)
+	}
+
+	_, _, err = repo.Search(SearchParams{Query: "(", Mode: MatchRegex, Limit: 10})
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Search() error = %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestTopicRepository_FullTextSearch(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	samples := []models.Sample{
+		{BrokerID: "broker1", Topic: "line1/meter", PayloadType: models.PayloadJSON, Payload: []byte(`{"serial": "SN-4711", "kwh": 12}`)},
+		{BrokerID: "broker1", Topic: "line2/meter", PayloadType: models.PayloadXML, Payload: []byte(`<meter serial="SN-0815"><kwh>3</kwh></meter>`)},
+		{BrokerID: "broker2", Topic: "line3/status", PayloadType: models.PayloadText, Payload: []byte(`pump SN-4711 running <script>alert(1)</script>`)},
+		{BrokerID: "broker2", Topic: "line4/image", PayloadType: models.PayloadBinary, Payload: []byte{0xFF, 0xD8}},
+	}
+	for _, s := range samples {
+		s.Timestamp = time.Now()
+		if err := repo.Upsert(s); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	results, total, err := repo.FullTextSearch("SN-4711", 10, 0)
+	if err != nil {
+		t.Fatalf("FullTextSearch() error = %v", err)
+	}
+
+	if total != 2 || len(results) != 2 {
+		t.Fatalf("total = %d, len = %d, want 2", total, len(results))
+	}
+
+	for _, res := range results {
+		if !strings.Contains(res.Snippet, "<mark>") {
+			t.Errorf("snippet %q has no highlight", res.Snippet)
+		}
+		// Payload markup is escaped, only the highlight is HTML
+		if strings.Contains(res.Snippet, "<script>") {
+			t.Errorf("snippet %q contains unescaped payload markup", res.Snippet)
+		}
+	}
+
+	// Updating the sample replaces its index entry
+	repo.Upsert(models.Sample{
+		BrokerID:    "broker1",
+		Topic:       "line1/meter",
+		PayloadType: models.PayloadJSON,
+		Payload:     []byte(`{"serial": "SN-9999"}`),
+		Timestamp:   time.Now(),
+	})
+
+	_, total, _ = repo.FullTextSearch("SN-4711", 10, 0)
+	if total != 1 {
+		t.Errorf("total after update = %d, want 1", total)
+	}
+
+	_, total, _ = repo.FullTextSearch("kwh", 10, 0)
+	if total != 1 {
+		t.Errorf("total for field name = %d, want 1", total)
+	}
+}
+
+func TestTopicRepository_List(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	samples := []models.Sample{
+		{BrokerID: "broker1", Topic: "site/a/temp", PayloadType: models.PayloadJSON, Payload: []byte(`{"t": 1}`), Timestamp: base},
+		{BrokerID: "broker1", Topic: "site/b/temp", PayloadType: models.PayloadText, Payload: []byte(`21.5`), Timestamp: base.Add(time.Hour)},
+		{BrokerID: "broker2", Topic: "Site/c/temp", PayloadType: models.PayloadBinary, Payload: []byte{0xFF, 0x00, 0x01, 0x02, 0x03, 0x04}, Timestamp: base.Add(2 * time.Hour)},
+		{BrokerID: "broker3", Topic: "other/x", PayloadType: models.PayloadJSON, Payload: []byte(`{}`), Timestamp: base.Add(3 * time.Hour)},
+	}
+	for _, s := range samples {
+		repo.Upsert(s)
+	}
+
+	size := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		wantTopic []string
+	}{
+		{
+			name:      "default sorts by last_seen desc",
+			opts:      ListOptions{Desc: true},
+			wantTopic: []string{"other/x", "Site/c/temp", "site/b/temp", "site/a/temp"},
+		},
+		{
+			name:      "multiple brokers",
+			opts:      ListOptions{BrokerIDs: []string{"broker2", "broker3"}, Sort: SortTopic},
+			wantTopic: []string{"Site/c/temp", "other/x"},
+		},
+		{
+			name:      "payload type",
+			opts:      ListOptions{PayloadTypes: []models.PayloadType{models.PayloadJSON}, Sort: SortTopic},
+			wantTopic: []string{"other/x", "site/a/temp"},
+		},
+		{
+			name:      "prefix is case-sensitive",
+			opts:      ListOptions{TopicPrefix: "site/", Sort: SortTopic},
+			wantTopic: []string{"site/a/temp", "site/b/temp"},
+		},
+		{
+			name:      "last_seen range",
+			opts:      ListOptions{LastSeenAfter: base.Add(time.Hour), LastSeenBefore: base.Add(3 * time.Hour), Sort: SortLastSeen},
+			wantTopic: []string{"site/b/temp", "Site/c/temp"},
+		},
+		{
+			name:      "size range sorted by size desc",
+			opts:      ListOptions{MinSize: size(4), MaxSize: size(8), Sort: SortSize, Desc: true},
+			wantTopic: []string{"site/a/temp", "Site/c/temp", "site/b/temp"},
+		},
+		{
+			name:      "broker asc",
+			opts:      ListOptions{Sort: SortBroker, Limit: 2},
+			wantTopic: []string{"site/a/temp", "site/b/temp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts.Limit == 0 {
+				tt.opts.Limit = 10
+			}
+
+			page, err := repo.List(tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			var got []string
+			for _, topic := range page.Topics {
+				got = append(got, topic.Topic)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.wantTopic, ",") {
+				t.Errorf("List() = %v, want %v", got, tt.wantTopic)
+			}
+		})
+	}
+}
+
+func TestTopicRepository_List_Keyset(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	// Pairs of topics share a last_seen so the id tie-breaker is exercised
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		repo.Upsert(models.Sample{
+			BrokerID:    "test-broker",
+			Topic:       fmt.Sprintf("topic/%d", i),
+			PayloadType: models.PayloadJSON,
+			Payload:     []byte(`{}`),
+			Timestamp:   base.Add(time.Duration(i/2) * time.Minute),
+		})
+	}
+
+	for _, sort := range []SortField{SortLastSeen, SortTopic, SortSize} {
+		t.Run(string(sort), func(t *testing.T) {
+			opts := ListOptions{Sort: sort, Desc: true, Limit: 3, Count: CountNone}
+			seen := map[string]bool{}
+			pages := 0
+
+			for {
+				page, err := repo.List(opts)
+				if err != nil {
+					t.Fatalf("List() error = %v", err)
+				}
+				if page.Total != -1 {
+					t.Errorf("Total = %d, want -1 when count is skipped", page.Total)
+				}
+
+				for _, topic := range page.Topics {
+					if seen[topic.Topic] {
+						t.Errorf("topic %s returned twice", topic.Topic)
+					}
+					seen[topic.Topic] = true
+				}
+				pages++
+
+				if page.NextCursor == nil {
+					break
+				}
+				cursor, err := DecodeCursor(page.NextCursor.Encode())
+				if err != nil {
+					t.Fatalf("DecodeCursor() error = %v", err)
+				}
+				opts.After = cursor
+			}
+
+			if len(seen) != 7 || pages != 3 {
+				t.Errorf("saw %d topics in %d pages, want 7 in 3", len(seen), pages)
+			}
+		})
+	}
+}
+
+func TestTopicRepository_Each(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		repo.Upsert(models.Sample{
+			BrokerID:    fmt.Sprintf("broker%d", i%2),
+			Topic:       fmt.Sprintf("topic/%d", i),
+			PayloadType: models.PayloadText,
+			Payload:     []byte("x"),
+			Timestamp:   base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	var got []string
+	// Paging fields are ignored, every match is visited
+	err := repo.Each(ListOptions{BrokerIDs: []string{"broker0"}, Sort: SortTopic, Limit: 1, Offset: 1}, func(topic models.Topic) error {
+		got = append(got, topic.Topic)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each() error = %v", err)
+	}
+	if strings.Join(got, ",") != "topic/0,topic/2,topic/4" {
+		t.Errorf("Each() visited %v, want topic/0,topic/2,topic/4", got)
+	}
+
+	stop := errors.New("stop")
+	visited := 0
+	err = repo.Each(ListOptions{Desc: true}, func(models.Topic) error {
+		visited++
+		return stop
+	})
+	if !errors.Is(err, stop) || visited != 1 {
+		t.Errorf("Each() = %v after %d topics, want the callback error after 1", err, visited)
+	}
+
+	// Batches span several queries, and no read is open while fn runs, so
+	// writes from the callback go through
+	defer func(n int) { eachBatchSize = n }(eachBatchSize)
+	eachBatchSize = 2
+	got = nil
+	err = repo.Each(ListOptions{Sort: SortTopic}, func(topic models.Topic) error {
+		got = append(got, topic.Topic)
+		return repo.Upsert(models.Sample{
+			BrokerID:    topic.BrokerID,
+			Topic:       topic.Topic,
+			PayloadType: models.PayloadText,
+			Payload:     []byte("y"),
+			Timestamp:   base.Add(time.Hour),
+		})
+	})
+	if err != nil {
+		t.Fatalf("Each() error = %v", err)
+	}
+	if strings.Join(got, ",") != "topic/0,topic/1,topic/2,topic/3,topic/4" {
+		t.Errorf("Each() visited %v, want all 5 topics once", got)
+	}
+}
+
+func TestTopicRepository_EachName(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+	for i := 4; i >= 0; i-- {
+		repo.Upsert(models.Sample{
+			BrokerID:    fmt.Sprintf("broker%d", i%2),
+			Topic:       fmt.Sprintf("topic/%d", i),
+			PayloadType: models.PayloadText,
+			Payload:     []byte("x"),
+			Timestamp:   time.Now(),
+		})
+	}
+
+	defer func(n int) { eachBatchSize = n }(eachBatchSize)
+	eachBatchSize = 2
+
+	var got []string
+	// The sort order of opts is ignored, names come in topic order
+	err := repo.EachName(ListOptions{BrokerIDs: []string{"broker0"}, Sort: SortLastSeen, Desc: true}, func(brokerID, topic string) error {
+		got = append(got, brokerID+":"+topic)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachName() error = %v", err)
+	}
+	if strings.Join(got, ",") != "broker0:topic/0,broker0:topic/2,broker0:topic/4" {
+		t.Errorf("EachName() visited %v", got)
+	}
+}
+
+func TestTopicRepository_List_InvalidCursor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	if _, err := DecodeCursor("not a cursor!"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("DecodeCursor() error = %v, want ErrInvalidCursor", err)
+	}
+
+	cursor := &Cursor{Sort: SortTopic, Desc: true, Value: "a", ID: 1}
+	_, err := repo.List(ListOptions{Sort: SortLastSeen, Desc: true, Limit: 10, After: cursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("List() error = %v, want ErrInvalidCursor for mismatched sort", err)
+	}
+}
+
+func TestTopicRepository_Retention(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	now := time.Now()
+	samples := []struct {
+		broker, topic string
+		age           time.Duration
+	}{
+		{"broker1", "fresh", time.Hour},
+		{"broker1", "old", 10 * 24 * time.Hour},
+		{"broker2", "old", 10 * 24 * time.Hour},
+		{"broker2", "ancient", 40 * 24 * time.Hour},
+	}
+	for _, s := range samples {
+		repo.Upsert(models.Sample{
+			BrokerID:    s.broker,
+			Topic:       s.topic,
+			PayloadType: models.PayloadText,
+			Payload:     []byte("x"),
+			Timestamp:   now.Add(-s.age),
+		})
+	}
+
+	// broker2 only goes stale after 30 days
+	stale := AgeCutoff{
+		Default: now.Add(-7 * 24 * time.Hour),
+		Brokers: map[string]time.Time{"broker2": now.Add(-30 * 24 * time.Hour)},
+	}
+
+	topics, total, err := repo.GetStale(stale, 10, 0)
+	if err != nil {
+		t.Fatalf("GetStale() error = %v", err)
+	}
+	if total != 2 || topics[0].Topic != "ancient" {
+		t.Errorf("GetStale() = %+v (total %d), want ancient and broker1/old", topics, total)
+	}
+
+	page, err := repo.List(ListOptions{LiveAfter: stale, Limit: 10})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if page.Total != 2 {
+		t.Errorf("live topics = %d, want 2", page.Total)
+	}
+
+	// Disabled cutoffs report nothing
+	if _, total, _ := repo.GetStale(AgeCutoff{}, 10, 0); total != 0 {
+		t.Errorf("GetStale() with no cutoff = %d, want 0", total)
+	}
+
+	removed, err := repo.DeleteOlderThan(AgeCutoff{
+		Brokers: map[string]time.Time{"broker2": now.Add(-5 * 24 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("DeleteOlderThan() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+
+	_, total, _ = repo.GetAll(10, 0)
+	if total != 2 {
+		t.Errorf("remaining topics = %d, want 2", total)
+	}
+
+	if _, total, _ := repo.FullTextSearch("x", 10, 0); total != 2 {
+		t.Errorf("search entries after purge = %d, want 2", total)
+	}
+}
+
+func TestTopicRepository_SaveEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+	hub := events.NewHub(16)
+	repo.SetEvents(hub)
+
+	sub, _, _ := hub.Subscribe(0)
+	defer sub.Close()
+
+	samples := []struct {
+		payloadType models.PayloadType
+		payload     string
+		wantType    string
+		wantPrev    models.PayloadType
+	}{
+		{models.PayloadJSON, `{"on":true}`, models.EventTopicCreated, ""},
+		{models.PayloadJSON, `{"on":false}`, models.EventTopicSampleRefreshed, ""},
+		{models.PayloadJSON, `{"on":false,"level":3}`, models.EventTopicSchemaDrift, ""},
+		{models.PayloadText, "off", models.EventTopicPayloadTypeChanged, models.PayloadJSON},
+	}
+
+	for _, s := range samples {
+		err := repo.Upsert(models.Sample{
+			BrokerID:    "test-broker",
+			Topic:       "test/topic",
+			PayloadType: s.payloadType,
+			Payload:     []byte(s.payload),
+			Timestamp:   time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+
+		e := <-sub.C
+		if e.Type != s.wantType || e.PreviousPayloadType != s.wantPrev {
+			t.Errorf("event = %s (previous %q), want %s (previous %q)", e.Type, e.PreviousPayloadType, s.wantType, s.wantPrev)
+		}
+		// Events carry the stored topic without its sample payload
+		if len(e.Topic.SamplePayload) != 0 || e.Topic.PayloadType != s.payloadType {
+			t.Errorf("event topic = %+v, want the stored topic without payload", e.Topic)
+		}
+		if e.Type == models.EventTopicSchemaDrift && (!slices.Equal(e.AddedFields, []string{"level"}) || len(e.RemovedFields) != 0) {
+			t.Errorf("schema drift fields = +%v -%v, want +[level]", e.AddedFields, e.RemovedFields)
+		}
+	}
+
+	// Without listeners for schema drift, changed fields are not compared
+	repo.SetDriftCheck(func() bool { return false })
+	repo.Upsert(models.Sample{
+		BrokerID:    "test-broker",
+		Topic:       "test/topic",
+		PayloadType: models.PayloadText,
+		Payload:     []byte("on"),
+		Timestamp:   time.Now(),
+	})
+	if e := <-sub.C; e.Type != models.EventTopicSampleRefreshed {
+		t.Errorf("event without drift check = %s, want %s", e.Type, models.EventTopicSampleRefreshed)
+	}
+}
+
+func TestTopicRepository_Flags(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewTopicRepository(db)
+
+	for _, s := range []models.Sample{
+		{BrokerID: "broker1", Topic: "crm/contacts", Flags: []string{"phone", "email", "email"}},
+		{BrokerID: "broker1", Topic: "fleet/position", Flags: []string{"gps"}, Redacted: true},
+		{BrokerID: "broker2", Topic: "svc/config", Flags: []string{"credential"}},
+		{BrokerID: "broker1", Topic: "plant/temperature"},
+	} {
+		s.PayloadType, s.Payload, s.Timestamp = models.PayloadJSON, []byte(`{}`), time.Now()
+		if err := repo.Upsert(s); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	topic, _ := repo.GetByBrokerAndTopic("broker1", "crm/contacts")
+	if !slices.Equal(topic.Flags, []string{"email", "phone"}) || topic.Redacted {
+		t.Errorf("stored flags = %v (redacted %v)", topic.Flags, topic.Redacted)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"any flag", ListOptions{Flagged: true}, []string{"crm/contacts", "fleet/position", "svc/config"}},
+		{"one flag", ListOptions{Flags: []string{"gps"}}, []string{"fleet/position"}},
+		{"either flag", ListOptions{Flags: []string{"phone", "credential"}}, []string{"crm/contacts", "svc/config"}},
+		{"flag is matched whole", ListOptions{Flags: []string{"mail"}}, nil},
+		{"flag and broker", ListOptions{Flagged: true, BrokerIDs: []string{"broker2"}}, []string{"svc/config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Sort, tt.opts.Desc, tt.opts.Limit = SortTopic, false, 10
+			page, err := repo.List(tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			var got []string
+			for _, topic := range page.Topics {
+				got = append(got, topic.Topic)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A clean sample clears the flags of its topic
+	if err := repo.Upsert(models.Sample{BrokerID: "broker1", Topic: "fleet/position", PayloadType: models.PayloadJSON, Payload: []byte(`{}`), Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	topic, _ = repo.GetByBrokerAndTopic("broker1", "fleet/position")
+	if len(topic.Flags) != 0 || topic.Redacted {
+		t.Errorf("flags after clean sample = %v (redacted %v)", topic.Flags, topic.Redacted)
+	}
+}
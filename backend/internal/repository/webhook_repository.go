@@ -0,0 +1,456 @@
+// Stores webhook subscriptions and their delivery log
+package repository
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/pkg/models"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	webhookColumns  = "id, url, secret, events, broker_id, topic_filter, active, created_at, updated_at"
+	deliveryColumns = "id, webhook_id, event_id, event_type, broker_id, topic, payload, status, attempts, " +
+		"response_status, error, created_at, next_attempt_at, delivered_at"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// Stores a new webhook and fills in its ID and timestamps
+func (r *WebhookRepository) Create(w *models.Webhook) error {
+	defer metrics.TimeQuery("create_webhook")()
+
+	pattern, err := webhookTopicRegex(w.TopicFilter)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := rebind(`
+		INSERT INTO webhooks (url, secret, events, broker_id, topic_filter, topic_regex, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, isSQLite(r.db))
+	err = r.db.QueryRow(query,
+		w.URL, w.Secret, joinNames(w.Events), w.BrokerID, w.TopicFilter, pattern, w.Active, now, now,
+	).Scan(&w.ID)
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+
+	w.Events = splitNames(joinNames(w.Events))
+	w.CreatedAt, w.UpdatedAt = now, now
+	return nil
+}
+
+// Replaces the fields of an existing webhook, returning false when the ID is
+// unknown. An empty secret keeps the current one
+func (r *WebhookRepository) Update(w *models.Webhook) (bool, error) {
+	defer metrics.TimeQuery("update_webhook")()
+
+	pattern, err := webhookTopicRegex(w.TopicFilter)
+	if err != nil {
+		return false, err
+	}
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+	defer tx.Rollback()
+
+	var secret string
+	err = tx.QueryRow(rebind("SELECT secret, created_at FROM webhooks WHERE id = ?", sqlite), w.ID).Scan(&secret, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+	if w.Secret != "" {
+		secret = w.Secret
+	}
+
+	now := time.Now().UTC()
+	query := rebind(`
+		UPDATE webhooks
+		SET url = ?, secret = ?, events = ?, broker_id = ?, topic_filter = ?, topic_regex = ?, active = ?, updated_at = ?
+		WHERE id = ?
+	`, sqlite)
+	_, err = tx.Exec(query, w.URL, secret, joinNames(w.Events), w.BrokerID, w.TopicFilter, pattern, w.Active, now, w.ID)
+	if err != nil {
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+
+	w.Events = splitNames(joinNames(w.Events))
+	w.UpdatedAt = now
+	return true, nil
+}
+
+// Removes a webhook and its delivery log, returning false when the ID is unknown
+func (r *WebhookRepository) Delete(id int64) (bool, error) {
+	defer metrics.TimeQuery("delete_webhook")()
+
+	sqlite := isSQLite(r.db)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced on SQLite, so deliveries are removed explicitly
+	if _, err := tx.Exec(rebind("DELETE FROM webhook_deliveries WHERE webhook_id = ?", sqlite), id); err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	result, err := tx.Exec(rebind("DELETE FROM webhooks WHERE id = ?", sqlite), id)
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// Finds a webhook by ID including its secret, nil when unknown
+func (r *WebhookRepository) Get(id int64) (*models.Webhook, error) {
+	defer metrics.TimeQuery("get_webhook")()
+
+	query := rebind("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", isSQLite(r.db))
+	rows, err := r.db.Query(query, id)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks, err := scanWebhooks(rows)
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	return &webhooks[0], nil
+}
+
+// Retrieves a page of webhooks ordered by ID, with the total count
+func (r *WebhookRepository) List(limit, offset int) ([]models.Webhook, int, error) {
+	defer metrics.TimeQuery("list_webhooks")()
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM webhooks").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count webhooks: %w", err)
+	}
+
+	query := rebind("SELECT "+webhookColumns+" FROM webhooks ORDER BY id LIMIT ? OFFSET ?", isSQLite(r.db))
+	rows, err := r.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return webhooks, total, nil
+}
+
+// Reports whether an active webhook subscribes to the event type, by naming
+// it or by listing no events
+func (r *WebhookRepository) Subscribed(eventType string) (bool, error) {
+	defer metrics.TimeQuery("webhooks_subscribed")()
+
+	rows, err := r.db.Query(rebind("SELECT events FROM webhooks WHERE active = ?", isSQLite(r.db)), true)
+	if err != nil {
+		return false, fmt.Errorf("query webhook events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var events string
+		if err := rows.Scan(&events); err != nil {
+			return false, fmt.Errorf("scan webhook events: %w", err)
+		}
+		if names := splitNames(events); len(names) == 0 || slices.Contains(names, eventType) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// Returns the active webhooks subscribed to the event's type, broker and
+// topic. Webhooks are few, so filters are matched in memory
+func (r *WebhookRepository) Matching(e models.TopicEvent) ([]models.Webhook, error) {
+	defer metrics.TimeQuery("matching_webhooks")()
+
+	query := rebind("SELECT "+webhookColumns+", topic_regex FROM webhooks WHERE active = ? ORDER BY id", isSQLite(r.db))
+	rows, err := r.db.Query(query, true)
+	if err != nil {
+		return nil, fmt.Errorf("query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var matching []models.Webhook
+	for rows.Next() {
+		var pattern string
+		w, err := scanWebhook(rows, &pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(w.Events) > 0 && !slices.Contains(w.Events, e.Type) {
+			continue
+		}
+		if w.BrokerID != "" && w.BrokerID != e.Topic.BrokerID {
+			continue
+		}
+		if pattern != "" {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %d: %w", w.ID, err)
+			}
+			if !re.MatchString(e.Topic.Topic) {
+				continue
+			}
+		}
+		matching = append(matching, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+	return matching, nil
+}
+
+// Adds a delivery to the log and fills in its ID
+func (r *WebhookRepository) CreateDelivery(d *models.WebhookDelivery) error {
+	defer metrics.TimeQuery("create_webhook_delivery")()
+
+	query := rebind(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, broker_id, topic, payload, status, attempts,
+			response_status, error, created_at, next_attempt_at, delivered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, isSQLite(r.db))
+	err := r.db.QueryRow(query,
+		d.WebhookID, int64(d.EventID), d.EventType, d.BrokerID, d.Topic, d.Payload, d.Status, d.Attempts,
+		d.ResponseStatus, d.Error, d.CreatedAt.UTC(), utcOrNil(d.NextAttemptAt), utcOrNil(d.DeliveredAt),
+	).Scan(&d.ID)
+	if err != nil {
+		return fmt.Errorf("create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Adds a missed delivery after the event ID to the log of every active
+// webhook, recording that the events following it were not delivered, and
+// returns how many webhooks got one
+func (r *WebhookRepository) RecordMissed(afterID uint64, reason string, at time.Time) (int64, error) {
+	defer metrics.TimeQuery("record_missed_webhook_deliveries")()
+
+	query := rebind(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, broker_id, topic, payload, status, error, created_at)
+		SELECT id, ?, ?, '', '', ?, ?, ?, ? FROM webhooks WHERE active = ?
+	`, isSQLite(r.db))
+	result, err := r.db.Exec(query, int64(afterID), models.EventsMissed, []byte{}, models.DeliveryMissed, reason, at.UTC(), true)
+	if err != nil {
+		return 0, fmt.Errorf("record missed webhook deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Stores the outcome of a delivery attempt
+func (r *WebhookRepository) UpdateDelivery(d *models.WebhookDelivery) error {
+	defer metrics.TimeQuery("update_webhook_delivery")()
+
+	query := rebind(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_status = ?, error = ?, next_attempt_at = ?, delivered_at = ?, claimed_until = NULL
+		WHERE id = ?
+	`, isSQLite(r.db))
+	_, err := r.db.Exec(query,
+		d.Status, d.Attempts, d.ResponseStatus, d.Error, utcOrNil(d.NextAttemptAt), utcOrNil(d.DeliveredAt), d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Claims up to limit pending deliveries whose next attempt is due and that
+// nobody else claimed, until the given time, and returns them oldest first.
+// The claim is a single UPDATE, so server instances sharing the database
+// never send the same delivery at once; UpdateDelivery clears it
+func (r *WebhookRepository) DueDeliveries(now, claimUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	defer metrics.TimeQuery("due_webhook_deliveries")()
+
+	sqlite := isSQLite(r.db)
+	due := "status = ? AND next_attempt_at <= ? AND (claimed_until IS NULL OR claimed_until < ?)"
+	// Postgres skips rows another instance is claiming instead of waiting
+	lock := " FOR UPDATE SKIP LOCKED"
+	if sqlite {
+		lock = ""
+	}
+
+	query := rebind(`
+		UPDATE webhook_deliveries SET claimed_until = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE `+due+` ORDER BY next_attempt_at, id LIMIT ?`+lock+`
+		) AND `+due+`
+		RETURNING `+deliveryColumns, sqlite)
+	rows, err := r.db.Query(query, claimUntil.UTC(),
+		models.DeliveryPending, now.UTC(), now.UTC(), limit,
+		models.DeliveryPending, now.UTC(), now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("claim due deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the subquery's order
+	slices.SortFunc(deliveries, func(a, b models.WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(*b.NextAttemptAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return deliveries, nil
+}
+
+// Retrieves a page of a webhook's deliveries, newest first, optionally only
+// those with the given status
+func (r *WebhookRepository) ListDeliveries(webhookID int64, status string, limit, offset int) ([]models.WebhookDelivery, int, error) {
+	defer metrics.TimeQuery("list_webhook_deliveries")()
+
+	sqlite := isSQLite(r.db)
+	var where whereClause
+	where.add("webhook_id = ?", webhookID)
+	if status != "" {
+		where.add("status = ?", status)
+	}
+
+	var total int
+	count := rebind("SELECT COUNT(*) FROM webhook_deliveries"+where.String(), sqlite)
+	if err := r.db.QueryRow(count, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count webhook deliveries: %w", err)
+	}
+
+	query := rebind("SELECT "+deliveryColumns+" FROM webhook_deliveries"+where.String()+
+		" ORDER BY id DESC LIMIT ? OFFSET ?", sqlite)
+	rows, err := r.db.Query(query, append(where.args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// Deletes finished deliveries created before the cutoff and returns how many
+// were removed; pending ones stay until they succeed or fail
+func (r *WebhookRepository) PurgeDeliveries(before time.Time) (int64, error) {
+	defer metrics.TimeQuery("purge_webhook_deliveries")()
+
+	query := rebind("DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?", isSQLite(r.db))
+	result, err := r.db.Exec(query, models.DeliveryPending, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("purge webhook deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Compiles an optional topic filter; an empty filter matches every topic
+func webhookTopicRegex(filter string) (string, error) {
+	if filter == "" {
+		return "", nil
+	}
+	return TopicFilterRegex(filter)
+}
+
+func utcOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func scanWebhooks(rows *sql.Rows) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// Scans a row selected with webhookColumns followed by the extra columns
+func scanWebhook(rows *sql.Rows, extra ...any) (models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	dest := append([]any{
+		&w.ID, &w.URL, &w.Secret, &events, &w.BrokerID, &w.TopicFilter, &w.Active, &w.CreatedAt, &w.UpdatedAt,
+	}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return w, fmt.Errorf("scan webhook: %w", err)
+	}
+	w.Events = splitNames(events)
+	return w, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var eventID int64
+		var next, delivered sql.NullTime
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &eventID, &d.EventType, &d.BrokerID, &d.Topic, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.Error, &d.CreatedAt, &next, &delivered,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		d.EventID = uint64(eventID)
+		if next.Valid {
+			d.NextAttemptAt = &next.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"mqtt-catalog/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWebhookRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	w := models.Webhook{
+		URL:         "https://hooks.example.com/catalog",
+		Secret:      "whsec_first",
+		Events:      []string{models.EventTopicCreated, models.EventTopicCreated, models.EventTopicStale},
+		BrokerID:    "broker1",
+		TopicFilter: "plant1/#",
+		Active:      true,
+	}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if w.ID == 0 || !slices.Equal(w.Events, []string{models.EventTopicCreated, models.EventTopicStale}) {
+		t.Errorf("unexpected created webhook %+v", w)
+	}
+
+	invalid := models.Webhook{URL: "https://hooks.example.com", TopicFilter: "plant1/#/x"}
+	if err := repo.Create(&invalid); err == nil {
+		t.Error("Create() with invalid topic filter succeeded")
+	}
+
+	// An empty secret keeps the stored one
+	w.Secret = ""
+	w.Active = false
+	found, err := repo.Update(&w)
+	if err != nil || !found {
+		t.Fatalf("Update() = %v, %v", found, err)
+	}
+	got, err := repo.Get(w.ID)
+	if err != nil || got == nil {
+		t.Fatalf("Get() = %v, %v", got, err)
+	}
+	if got.Secret != "whsec_first" || got.Active {
+		t.Errorf("after Update() got %+v", got)
+	}
+
+	missing := models.Webhook{ID: w.ID + 100, URL: "https://hooks.example.com"}
+	if found, err := repo.Update(&missing); err != nil || found {
+		t.Errorf("Update() unknown = %v, %v", found, err)
+	}
+
+	webhooks, total, err := repo.List(10, 0)
+	if err != nil || total != 1 || len(webhooks) != 1 {
+		t.Fatalf("List() = %v, %d, %v", webhooks, total, err)
+	}
+
+	d := models.WebhookDelivery{
+		WebhookID: w.ID, EventID: 1, EventType: models.EventTopicCreated, Status: models.DeliveryPending,
+		Payload: []byte(`{}`), CreatedAt: time.Now(),
+	}
+	if err := repo.CreateDelivery(&d); err != nil {
+		t.Fatalf("CreateDelivery() error = %v", err)
+	}
+
+	deleted, err := repo.Delete(w.ID)
+	if err != nil || !deleted {
+		t.Fatalf("Delete() = %v, %v", deleted, err)
+	}
+	if got, _ := repo.Get(w.ID); got != nil {
+		t.Errorf("Get() after Delete() = %+v", got)
+	}
+	if deliveries, total, _ := repo.ListDeliveries(w.ID, "", 10, 0); total != 0 || len(deliveries) != 0 {
+		t.Errorf("deliveries survived Delete(): %v", deliveries)
+	}
+	if deleted, err := repo.Delete(w.ID); err != nil || deleted {
+		t.Errorf("Delete() twice = %v, %v", deleted, err)
+	}
+}
+
+func TestWebhookRepository_Matching(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+	for _, w := range []models.Webhook{
+		{URL: "https://a.example.com", Active: true},
+		{URL: "https://b.example.com", Active: true, Events: []string{models.EventTopicPayloadTypeChanged}},
+		{URL: "https://c.example.com", Active: true, BrokerID: "broker2"},
+		{URL: "https://d.example.com", Active: true, TopicFilter: "plant1/+/temperature"},
+		{URL: "https://e.example.com", Active: false},
+	} {
+		if err := repo.Create(&w); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		event models.TopicEvent
+		want  []string
+	}{
+		{
+			name:  "created on broker1",
+			event: models.TopicEvent{Type: models.EventTopicCreated, Topic: models.Topic{BrokerID: "broker1", Topic: "plant1/line1/temperature"}},
+			want:  []string{"https://a.example.com", "https://d.example.com"},
+		},
+		{
+			name:  "type change on broker2",
+			event: models.TopicEvent{Type: models.EventTopicPayloadTypeChanged, Topic: models.Topic{BrokerID: "broker2", Topic: "plant2/status"}},
+			want:  []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhooks, err := repo.Matching(tt.event)
+			if err != nil {
+				t.Fatalf("Matching() error = %v", err)
+			}
+			var got []string
+			for _, w := range webhooks {
+				got = append(got, w.URL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Matching() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRepository_Subscribed(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+	for _, w := range []models.Webhook{
+		{URL: "https://a.example.com", Secret: "s", Active: true, Events: []string{models.EventTopicCreated}},
+		{URL: "https://b.example.com", Secret: "s", Active: false},
+	} {
+		if err := repo.Create(&w); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	if ok, err := repo.Subscribed(models.EventTopicSchemaDrift); err != nil || ok {
+		t.Errorf("Subscribed(schema_drift) = %v, %v, want false", ok, err)
+	}
+	if ok, err := repo.Subscribed(models.EventTopicCreated); err != nil || !ok {
+		t.Errorf("Subscribed(created) = %v, %v, want true", ok, err)
+	}
+
+	// Listing no events subscribes to all of them
+	if err := repo.Create(&models.Webhook{URL: "https://c.example.com", Secret: "s", Active: true}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if ok, err := repo.Subscribed(models.EventTopicSchemaDrift); err != nil || !ok {
+		t.Errorf("Subscribed(schema_drift) with a catch-all webhook = %v, %v, want true", ok, err)
+	}
+}
+
+func TestWebhookRepository_Deliveries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+	w := models.Webhook{URL: "https://hooks.example.com", Secret: "s", Active: true}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	now := time.Now().UTC()
+	due, later := now.Add(-time.Minute), now.Add(time.Hour)
+	old := now.Add(-48 * time.Hour)
+	deliveries := []models.WebhookDelivery{
+		{EventID: 1, Status: models.DeliveryPending, NextAttemptAt: &due, CreatedAt: now},
+		{EventID: 2, Status: models.DeliveryPending, NextAttemptAt: &later, CreatedAt: now},
+		{EventID: 3, Status: models.DeliverySucceeded, DeliveredAt: &old, CreatedAt: old},
+		{EventID: 4, Status: models.DeliveryFailed, CreatedAt: now},
+	}
+	for i := range deliveries {
+		deliveries[i].WebhookID = w.ID
+		deliveries[i].EventType = models.EventTopicCreated
+		deliveries[i].Payload = []byte(`{"id":1}`)
+		if err := repo.CreateDelivery(&deliveries[i]); err != nil {
+			t.Fatalf("CreateDelivery() error = %v", err)
+		}
+	}
+
+	claimUntil := now.Add(time.Minute)
+	got, err := repo.DueDeliveries(now, claimUntil, 10)
+	if err != nil || len(got) != 1 || got[0].EventID != 1 || string(got[0].Payload) != `{"id":1}` {
+		t.Fatalf("DueDeliveries() = %+v, %v", got, err)
+	}
+	// Claimed deliveries are not handed out again until the claim runs out
+	if again, _ := repo.DueDeliveries(now, claimUntil, 10); len(again) != 0 {
+		t.Errorf("DueDeliveries() while claimed = %+v", again)
+	}
+	if again, _ := repo.DueDeliveries(claimUntil.Add(time.Second), claimUntil.Add(time.Hour), 10); len(again) != 1 {
+		t.Errorf("DueDeliveries() after the claim ran out = %+v, want the delivery", again)
+	}
+
+	got[0].Status = models.DeliverySucceeded
+	got[0].Attempts = 1
+	got[0].ResponseStatus = 204
+	got[0].NextAttemptAt = nil
+	got[0].DeliveredAt = &now
+	if err := repo.UpdateDelivery(&got[0]); err != nil {
+		t.Fatalf("UpdateDelivery() error = %v", err)
+	}
+	if due, _ := repo.DueDeliveries(later.Add(time.Hour), later.Add(2*time.Hour), 10); len(due) != 1 || due[0].EventID != 2 {
+		t.Errorf("DueDeliveries() after success = %+v, want only the later delivery", due)
+	}
+
+	listed, total, err := repo.ListDeliveries(w.ID, models.DeliverySucceeded, 10, 0)
+	if err != nil || total != 2 || listed[0].EventID != 3 || listed[1].DeliveredAt == nil {
+		t.Errorf("ListDeliveries(succeeded) = %+v, %d, %v", listed, total, err)
+	}
+
+	// Gaps are logged for active webhooks only and never sent
+	inactive := models.Webhook{URL: "https://other.example.com", Secret: "s"}
+	if err := repo.Create(&inactive); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if n, err := repo.RecordMissed(4, "events after 4 were dropped", now); err != nil || n != 1 {
+		t.Fatalf("RecordMissed() = %d, %v, want 1", n, err)
+	}
+	missed, total, err := repo.ListDeliveries(w.ID, models.DeliveryMissed, 10, 0)
+	if err != nil || total != 1 || missed[0].EventID != 4 || missed[0].EventType != models.EventsMissed || missed[0].Error == "" {
+		t.Errorf("ListDeliveries(missed) = %+v, %d, %v", missed, total, err)
+	}
+	if due, _ := repo.DueDeliveries(later.Add(3*time.Hour), later.Add(4*time.Hour), 10); len(due) != 1 || due[0].EventID != 2 {
+		t.Errorf("DueDeliveries() with a missed delivery = %+v, want only the later delivery", due)
+	}
+
+	purged, err := repo.PurgeDeliveries(now.Add(-24 * time.Hour))
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeDeliveries() = %d, %v, want 1", purged, err)
+	}
+	if _, total, _ := repo.ListDeliveries(w.ID, "", 10, 0); total != 4 {
+		t.Errorf("ListDeliveries() total after purge = %d, want 4", total)
+	}
+}
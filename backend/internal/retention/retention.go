@@ -0,0 +1,140 @@
+// Applies the catalog retention policy: stale topic cutoffs and the
+// scheduled purge of topics that stopped publishing
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/events"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Returns the last_seen cutoffs after which topics count as stale
+func StaleCutoff(cfg config.RetentionConfig, now time.Time) repository.AgeCutoff {
+	return cutoff(cfg, now, func(p config.RetentionPolicy) int { return p.StaleAfterDays })
+}
+
+// Returns the last_seen cutoffs after which topics are deleted
+func PurgeCutoff(cfg config.RetentionConfig, now time.Time) repository.AgeCutoff {
+	return cutoff(cfg, now, func(p config.RetentionPolicy) int { return p.PurgeAfterDays })
+}
+
+func cutoff(cfg config.RetentionConfig, now time.Time, days func(config.RetentionPolicy) int) repository.AgeCutoff {
+	at := func(d int) time.Time {
+		if d <= 0 {
+			return time.Time{}
+		}
+		return now.Add(-time.Duration(d) * day)
+	}
+
+	c := repository.AgeCutoff{Default: at(days(cfg.Default))}
+	if len(cfg.Brokers) > 0 {
+		c.Brokers = make(map[string]time.Time, len(cfg.Brokers))
+		for id := range cfg.Brokers {
+			c.Brokers[id] = at(days(cfg.PolicyFor(id)))
+		}
+	}
+	return c
+}
+
+// Periodically deletes topics past their purge cutoff
+type Purger struct {
+	repo *repository.TopicRepository
+	cfg  config.RetentionConfig
+}
+
+func NewPurger(repo *repository.TopicRepository, cfg config.RetentionConfig) *Purger {
+	return &Purger{repo: repo, cfg: cfg}
+}
+
+// Reports whether any broker has a purge policy configured
+func (p *Purger) Enabled() bool {
+	return !PurgeCutoff(p.cfg, time.Now()).IsZero()
+}
+
+// Runs a purge immediately and then every purge interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		p.PurgeOnce()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Deletes expired topics once and returns how many were removed
+func (p *Purger) PurgeOnce() int64 {
+	removed, err := p.repo.DeleteOlderThan(PurgeCutoff(p.cfg, time.Now()))
+	if err != nil {
+		slog.Error("Retention purge failed", "error", err)
+		return 0
+	}
+
+	slog.Info("Retention purge completed", "removed", removed)
+	return removed
+}
+
+// Periodically publishes topic.stale events for topics that crossed their
+// broker's stale cutoff since the previous check
+type StaleWatcher struct {
+	repo *repository.TopicRepository
+	hub  *events.Hub
+	cfg  config.RetentionConfig
+}
+
+func NewStaleWatcher(repo *repository.TopicRepository, hub *events.Hub, cfg config.RetentionConfig) *StaleWatcher {
+	return &StaleWatcher{repo: repo, hub: hub, cfg: cfg}
+}
+
+// Reports whether any broker has a stale threshold configured
+func (s *StaleWatcher) Enabled() bool {
+	return s.hub != nil && !StaleCutoff(s.cfg, time.Now()).IsZero()
+}
+
+// Checks every stale check interval until ctx is done. The first check
+// covers topics that went stale during the interval before it started
+func (s *StaleWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.StaleCheckInterval)
+	defer ticker.Stop()
+
+	since := time.Now().Add(-s.cfg.StaleCheckInterval)
+	for {
+		select {
+		case now := <-ticker.C:
+			s.CheckOnce(since, now)
+			since = now
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Publishes an event for every topic whose stale cutoff fell between since
+// and now, returning how many were published
+func (s *StaleWatcher) CheckOnce(since, now time.Time) int {
+	published := 0
+	err := s.repo.Each(repository.ListOptions{
+		LiveAfter:   StaleCutoff(s.cfg, since),
+		StaleBefore: StaleCutoff(s.cfg, now),
+		Sort:        repository.SortLastSeen,
+	}, func(topic models.Topic) error {
+		s.hub.Publish(models.TopicEvent{Type: models.EventTopicStale, Topic: topic})
+		published++
+		return nil
+	})
+	if err != nil {
+		slog.Error("Stale topic check failed", "error", err)
+	}
+	return published
+}
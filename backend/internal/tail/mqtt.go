@@ -0,0 +1,51 @@
+package tail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mqtt-catalog/internal/collector"
+	"mqtt-catalog/internal/config"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Subscribes with a dedicated MQTT connection per session, using the same
+// connection settings as the collector
+type MQTTSource struct{}
+
+func (MQTTSource) Subscribe(broker config.BrokerConfig, filter string, deliver func(Message)) (func(), error) {
+	opts := collector.ClientOptions(broker.URL, tailClientID(broker.ClientID), broker.Username, broker.Password)
+	client := mqtt.NewClient(opts)
+
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, fmt.Errorf("connect error: %w", token.Error())
+	}
+
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		deliver(Message{
+			Topic:    msg.Topic(),
+			Payload:  msg.Payload(),
+			Retained: msg.Retained(),
+			Time:     time.Now(),
+		})
+	}
+	if token := client.Subscribe(filter, 0, handler); token.Wait() && token.Error() != nil {
+		client.Disconnect(250)
+		return nil, fmt.Errorf("subscribe error: %w", token.Error())
+	}
+
+	return func() { client.Disconnect(250) }, nil
+}
+
+// Derives a unique client ID so a tail session never takes over the
+// collector's session on the broker
+func tailClientID(base string) string {
+	if base == "" {
+		base = "mqtt-catalog"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return base + "-tail-" + hex.EncodeToString(suffix)
+}
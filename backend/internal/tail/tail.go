@@ -0,0 +1,225 @@
+// Streams live broker traffic for a topic filter to API clients, capped in
+// rate and duration so an inspection cannot turn into a permanent firehose
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/payload"
+	"mqtt-catalog/pkg/models"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Messages buffered between the broker client and the session
+	queueSize = 256
+	// How often messages dropped by the rate cap are reported
+	dropReportInterval = time.Second
+)
+
+// Reasons sent in the closed event
+const (
+	ReasonIdle            = "idle_timeout"
+	ReasonMaxDuration     = "max_duration"
+	ReasonSubscribeFailed = "subscribe_failed"
+)
+
+var ErrTooManySessions = errors.New("too many tail sessions")
+
+// A message received from the broker
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+	Time     time.Time
+}
+
+// Opens a subscription on a broker and calls deliver for each message until
+// stop is called. deliver must not block
+type Source interface {
+	Subscribe(broker config.BrokerConfig, filter string, deliver func(Message)) (stop func(), err error)
+}
+
+type Tailer struct {
+	cfg config.TailConfig
+	// Payloads longer than maxPayload are cut, 0 disables the cap
+	maxPayload int
+	// scanner flags and redacts payloads before they reach the client,
+	// nil sends them as received
+	scanner *payload.Scanner
+	source  Source
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sessions int
+}
+
+func NewTailer(cfg config.TailConfig, maxPayload int, source Source) *Tailer {
+	return &Tailer{
+		cfg:        cfg,
+		maxPayload: maxPayload,
+		source:     source,
+		now:        time.Now,
+	}
+}
+
+// Scans every tailed payload, redacting findings when the scanner is
+// configured to
+func (t *Tailer) SetScanner(s *payload.Scanner) {
+	t.scanner = s
+}
+
+// Returns the configured broker with the given ID
+func (t *Tailer) Broker(id string) (config.BrokerConfig, bool) {
+	return t.cfg.Broker(id)
+}
+
+// Reserves a session slot, call release once the session has ended
+func (t *Tailer) Acquire() (release func(), err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sessions >= t.cfg.MaxSessions {
+		return nil, ErrTooManySessions
+	}
+	t.sessions++
+	metrics.TailSessions.Inc()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.sessions--
+			t.mu.Unlock()
+			metrics.TailSessions.Dec()
+		})
+	}, nil
+}
+
+// Subscribes to filter on broker and passes decoded messages to send until
+// the session idles out, reaches its maximum duration, ctx is cancelled or
+// send fails. Every end except a cancelled ctx or failed send is announced
+// with a closed event
+func (t *Tailer) Run(ctx context.Context, broker config.BrokerConfig, filter string, send func(models.TailEvent) error) error {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.MaxDuration)
+	defer cancel()
+
+	queue := make(chan Message, queueSize)
+	var overflow atomic.Int64
+	stop, err := t.source.Subscribe(broker, filter, func(m Message) {
+		select {
+		case queue <- m:
+		default:
+			overflow.Add(1)
+		}
+	})
+	if err != nil {
+		send(t.closed(ReasonSubscribeFailed))
+		return fmt.Errorf("subscribe to %s on %s: %w", filter, broker.ID, err)
+	}
+	defer stop()
+
+	idle := time.NewTimer(t.cfg.IdleTimeout)
+	defer idle.Stop()
+	report := time.NewTicker(dropReportInterval)
+	defer report.Stop()
+
+	bucket := newBucket(t.cfg.MessagesPerSecond, t.cfg.Burst, t.now())
+	dropped := 0
+
+	for {
+		select {
+		case m := <-queue:
+			idle.Reset(t.cfg.IdleTimeout)
+			if !bucket.take(t.now()) {
+				dropped++
+				continue
+			}
+			if err := send(t.decode(m)); err != nil {
+				return err
+			}
+
+		case <-report.C:
+			dropped += int(overflow.Swap(0))
+			if dropped == 0 {
+				continue
+			}
+			metrics.TailMessagesDropped.Add(float64(dropped))
+			if err := send(models.TailEvent{Type: models.TailDropped, Time: t.now().UTC(), Dropped: dropped}); err != nil {
+				return err
+			}
+			dropped = 0
+
+		case <-idle.C:
+			return send(t.closed(ReasonIdle))
+
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return send(t.closed(ReasonMaxDuration))
+			}
+			return nil
+		}
+	}
+}
+
+func (t *Tailer) closed(reason string) models.TailEvent {
+	return models.TailEvent{Type: models.TailClosed, Time: t.now().UTC(), Reason: reason}
+}
+
+// Classifies, scans and encodes the payload as text or base64 for the
+// client. The whole payload is scanned before it is cut so a secret
+// straddling the cut is still found
+func (t *Tailer) decode(m Message) models.TailEvent {
+	e := models.TailEvent{
+		Type:        models.TailMessage,
+		Time:        m.Time.UTC(),
+		Topic:       m.Topic,
+		PayloadType: payload.DetectType(m.Payload),
+		Retained:    m.Retained,
+	}
+
+	data := m.Payload
+	if t.scanner != nil {
+		sample := models.Sample{PayloadType: e.PayloadType, Payload: data}
+		t.scanner.Apply(&sample)
+		data, e.Flags, e.Redacted = sample.Payload, sample.Flags, sample.Redacted
+	}
+	if t.maxPayload > 0 && len(data) > t.maxPayload {
+		data = payload.Truncate(data, e.PayloadType, t.maxPayload)
+		e.Truncated = true
+	}
+	if e.PayloadType == models.PayloadBinary {
+		e.PayloadBase64 = data
+	} else {
+		e.Payload = string(data)
+	}
+	return e
+}
+
+// Token bucket for a single session, only used from its Run loop
+type bucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	updated time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), updated: now}
+}
+
+func (b *bucket) take(now time.Time) bool {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,195 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/payload"
+	"mqtt-catalog/pkg/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Delivers the given messages once subscribed and records the filter
+type fakeSource struct {
+	messages []Message
+	err      error
+	filter   string
+	stopped  bool
+}
+
+func (f *fakeSource) Subscribe(broker config.BrokerConfig, filter string, deliver func(Message)) (func(), error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.filter = filter
+	for _, m := range f.messages {
+		deliver(m)
+	}
+	return func() { f.stopped = true }, nil
+}
+
+func testConfig() config.TailConfig {
+	return config.TailConfig{
+		Brokers:           []config.BrokerConfig{{ID: "broker1", URL: "tcp://localhost:1883"}},
+		MessagesPerSecond: 1000,
+		Burst:             100,
+		IdleTimeout:       50 * time.Millisecond,
+		MaxDuration:       time.Minute,
+		MaxSessions:       1,
+	}
+}
+
+func collect(t *testing.T, tailer *Tailer, ctx context.Context) ([]models.TailEvent, error) {
+	t.Helper()
+	var events []models.TailEvent
+	err := tailer.Run(ctx, config.BrokerConfig{ID: "broker1"}, "plant1/#", func(e models.TailEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+func TestTailer_Run(t *testing.T) {
+	source := &fakeSource{messages: []Message{
+		{Topic: "plant1/temp", Payload: []byte(`{"t": 21}`), Time: time.Now()},
+		{Topic: "plant1/raw", Payload: []byte{0x00, 0xff, 0x10}, Retained: true, Time: time.Now()},
+		{Topic: "plant1/log", Payload: []byte("a long log line"), Time: time.Now()},
+	}}
+	tailer := NewTailer(testConfig(), 6, source)
+
+	events, err := collect(t, tailer, context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if source.filter != "plant1/#" || !source.stopped {
+		t.Errorf("expected subscription to plant1/# to be stopped, got filter %q stopped %v", source.filter, source.stopped)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 3 messages and a closed event: %+v", len(events), events)
+	}
+
+	if e := events[0]; e.PayloadType != models.PayloadJSON || e.Payload != `{"t": ` || !e.Truncated {
+		t.Errorf("json event = %+v, want truncated JSON text", e)
+	}
+	if e := events[1]; e.PayloadType != models.PayloadBinary || len(e.PayloadBase64) != 3 || e.Payload != "" || !e.Retained {
+		t.Errorf("binary event = %+v, want retained base64 payload", e)
+	}
+	if e := events[2]; e.PayloadType != models.PayloadText || e.Payload != "a long" {
+		t.Errorf("text event = %+v, want truncated text", e)
+	}
+	if e := events[3]; e.Type != models.TailClosed || e.Reason != ReasonIdle {
+		t.Errorf("last event = %+v, want closed for %s", e, ReasonIdle)
+	}
+}
+
+func TestTailer_Redact(t *testing.T) {
+	source := &fakeSource{messages: []Message{
+		{Topic: "plant1/config", Payload: []byte(`{"user": "ops", "password": "hunter2secret"}`), Time: time.Now()},
+	}}
+	// The secret lies past the cut, it is still found and redacted
+	tailer := NewTailer(testConfig(), 30, source)
+	tailer.SetScanner(payload.NewScanner(config.ScanConfig{Enabled: true, Redact: true, Detectors: []string{"credential"}}))
+
+	events, err := collect(t, tailer, context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	e := events[0]
+	if !e.Redacted || !slices.Equal(e.Flags, []string{"credential"}) || strings.Contains(e.Payload, "hunter2") {
+		t.Errorf("event = %+v, want redacted credential", e)
+	}
+}
+
+func TestTailer_RateCap(t *testing.T) {
+	var messages []Message
+	for i := 0; i < 5; i++ {
+		messages = append(messages, Message{Topic: "plant1/temp", Payload: []byte("1"), Time: time.Now()})
+	}
+
+	cfg := testConfig()
+	cfg.MessagesPerSecond = 0.001
+	cfg.Burst = 2
+	cfg.IdleTimeout = 2 * dropReportInterval
+	tailer := NewTailer(cfg, 0, &fakeSource{messages: messages})
+
+	events, err := collect(t, tailer, context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var forwarded, dropped int
+	for _, e := range events {
+		switch e.Type {
+		case models.TailMessage:
+			forwarded++
+		case models.TailDropped:
+			dropped += e.Dropped
+		}
+	}
+	if forwarded != 2 || dropped != 3 {
+		t.Errorf("forwarded %d and dropped %d, want 2 and 3", forwarded, dropped)
+	}
+}
+
+func TestTailer_MaxDuration(t *testing.T) {
+	cfg := testConfig()
+	cfg.IdleTimeout = time.Minute
+	cfg.MaxDuration = 20 * time.Millisecond
+	tailer := NewTailer(cfg, 0, &fakeSource{})
+
+	events, err := collect(t, tailer, context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Reason != ReasonMaxDuration {
+		t.Errorf("events = %+v, want a single closed event for %s", events, ReasonMaxDuration)
+	}
+}
+
+func TestTailer_ClientGone(t *testing.T) {
+	cfg := testConfig()
+	cfg.IdleTimeout = time.Minute
+	tailer := NewTailer(cfg, 0, &fakeSource{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	events, err := collect(t, tailer, ctx)
+	if err != nil || len(events) != 0 {
+		t.Errorf("Run() = %+v, %v, want no events and no error", events, err)
+	}
+}
+
+func TestTailer_SubscribeError(t *testing.T) {
+	tailer := NewTailer(testConfig(), 0, &fakeSource{err: errors.New("not authorized")})
+
+	events, err := collect(t, tailer, context.Background())
+	if err == nil {
+		t.Fatal("expected subscribe error")
+	}
+	if len(events) != 1 || events[0].Reason != ReasonSubscribeFailed {
+		t.Errorf("events = %+v, want a closed event for %s", events, ReasonSubscribeFailed)
+	}
+}
+
+func TestTailer_Acquire(t *testing.T) {
+	tailer := NewTailer(testConfig(), 0, &fakeSource{})
+
+	release, err := tailer.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := tailer.Acquire(); !errors.Is(err, ErrTooManySessions) {
+		t.Errorf("second Acquire() error = %v, want %v", err, ErrTooManySessions)
+	}
+
+	release()
+	release()
+	again, err := tailer.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+	again()
+}
@@ -0,0 +1,370 @@
+// Delivers topic events to webhook subscriptions as signed HTTP requests,
+// retrying failed deliveries with exponential backoff
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/events"
+	"mqtt-catalog/internal/metrics"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// How often due retries are looked for when no new event arrives
+	pollInterval  = time.Second
+	purgeInterval = time.Hour
+	// Deliveries sent per poll
+	batchSize = 100
+	// Delay before resubscribing after the hub dropped the dispatcher
+	resubscribeDelay = time.Second
+	day              = 24 * time.Hour
+)
+
+// Event types a webhook can subscribe to
+var Events = []string{
+	models.EventTopicCreated,
+	models.EventTopicPayloadTypeChanged,
+	models.EventTopicSchemaDrift,
+	models.EventTopicStale,
+}
+
+type Dispatcher struct {
+	repo   *repository.WebhookRepository
+	cfg    config.WebhookConfig
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+func NewDispatcher(repo *repository.WebhookRepository, cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// Records a delivery for every event published on the hub and sends due
+// deliveries until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, hub *events.Hub) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.send(ctx)
+	}()
+
+	d.consume(ctx, hub)
+	wg.Wait()
+}
+
+// Follows the hub, resuming from the last seen event when it drops the
+// dispatcher for falling behind, until ctx is done or the hub is closed
+func (d *Dispatcher) consume(ctx context.Context, hub *events.Hub) {
+	var lastID uint64
+	for {
+		if hub.Closed() {
+			return
+		}
+		sub, backlog, complete := hub.Subscribe(lastID)
+		if !complete {
+			d.recordMissed(lastID)
+		}
+		for _, e := range backlog {
+			d.Enqueue(e)
+			lastID = e.ID
+		}
+
+	receive:
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					break receive
+				}
+				d.Enqueue(e)
+				lastID = e.ID
+			case <-ctx.Done():
+				// Events already queued are still recorded
+				sub.Close()
+				for e := range sub.C {
+					d.Enqueue(e)
+				}
+				return
+			}
+		}
+
+		if hub.Closed() {
+			return
+		}
+		select {
+		case <-time.After(resubscribeDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Puts a missed delivery into every active webhook's log when the hub no
+// longer holds the events after lastID, so the gap shows up in the log
+func (d *Dispatcher) recordMissed(lastID uint64) {
+	slog.Warn("Webhook dispatcher missed events", "after_id", lastID)
+	reason := fmt.Sprintf("events after %d were dropped before the dispatcher recorded them", lastID)
+	if _, err := d.repo.RecordMissed(lastID, reason, d.now()); err != nil {
+		slog.Error("Failed to record missed webhook deliveries", "after_id", lastID, "error", err)
+	}
+}
+
+// Records a pending delivery of the event for every matching webhook
+func (d *Dispatcher) Enqueue(e models.TopicEvent) {
+	if e.Type == models.EventTopicSampleRefreshed {
+		return
+	}
+
+	webhooks, err := d.repo.Matching(e)
+	if err != nil {
+		slog.Error("Failed to match webhooks", "event_id", e.ID, "error", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode webhook event", "event_id", e.ID, "error", err)
+		return
+	}
+
+	now := d.now().UTC()
+	for _, w := range webhooks {
+		delivery := models.WebhookDelivery{
+			WebhookID:     w.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			BrokerID:      e.Topic.BrokerID,
+			Topic:         e.Topic.Topic,
+			Payload:       body,
+			Status:        models.DeliveryPending,
+			CreatedAt:     now,
+			NextAttemptAt: &now,
+		}
+		if err := d.repo.CreateDelivery(&delivery); err != nil {
+			slog.Error("Failed to record webhook delivery", "webhook_id", w.ID, "event_id", e.ID, "error", err)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+
+	d.PurgeOnce()
+	for {
+		select {
+		case <-poll.C:
+		case <-d.wake:
+		case <-purge.C:
+			d.PurgeOnce()
+			continue
+		case <-ctx.Done():
+			return
+		}
+		d.DeliverDue(ctx)
+	}
+}
+
+// Attempts every due delivery once and returns how many were attempted.
+// Webhooks are delivered to concurrently, up to the configured limit, so a
+// slow receiver only delays its own deliveries; each webhook still gets its
+// deliveries one at a time and in order
+func (d *Dispatcher) DeliverDue(ctx context.Context) int {
+	// A webhook's deliveries are sent one after another, so the claim covers
+	// a whole batch timing out
+	now := d.now()
+	due, err := d.repo.DueDeliveries(now, now.Add(batchSize*d.cfg.Timeout), batchSize)
+	if err != nil {
+		slog.Error("Failed to load due webhook deliveries", "error", err)
+		return 0
+	}
+
+	var order []int64
+	byWebhook := make(map[int64][]*models.WebhookDelivery)
+	for i := range due {
+		id := due[i].WebhookID
+		if _, ok := byWebhook[id]; !ok {
+			order = append(order, id)
+		}
+		byWebhook[id] = append(byWebhook[id], &due[i])
+	}
+
+	var wg sync.WaitGroup
+	var attempted atomic.Int64
+	sem := make(chan struct{}, max(d.cfg.Concurrency, 1))
+	for _, id := range order {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return int(attempted.Load())
+		}
+		wg.Add(1)
+		go func(deliveries []*models.WebhookDelivery) {
+			defer func() { <-sem; wg.Done() }()
+			attempted.Add(int64(d.deliverAll(ctx, id, deliveries)))
+		}(byWebhook[id])
+	}
+	wg.Wait()
+	return int(attempted.Load())
+}
+
+// Attempts the due deliveries of one webhook in order, returning how many
+// were attempted before ctx was done
+func (d *Dispatcher) deliverAll(ctx context.Context, webhookID int64, deliveries []*models.WebhookDelivery) int {
+	w, err := d.repo.Get(webhookID)
+	if err != nil {
+		slog.Error("Failed to load webhook", "webhook_id", webhookID, "error", err)
+		return 0
+	}
+
+	for i, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return i
+		}
+		d.attempt(ctx, w, delivery)
+		if err := d.repo.UpdateDelivery(delivery); err != nil {
+			slog.Error("Failed to record webhook delivery attempt", "delivery_id", delivery.ID, "error", err)
+		}
+	}
+	return len(deliveries)
+}
+
+// Sends one delivery and updates its status, attempts and next attempt time
+func (d *Dispatcher) attempt(ctx context.Context, w *models.Webhook, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+
+	var status int
+	var err error
+	switch {
+	case w == nil:
+		err = fmt.Errorf("webhook was deleted")
+	case !w.Active:
+		err = fmt.Errorf("webhook is inactive")
+	default:
+		status, err = d.post(ctx, w, delivery)
+	}
+
+	now := d.now().UTC()
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = models.DeliverySucceeded
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		metrics.WebhookDeliveries.WithLabelValues(models.DeliverySucceeded).Inc()
+		return
+	}
+
+	delivery.Error = err.Error()
+	if w == nil || !w.Active || delivery.Attempts >= d.cfg.MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		metrics.WebhookDeliveries.WithLabelValues(models.DeliveryFailed).Inc()
+		slog.Warn("Webhook delivery failed", "webhook_id", delivery.WebhookID, "delivery_id", delivery.ID,
+			"attempts", delivery.Attempts, "error", err)
+		return
+	}
+
+	next := now.Add(d.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+	metrics.WebhookDeliveries.WithLabelValues("retrying").Inc()
+}
+
+// Posts the delivery payload and returns the response status; any status
+// outside 2xx is an error
+func (d *Dispatcher) post(ctx context.Context, w *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mqtt-catalog-webhook")
+	req.Header.Set("X-Webhook-ID", strconv.FormatInt(w.ID, 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", Sign(w.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Returns the wait after the given number of failed attempts: the base
+// backoff doubled after every further attempt, capped at the maximum
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.RetryBackoff
+	for i := 1; i < attempts && wait < d.cfg.RetryBackoffMax; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.RetryBackoffMax)
+}
+
+// Deletes finished deliveries older than the delivery log retention
+func (d *Dispatcher) PurgeOnce() int64 {
+	cutoff := d.now().Add(-time.Duration(d.cfg.DeliveryLogDays) * day)
+	removed, err := d.repo.PurgeDeliveries(cutoff)
+	if err != nil {
+		slog.Error("Webhook delivery log purge failed", "error", err)
+		return 0
+	}
+	if removed > 0 {
+		slog.Info("Webhook delivery log purged", "removed", removed)
+	}
+	return removed
+}
+
+// Returns the X-Webhook-Signature value for a delivery: the hex HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the webhook secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,297 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mqtt-catalog/internal/config"
+	"mqtt-catalog/internal/database"
+	"mqtt-catalog/internal/events"
+	"mqtt-catalog/internal/repository"
+	"mqtt-catalog/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testConfig = config.WebhookConfig{
+	MaxAttempts:     3,
+	RetryBackoff:    30 * time.Second,
+	RetryBackoffMax: 45 * time.Second,
+	Timeout:         5 * time.Second,
+	DeliveryLogDays: 30,
+}
+
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(database.SQLiteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Every connection to :memory: opens a new database
+	db.SetMaxOpenConns(1)
+
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return db
+}
+
+// Receiver that records requests and answers with the queued statuses, 204
+// once they run out
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	w := models.Webhook{URL: server.URL, Secret: "whsec_test", Active: true, BrokerID: "broker1"}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	d := NewDispatcher(repo, testConfig)
+	event := models.TopicEvent{
+		ID:    7,
+		Type:  models.EventTopicCreated,
+		Topic: models.Topic{BrokerID: "broker1", Topic: "plant1/temperature"},
+	}
+	d.Enqueue(event)
+	// Ignored: sample refreshes are not webhook events, broker2 does not match
+	d.Enqueue(models.TopicEvent{ID: 8, Type: models.EventTopicSampleRefreshed, Topic: event.Topic})
+	d.Enqueue(models.TopicEvent{ID: 9, Type: models.EventTopicCreated, Topic: models.Topic{BrokerID: "broker2"}})
+
+	if n := d.DeliverDue(context.Background()); n != 1 {
+		t.Fatalf("DeliverDue() = %d, want 1", n)
+	}
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rc.requests))
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get("X-Webhook-Event") != models.EventTopicCreated || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	want := Sign("whsec_test", req.Header.Get("X-Webhook-Timestamp"), body)
+	if got := req.Header.Get("X-Webhook-Signature"); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	var got models.TopicEvent
+	if err := json.Unmarshal(body, &got); err != nil || got.ID != 7 || got.Topic.Topic != "plant1/temperature" {
+		t.Errorf("body = %s (%v)", body, err)
+	}
+
+	deliveries, _, _ := repo.ListDeliveries(w.ID, "", 10, 0)
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliverySucceeded ||
+		deliveries[0].ResponseStatus != http.StatusNoContent || deliveries[0].DeliveredAt == nil {
+		t.Errorf("delivery log = %+v", deliveries)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	failures := []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+	rc := &receiver{statuses: append([]int(nil), failures...)}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	w := models.Webhook{URL: server.URL, Secret: "s", Active: true}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	now := time.Now()
+	d := NewDispatcher(repo, testConfig)
+	d.now = func() time.Time { return now }
+	d.Enqueue(models.TopicEvent{ID: 1, Type: models.EventTopicStale, Topic: models.Topic{BrokerID: "b", Topic: "t"}})
+
+	wantBackoff := []time.Duration{30 * time.Second, 45 * time.Second}
+	for attempt := 1; attempt <= testConfig.MaxAttempts; attempt++ {
+		if n := d.DeliverDue(context.Background()); n != 1 {
+			t.Fatalf("attempt %d: DeliverDue() = %d, want 1", attempt, n)
+		}
+		// Nothing is due again until the backoff has passed
+		if n := d.DeliverDue(context.Background()); n != 0 {
+			t.Fatalf("attempt %d: retried before backoff", attempt)
+		}
+
+		deliveries, _, _ := repo.ListDeliveries(w.ID, "", 10, 0)
+		delivery := deliveries[0]
+		if delivery.Attempts != attempt || delivery.ResponseStatus != failures[attempt-1] {
+			t.Errorf("attempt %d: delivery = %+v", attempt, delivery)
+		}
+		if attempt < testConfig.MaxAttempts {
+			if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt == nil ||
+				!delivery.NextAttemptAt.Equal(now.UTC().Add(wantBackoff[attempt-1])) {
+				t.Errorf("attempt %d: delivery = %+v, want retry after %v", attempt, delivery, wantBackoff[attempt-1])
+			}
+			now = *delivery.NextAttemptAt
+		} else if delivery.Status != models.DeliveryFailed || delivery.NextAttemptAt != nil {
+			t.Errorf("final attempt: delivery = %+v, want failed", delivery)
+		}
+	}
+}
+
+func TestDispatcher_DeliverDueConcurrently(t *testing.T) {
+	// The slow receiver only answers once the fast one was delivered to
+	fastDone := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-fastDone:
+		case <-time.After(3 * time.Second):
+			t.Error("slow webhook held up the other webhook's delivery")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fastDone)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer fast.Close()
+
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	for _, url := range []string{slow.URL, fast.URL} {
+		if err := repo.Create(&models.Webhook{URL: url, Secret: "s", Active: true}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	cfg := testConfig
+	cfg.Concurrency = 2
+	d := NewDispatcher(repo, cfg)
+	d.Enqueue(models.TopicEvent{ID: 1, Type: models.EventTopicCreated, Topic: models.Topic{BrokerID: "b", Topic: "t"}})
+
+	if n := d.DeliverDue(context.Background()); n != 2 {
+		t.Errorf("DeliverDue() = %d, want 2", n)
+	}
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	w := models.Webhook{URL: server.URL, Secret: "s", Active: true, Events: []string{models.EventTopicPayloadTypeChanged}}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	hub := events.NewHub(16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewDispatcher(repo, testConfig).Run(ctx, hub)
+		close(done)
+	}()
+
+	// Wait for the dispatcher to subscribe so the events are not missed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.Publish(models.TopicEvent{Type: models.EventTopicPayloadTypeChanged, Topic: models.Topic{Topic: "a", SamplePayload: []byte("secret")}})
+		time.Sleep(20 * time.Millisecond)
+		rc.mu.Lock()
+		n := len(rc.requests)
+		rc.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no delivery received")
+		}
+	}
+
+	// Published events reach webhooks without the sample payload
+	rc.mu.Lock()
+	body := rc.bodies[0]
+	rc.mu.Unlock()
+	var got models.TopicEvent
+	if err := json.Unmarshal(body, &got); err != nil || len(got.Topic.SamplePayload) != 0 {
+		t.Errorf("delivered event = %s (%v), want no sample payload", body, err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+}
+
+func TestDispatcher_ConsumeStopsOnHubClose(t *testing.T) {
+	hub := events.NewHub(16)
+	d := NewDispatcher(repository.NewWebhookRepository(setupTestDB(t)), testConfig)
+
+	done := make(chan struct{})
+	go func() {
+		d.consume(context.Background(), hub)
+		close(done)
+	}()
+
+	hub.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consume() kept resubscribing to a closed hub")
+	}
+}
+
+func TestDispatcher_PurgeOnce(t *testing.T) {
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	w := models.Webhook{URL: "https://hooks.example.com", Secret: "s", Active: true}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	old := time.Now().Add(-31 * 24 * time.Hour)
+	for _, status := range []string{models.DeliverySucceeded, models.DeliveryPending} {
+		d := models.WebhookDelivery{WebhookID: w.ID, Status: status, Payload: []byte(`{}`), CreatedAt: old, NextAttemptAt: &old}
+		if err := repo.CreateDelivery(&d); err != nil {
+			t.Fatalf("CreateDelivery() error = %v", err)
+		}
+	}
+
+	if removed := NewDispatcher(repo, testConfig).PurgeOnce(); removed != 1 {
+		t.Errorf("PurgeOnce() = %d, want 1", removed)
+	}
+}
+
+func TestDispatcher_RecordMissed(t *testing.T) {
+	repo := repository.NewWebhookRepository(setupTestDB(t))
+	w := models.Webhook{URL: "https://hooks.example.com", Secret: "s", Active: true}
+	if err := repo.Create(&w); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	NewDispatcher(repo, testConfig).recordMissed(7)
+
+	deliveries, total, err := repo.ListDeliveries(w.ID, models.DeliveryMissed, 10, 0)
+	if err != nil || total != 1 || deliveries[0].EventID != 7 || deliveries[0].EventType != models.EventsMissed {
+		t.Errorf("missed deliveries = %+v, %d, %v", deliveries, total, err)
+	}
+}
@@ -9,22 +9,41 @@ import (
 	"io"
 	"mqtt-catalog/pkg/models"
 	"net/http"
+	"net/url"
 	"time"
 )
 
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL     string
+	httpClient  *http.Client
+	apiKey      string
+	bearerToken string
+}
+
+type Option func(*Client)
+
+// Authenticates requests with an API key sent in the X-API-Key header
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// Authenticates requests with a bearer token such as a JWT
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.bearerToken = token }
 }
 
 // Creates new database client with base URL and 10-second timeout
-func New(baseURL string) *Client {
-	return &Client{
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Posts MQTT sample data to database service via HTTP API with context support
@@ -34,27 +53,172 @@ func (c *Client) SendSample(ctx context.Context, sample models.Sample) error {
 		return fmt.Errorf("marshal error: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		c.baseURL+"/api/samples",
-		bytes.NewBuffer(jsonData),
-	)
+	resp, err := c.do(ctx, "POST", "/api/v1/samples", jsonData)
 	if err != nil {
-		return fmt.Errorf("create request error: %w", err)
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer resp.Body.Close()
 
-	resp, err := c.httpClient.Do(req)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp)
+	}
+
+	return nil
+}
+
+// Returns the names of the broker's topics the catalog saw at or after
+// since, fetching every page
+func (c *Client) KnownTopics(ctx context.Context, brokerID string, since time.Time) ([]string, error) {
+	var topics []string
+	after := ""
+	for {
+		known, err := c.knownTopicsPage(ctx, brokerID, since, after)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, known.Topics...)
+		if known.NextAfter == "" {
+			return topics, nil
+		}
+		// The server orders by its collation, which need not match Go's
+		// byte order, so only a repeated cursor means no progress
+		if known.NextAfter == after {
+			return nil, fmt.Errorf("known topics: page after %q did not advance", after)
+		}
+		after = known.NextAfter
+	}
+}
+
+// Fetches the page of known topics sorting after the given topic
+func (c *Client) knownTopicsPage(ctx context.Context, brokerID string, since time.Time, after string) (*models.KnownTopicsResponse, error) {
+	query := url.Values{"broker_id": {brokerID}, "seen_after": {since.UTC().Format(time.RFC3339)}}
+	if after != "" {
+		query.Set("after", after)
+	}
+	resp, err := c.do(ctx, "GET", "/api/v1/samples/known?"+query.Encode(), nil)
 	if err != nil {
-		return fmt.Errorf("http error: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("db service returned status %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var known models.KnownTopicsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&known); err != nil {
+		return nil, fmt.Errorf("decode known topics: %w", err)
+	}
+	return &known, nil
+}
+
+// Claims sampling a topic for the collector instance, so that of several
+// instances sharing a broker's messages only one uploads it
+func (c *Client) ClaimSample(ctx context.Context, claim models.ClaimRequest) (*models.ClaimResponse, error) {
+	jsonData, err := json.Marshal(claim)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+
+	resp, err := c.do(ctx, "POST", "/api/v1/samples/claims", jsonData)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var result models.ClaimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode claim: %w", err)
+	}
+	return &result, nil
+}
+
+// Drops the instance's claim on a topic so another instance sharing the
+// broker can sample it
+func (c *Client) ReleaseClaim(ctx context.Context, brokerID, topic, instanceID string) error {
+	query := url.Values{"broker_id": {brokerID}, "topic": {topic}, "instance_id": {instanceID}}
+	resp, err := c.do(ctx, "DELETE", "/api/v1/samples/claims?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Not found means the claim already expired or was taken over
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Renews the collector instance's membership and its leases on the wanted
+// brokers, returning the live members and the brokers it was granted
+func (c *Client) RenewLease(ctx context.Context, instanceID string, brokers []string, ttl time.Duration) (*models.LeaseResponse, error) {
+	jsonData, err := json.Marshal(models.LeaseRequest{Brokers: brokers, TTLSeconds: int(ttl.Seconds())})
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+
+	resp, err := c.do(ctx, "PUT", "/api/v1/collectors/"+url.PathEscape(instanceID)+"/lease", jsonData)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var lease models.LeaseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, fmt.Errorf("decode lease: %w", err)
+	}
+	return &lease, nil
+}
+
+// Releases the collector instance's leases so other instances take its
+// brokers over without waiting for the leases to expire
+func (c *Client) ReleaseLease(ctx context.Context, instanceID string) error {
+	resp, err := c.do(ctx, "DELETE", "/api/v1/collectors/"+url.PathEscape(instanceID)+"/lease", nil)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
+	// Not found means the lease already expired, which is what was asked for
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp)
+	}
 	return nil
 }
+
+// Sends an authenticated request with an optional JSON body
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request error: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http error: %w", err)
+	}
+	return resp, nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("db service returned status %d: %s", resp.StatusCode, string(body))
+}
@@ -7,6 +7,7 @@ import (
 	"mqtt-catalog/pkg/models"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,8 +21,8 @@ func TestClient_SendSample_Success(t *testing.T) {
 		}
 
 		// Verify path
-		if r.URL.Path != "/api/samples" {
-			t.Errorf("expected /api/samples, got %s", r.URL.Path)
+		if r.URL.Path != "/api/v1/samples" {
+			t.Errorf("expected /api/v1/samples, got %s", r.URL.Path)
 		}
 
 		// Verify content type
@@ -111,3 +112,172 @@ func TestClient_SendSample_ContextCanceled(t *testing.T) {
 		t.Error("expected error for canceled context, got nil")
 	}
 }
+
+func TestClient_SendSample_Credentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-API-Key"); got != "mqc_test" {
+			t.Errorf("expected X-API-Key 'mqc_test', got '%s'", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("expected bearer token, got '%s'", got)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, WithAPIKey("mqc_test"), WithBearerToken("token"))
+
+	if err := client.SendSample(context.Background(), models.Sample{BrokerID: "b", Topic: "t"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestClient_KnownTopics(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/samples/known" || r.URL.Query().Get("broker_id") != "broker 1" ||
+			r.URL.Query().Get("seen_after") != "2024-05-01T12:00:00Z" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		resp := models.KnownTopicsResponse{BrokerID: "broker 1", SeenAfter: since}
+		switch after := r.URL.Query().Get("after"); after {
+		case "":
+			resp.Topics, resp.NextAfter = []string{"a/b", "a/c"}, "a/c"
+		case "a/c":
+			// A case-insensitive collation sorts B/d after a/c, unlike Go
+			resp.Topics, resp.NextAfter = []string{"B/d"}, "B/d"
+		case "B/d":
+			resp.Topics = []string{"c/e"}
+		default:
+			t.Errorf("unexpected after %q", after)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	topics, err := New(server.URL).KnownTopics(context.Background(), "broker 1", since.In(time.FixedZone("CEST", 2*3600)))
+	if err != nil {
+		t.Fatalf("KnownTopics() error = %v", err)
+	}
+	if strings.Join(topics, ",") != "a/b,a/c,B/d,c/e" {
+		t.Errorf("KnownTopics() = %v, want all pages", topics)
+	}
+}
+
+func TestClient_KnownTopics_NoProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.KnownTopicsResponse{Topics: []string{"a/b"}, NextAfter: "a/b"})
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL).KnownTopics(context.Background(), "broker1", time.Now()); err == nil || !strings.Contains(err.Error(), "did not advance") {
+		t.Errorf("KnownTopics() error = %v, want a repeated cursor to fail", err)
+	}
+}
+
+func TestClient_ClaimSample(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/samples/claims" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		var req models.ClaimRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.BrokerID != "broker1" || req.Topic != "plant1/temp" || req.TTLSeconds != 60 {
+			t.Errorf("unexpected claim request %+v", req)
+		}
+
+		json.NewEncoder(w).Encode(models.ClaimResponse{Claimed: req.InstanceID == "collector-a", ClaimedBy: "collector-a"})
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	for _, instanceID := range []string{"collector-a", "collector-b"} {
+		claim, err := client.ClaimSample(context.Background(), models.ClaimRequest{
+			BrokerID: "broker1", Topic: "plant1/temp", InstanceID: instanceID, TTLSeconds: 60,
+		})
+		if err != nil {
+			t.Fatalf("ClaimSample() error = %v", err)
+		}
+		if claim.Claimed != (instanceID == "collector-a") || claim.ClaimedBy != "collector-a" {
+			t.Errorf("ClaimSample() for %s = %+v", instanceID, claim)
+		}
+	}
+}
+
+func TestClient_ReleaseClaim(t *testing.T) {
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method != http.MethodDelete || r.URL.Path != "/api/v1/samples/claims" ||
+			q.Get("broker_id") != "broker1" || q.Get("topic") != "plant1/#temp" || q.Get("instance_id") != "collector-a" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	for _, status = range []int{http.StatusNoContent, http.StatusNotFound} {
+		if err := client.ReleaseClaim(context.Background(), "broker1", "plant1/#temp", "collector-a"); err != nil {
+			t.Errorf("ReleaseClaim() with status %d error = %v", status, err)
+		}
+	}
+
+	status = http.StatusInternalServerError
+	if err := client.ReleaseClaim(context.Background(), "broker1", "plant1/#temp", "collector-a"); err == nil {
+		t.Error("expected error for server error")
+	}
+}
+
+func TestClient_RenewLease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/v1/collectors/collector-a/lease" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+
+		var req models.LeaseRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.TTLSeconds != 30 || len(req.Brokers) != 2 {
+			t.Errorf("unexpected lease request %+v", req)
+		}
+
+		json.NewEncoder(w).Encode(models.LeaseResponse{
+			InstanceID: "collector-a",
+			Members:    []string{"collector-a", "collector-b"},
+			Brokers:    req.Brokers[:1],
+		})
+	}))
+	defer server.Close()
+
+	lease, err := New(server.URL).RenewLease(context.Background(), "collector-a", []string{"b1", "b2"}, 30*time.Second)
+	if err != nil {
+		t.Fatalf("RenewLease() error = %v", err)
+	}
+	if len(lease.Members) != 2 || len(lease.Brokers) != 1 || lease.Brokers[0] != "b1" {
+		t.Errorf("RenewLease() = %+v", lease)
+	}
+}
+
+func TestClient_ReleaseLease(t *testing.T) {
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/api/v1/collectors/collector-a/lease" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	for _, status = range []int{http.StatusNoContent, http.StatusNotFound} {
+		if err := client.ReleaseLease(context.Background(), "collector-a"); err != nil {
+			t.Errorf("ReleaseLease() with status %d error = %v", status, err)
+		}
+	}
+
+	status = http.StatusInternalServerError
+	if err := client.ReleaseLease(context.Background(), "collector-a"); err == nil {
+		t.Error("expected error for server error response, got nil")
+	}
+}
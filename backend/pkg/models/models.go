@@ -18,6 +18,25 @@ type Sample struct {
 	PayloadType PayloadType `json:"payload_type"`
 	Payload     []byte      `json:"payload"`
 	Timestamp   time.Time   `json:"timestamp"`
+	// Truncated is set by the server when it cut Payload to the maximum
+	// sample size; the value a client sends is ignored
+	Truncated bool `json:"truncated,omitempty"`
+	// Flags name the detectors that found likely PII or secrets in the
+	// payload, Redacted is set when those spans were replaced
+	Flags    []string `json:"flags,omitempty"`
+	Redacted bool     `json:"redacted,omitempty"`
+	// CreatedAt overrides the creation time of a new topic, used by imports
+	CreatedAt time.Time `json:"-"`
+}
+
+// Acknowledges a stored sample without echoing its payload back
+type SampleResult struct {
+	ID        int64     `json:"id"`
+	BrokerID  string    `json:"broker_id"`
+	Topic     string    `json:"topic"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Truncated bool      `json:"truncated"`
 }
 
 // Topic is the database model
@@ -29,9 +48,322 @@ type Topic struct {
 	SamplePayload []byte      `json:"sample_payload" db:"sample_payload"`
 	LastSeen      time.Time   `json:"last_seen"      db:"last_seen"`
 	CreatedAt     time.Time   `json:"created_at"     db:"created_at"`
+	Truncated     bool        `json:"truncated"      db:"truncated"`
+	Flags         []string    `json:"flags,omitempty" db:"flags"`
+	Redacted      bool        `json:"redacted"       db:"redacted"`
+	// Annotations whose broker and topic filter match, set by listings
+	Annotations []Annotation `json:"annotations,omitempty" db:"-"`
+}
+
+type Classification string
+
+const (
+	ClassificationPublic       Classification = "public"
+	ClassificationInternal     Classification = "internal"
+	ClassificationConfidential Classification = "confidential"
+)
+
+// Human metadata for one topic or every topic matching an MQTT filter.
+// An empty BrokerID applies the annotation to all brokers
+type Annotation struct {
+	ID             int64          `json:"id"`
+	BrokerID       string         `json:"broker_id,omitempty"`
+	TopicFilter    string         `json:"topic_filter"`
+	Owner          string         `json:"owner,omitempty"`
+	Description    string         `json:"description,omitempty"`
+	Tags           []string       `json:"tags"`
+	Classification Classification `json:"classification,omitempty"`
+	Links          []string       `json:"links"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+type AnnotationListResponse struct {
+	Annotations []Annotation `json:"annotations"`
+	Total       int          `json:"total"`
 }
 
 type TopicListResponse struct {
 	Topics []Topic `json:"topics"`
-	Total  int     `json:"total"`
+	// Total is -1 when the count was skipped (count=none)
+	Total          int    `json:"total"`
+	TotalEstimated bool   `json:"total_estimated,omitempty"`
+	NextCursor     string `json:"next_cursor,omitempty"`
+}
+
+type StaleTopic struct {
+	Topic
+	StaleSince time.Time  `json:"stale_since"`
+	PurgeAt    *time.Time `json:"purge_at,omitempty"`
+}
+
+type StaleTopicReport struct {
+	Topics []StaleTopic `json:"topics"`
+	Total  int          `json:"total"`
+}
+
+const (
+	EventTopicCreated            = "topic.created"
+	EventTopicPayloadTypeChanged = "topic.payload_type_changed"
+	EventTopicSampleRefreshed    = "topic.sample_refreshed"
+	// The fields of a JSON or XML sample changed while its payload type stayed
+	EventTopicSchemaDrift = "topic.schema_drift"
+	// The topic crossed its broker's stale threshold
+	EventTopicStale = "topic.stale"
+)
+
+// Change to a topic published on the live event stream
+type TopicEvent struct {
+	ID    uint64    `json:"id"`
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Topic Topic     `json:"topic"`
+	// Set on payload_type_changed events
+	PreviousPayloadType PayloadType `json:"previous_payload_type,omitempty"`
+	// Set on schema_drift events: field paths such as reading.temp or
+	// items[].id that appeared in or disappeared from the sample
+	AddedFields   []string `json:"added_fields,omitempty"`
+	RemovedFields []string `json:"removed_fields,omitempty"`
+}
+
+// Outbound subscription to topic events. Empty Events subscribes to every
+// webhook event, an empty BrokerID or TopicFilter matches all topics
+type Webhook struct {
+	ID          int64    `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	BrokerID    string   `json:"broker_id,omitempty"`
+	TopicFilter string   `json:"topic_filter,omitempty"`
+	Active      bool     `json:"active"`
+	// Secret signs deliveries; it is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookListResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Total    int       `json:"total"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+	// Marks a gap in the log: events after the row's event ID were never
+	// recorded, so they are not sent
+	DeliveryMissed = "missed"
+)
+
+// Event type of missed delivery rows
+const EventsMissed = "events.missed"
+
+// One event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int64  `json:"webhook_id"`
+	EventID   uint64 `json:"event_id"`
+	EventType string `json:"event_type"`
+	BrokerID  string `json:"broker_id"`
+	Topic     string `json:"topic"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// ResponseStatus and Error describe the last attempt
+	ResponseStatus int        `json:"response_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	// Payload is the signed request body, kept so retries send the same bytes
+	Payload []byte `json:"-"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+}
+
+// Renewal of a collector instance's membership and broker leases
+type LeaseRequest struct {
+	// Brokers the instance wants to collect; leases it holds on any other
+	// broker are released
+	Brokers    []string `json:"brokers"`
+	TTLSeconds int      `json:"ttl_seconds"`
+}
+
+type LeaseResponse struct {
+	InstanceID string `json:"instance_id"`
+	// Members are the live collector instances, the requester included
+	Members []string `json:"members"`
+	// Brokers are the requested brokers the instance now holds a lease on;
+	// the others are still leased to another instance
+	Brokers   []string  `json:"brokers"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// A live collector instance and the brokers it holds leases on
+type CollectorInstance struct {
+	InstanceID string    `json:"instance_id"`
+	Brokers    []string  `json:"brokers"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type CollectorListResponse struct {
+	Collectors []CollectorInstance `json:"collectors"`
+}
+
+// Topics of a broker seen since a point in time, which a restarted collector
+// skips instead of sampling them again. Pages continue after NextAfter
+type KnownTopicsResponse struct {
+	BrokerID  string    `json:"broker_id"`
+	SeenAfter time.Time `json:"seen_after"`
+	Topics    []string  `json:"topics"`
+	NextAfter string    `json:"next_after,omitempty"`
+}
+
+// Claim on sampling a topic, taken by collectors sharing one broker's
+// messages so only one of them uploads each topic
+type ClaimRequest struct {
+	BrokerID   string `json:"broker_id"`
+	Topic      string `json:"topic"`
+	InstanceID string `json:"instance_id"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type ClaimResponse struct {
+	// Claimed is true when the requester holds the claim and should upload
+	// the sample
+	Claimed   bool      `json:"claimed"`
+	ClaimedBy string    `json:"claimed_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const (
+	TailMessage = "message"
+	TailDropped = "dropped"
+	TailClosed  = "closed"
+)
+
+// Frame sent to live tail clients: a message, a count of messages dropped by
+// the rate cap, or the reason the session ended
+type TailEvent struct {
+	Type        string      `json:"type"`
+	Time        time.Time   `json:"time"`
+	Topic       string      `json:"topic,omitempty"`
+	PayloadType PayloadType `json:"payload_type,omitempty"`
+	// Payload holds text, JSON and XML payloads, PayloadBase64 binary ones
+	Payload       string `json:"payload,omitempty"`
+	PayloadBase64 []byte `json:"payload_base64,omitempty"`
+	Retained      bool   `json:"retained,omitempty"`
+	Truncated     bool   `json:"truncated,omitempty"`
+	// Flags name the detectors that found likely PII or secrets
+	Flags    []string `json:"flags,omitempty"`
+	Redacted bool     `json:"redacted,omitempty"`
+	Dropped  int      `json:"dropped,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Outcome of a catalog import, or what it would do in a dry run
+type ImportReport struct {
+	DryRun    bool `json:"dry_run"`
+	Inserted  int  `json:"inserted"`
+	Updated   int  `json:"updated"`
+	Skipped   int  `json:"skipped"`
+	Conflicts int  `json:"conflicts"`
+	Failed    int  `json:"failed"`
+	// The first conflicts and failed lines, the counts above cover all of them
+	ConflictDetails []ImportConflict `json:"conflict_details"`
+	Errors          []ImportError    `json:"errors"`
+}
+
+// An imported topic whose payload type or sample differs from the stored one
+type ImportConflict struct {
+	Line                int         `json:"line"`
+	BrokerID            string      `json:"broker_id"`
+	Topic               string      `json:"topic"`
+	ExistingPayloadType PayloadType `json:"existing_payload_type"`
+	ImportedPayloadType PayloadType `json:"imported_payload_type"`
+	ExistingLastSeen    time.Time   `json:"existing_last_seen"`
+	ImportedLastSeen    time.Time   `json:"imported_last_seen"`
+	// Resolution is "imported" when the import replaces the topic, "existing" when it is kept
+	Resolution string `json:"resolution"`
+}
+
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// A topic that breaks a governance naming rule
+type GovernanceViolation struct {
+	BrokerID string `json:"broker_id"`
+	Topic    string `json:"topic"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type GovernanceReport struct {
+	Rules         int `json:"rules"`
+	TopicsChecked int `json:"topics_checked"`
+	// Total, Errors and Warnings count violations across all pages
+	Total      int                   `json:"total"`
+	Errors     int                   `json:"errors"`
+	Warnings   int                   `json:"warnings"`
+	Violations []GovernanceViolation `json:"violations"`
+}
+
+// Body of every API error response
+type ErrorResponse struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+type APIKey struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchResult struct {
+	Topic   Topic   `json:"topic"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+}
+
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+
+	CheckPass = "pass"
+	CheckFail = "fail"
+)
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+	Pool   *PoolStats             `json:"pool,omitempty"`
 }